@@ -0,0 +1,212 @@
+// Subcommand (`phredsort check`) for verifying that a file is sorted by a quality metric
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// CheckCommand creates the `check` subcommand which verifies that records are
+// in the order produced by phredsort (e.g., before greedy clustering)
+func CheckCommand() *cobra.Command {
+	var (
+		inFiles       []string
+		metric        string
+		ascending     bool
+		computed      bool
+		fromHeader    bool
+		headerAliases string
+		minPhred      int
+		strictTies    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check that sequences are sorted by a quality metric",
+		Long: `Stream a FASTA/FASTQ (or SAM/BAM) file and check that records are sorted by a quality
+metric, either annotated in the headers (--header, default) or recomputed from the base qualities
+(--computed, FASTQ only). The command fails at the first record that is out of order,
+reporting its number. Records with equal values should be ordered by name in
+natural order; records that are not are reported (and fail the check with --strict-ties).`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if computed && fromHeader {
+				return fmt.Errorf("--computed and --header can't be used together")
+			}
+			qualityMetric, err := validateMetric(metric)
+			if err != nil {
+				return err
+			}
+			aliases, err := parseHeaderAliases(headerAliases)
+			if err != nil {
+				return err
+			}
+
+			// Several files are checked as one (e.g., parts of a split output)
+			input, err := parseInput(cmd, inFiles, args, false, "ignore")
+			if err != nil {
+				return err
+			}
+
+			summary, err := runCheck(input, metricSortKey(qualityMetric, aliases), ascending, computed, minPhred, strictTies)
+			if err != nil {
+				return err
+			}
+			summary.Write(os.Stderr)
+
+			// An unsorted file is a check result, not a usage error
+			if summary.Violation != "" {
+				fmt.Fprintln(os.Stderr, red("Error: not sorted: "+summary.Violation))
+				exitFunc(1)
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringArrayVarP(&inFiles, "in", "i", []string{"-"}, "Input sequence file; may be repeated, or files may be given as arguments (default: stdin)")
+	flags.StringVarP(&metric, "metric", "s", "avgphred", "Quality metric (avgphred, maxee, meep, lqcount, lqpercent)")
+	flags.BoolVarP(&ascending, "ascending", "a", false, "Expect ascending order of quality (as with --ascending in sort)")
+	flags.BoolVar(&computed, "computed", false, "Recompute the metric from base qualities (FASTQ only)")
+	flags.BoolVar(&fromHeader, "header", false, "Take the metric from header annotations (default)")
+	flags.StringVar(&headerAliases, "header-alias", "", "Comma-separated metric=key aliases used in headers (e.g., 'maxee=ee')")
+	flags.IntVarP(&minPhred, "minphred", "p", DEFAULT_MIN_PHRED, "Quality threshold for 'lqcount' and 'lqpercent' metrics (with --computed)")
+	flags.BoolVar(&strictTies, "strict-ties", false, "Fail if records with equal values are not in natural name order")
+
+	return cmd
+}
+
+// CheckSummary is the result of `phredsort check`
+type CheckSummary struct {
+	Key           string
+	Ascending     bool
+	Records       int    // Records read (up to the first violation)
+	Ties          int    // Records with the same value as the previous record
+	TieViolations int    // Ties not in natural name order
+	FirstTie      string // Description of the first tie-break violation
+	Violation     string // Description of the first order violation ("" = sorted)
+}
+
+// Write prints the summary in a human-readable form
+func (s CheckSummary) Write(w io.Writer) {
+	order := "default"
+	if s.Ascending {
+		order = "ascending"
+	}
+	fmt.Fprintf(w, "%s %d records checked by %s (%s order); %d ties, %d not in natural name order\n",
+		bold("Checked:"), s.Records, s.Key, order, s.Ties, s.TieViolations)
+	if s.FirstTie != "" && s.Violation != s.FirstTie {
+		fmt.Fprintln(w, yellow("Warning: tie-breaks do not follow the natural name rule: "+s.FirstTie))
+	}
+}
+
+// runCheck streams records and compares each one with the previous record, using
+// the comparator of headersort (or, with computed, of sort). Reading stops at the
+// first order violation, which is described in the summary along with the number
+// of the record (within its file)
+//
+// Parameters:
+//   - in: Input sequence files (use "-" for stdin), checked as one
+//   - key: Header key of the quality metric (see metricSortKey)
+//   - ascending: Whether ascending order of quality is expected
+//   - computed: Recompute the metric from base qualities instead of parsing headers
+//   - minPhred: Minimum Phred threshold for lqcount/lqpercent (with computed)
+//   - strictTies: Treat tie-break violations as order violations
+//
+// Returns an error if file I/O fails, a header has no (valid) metric value,
+// or computed is used with FASTA input
+func runCheck(in Input, key HeaderSortKey, ascending, computed bool, minPhred int, strictTies bool) (CheckSummary, error) {
+	summary := CheckSummary{Key: key.Name, Ascending: ascending}
+
+	reader, err := NewInputReader(in)
+	if err != nil {
+		return summary, fmt.Errorf("error creating reader: %v", err)
+	}
+	defer reader.Close()
+
+	// Same ordering as headersort or as sort (ties broken by ID in natural order)
+	list := NewHeaderKeySortIndexList(nil, nil, ascending, key, false)
+	less := func(v, prevV float64, id, prevID string) bool {
+		if computed {
+			return qualityLess(v, prevV, id, prevID, ascending, key.Metric)
+		}
+		a, b := HeaderSortIndex{Quality: v}, HeaderSortIndex{Quality: prevV}
+		return list.lessItems(&a, &b, id, prevID)
+	}
+
+	// The files are checked as one input, so the first record of a file
+	// is compared with the last record of the preceding file
+	var prevV float64
+	var prevID, file string
+	n := 0 // Number of the record within its file
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return summary, nil
+		}
+		if err != nil {
+			return summary, fmt.Errorf("error reading record: %v", err)
+		}
+		summary.Records++
+
+		// Locations are prefixed with the file name when several files are checked
+		if reader.File() != file {
+			file, n = reader.File(), 0
+		}
+		n++
+		where := "record " + strconv.Itoa(n)
+		if len(in.Files) > 1 {
+			where = file + ": " + where
+		}
+
+		var v float64
+		var id string
+		if computed {
+			if !reader.IsFastq {
+				return summary, errors.New(computedQualityFastqError)
+			}
+			v, id = calculateQuality(record, key.Metric, minPhred), recordID(record)
+		} else {
+			parsed := parseHeaderFields(string(record.Name))
+			value, found, err := parsed.Float(key.Name)
+			if err != nil {
+				return summary, fmt.Errorf("%s: %v", where, err)
+			}
+			if !found {
+				return summary, fmt.Errorf("%s: %s has no '%s' value", where, parsed.ID, key.Name)
+			}
+			v, id = value, parsed.ID
+		}
+
+		if summary.Records > 1 {
+			if v == prevV {
+				summary.Ties++
+			}
+			if less(v, prevV, id, prevID) {
+				violation := fmt.Sprintf("%s: %s (%s=%s) should precede %s (%s=%s)",
+					where, id, key.Name, formatCheckValue(v), prevID, key.Name, formatCheckValue(prevV))
+				if v == prevV {
+					summary.TieViolations++
+					if summary.FirstTie == "" {
+						summary.FirstTie = violation
+					}
+				}
+				if v != prevV || strictTies {
+					summary.Violation = violation
+					return summary, nil
+				}
+			}
+		}
+		prevV, prevID = v, id
+	}
+}
+
+// formatCheckValue formats a metric value in the shortest exact form
+func formatCheckValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
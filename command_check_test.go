@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func TestRunCheck(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		key           HeaderSortKey
+		ascending     bool
+		strictTies    bool
+		wantViolation string
+		wantTies      int
+		wantTieErrors int
+		wantErr       string
+	}{
+		{
+			name:     "Sorted by maxee, wrapped FASTA",
+			content:  ">s1;maxee=0.1\nAC\nGT\n>s2;maxee=0.1\nAC\n>s10;maxee=0.1\nA\n\n>s3;maxee=2\nACGT\n",
+			key:      metricSortKey(MaxEE, nil),
+			wantTies: 2,
+		},
+		{
+			name:          "Order violation with line number",
+			content:       ">s1;maxee=0.1\nAC\nGT\n>s2;maxee=0.5\nAC\n>s3;maxee=0.2\nACGT\n",
+			key:           metricSortKey(MaxEE, nil),
+			wantViolation: "record 3: s3;maxee=0.2 (maxee=0.2) should precede s2;maxee=0.5 (maxee=0.5)",
+		},
+		{
+			name:      "Ascending avgphred in FASTQ",
+			content:   "@s1 avgphred=10\nAC\n+\nII\n@s2 avgphred=30\nACGT\n+\nII\nII\n",
+			key:       metricSortKey(AvgPhred, nil),
+			ascending: true,
+		},
+		{
+			name:          "Ascending avgphred violation in FASTQ",
+			content:       "@s1 avgphred=10\nAC\n+\nII\n@s2 avgphred=30\nACGT\n+\nIIII\n@s3 avgphred=20\nA\n+\nI\n",
+			key:           metricSortKey(AvgPhred, nil),
+			ascending:     true,
+			wantViolation: "record 3: s3 (avgphred=20) should precede s2 (avgphred=30)",
+		},
+		{
+			name:          "Tie-breaks not in natural order are reported",
+			content:       ">s10 maxee=1\nA\n>s2 maxee=1\nA\n>s3 maxee=2\nA\n>s1 maxee=2\nA\n",
+			key:           metricSortKey(MaxEE, nil),
+			wantTies:      2,
+			wantTieErrors: 2,
+		},
+		{
+			name:          "Tie-breaks not in natural order fail with --strict-ties",
+			content:       ">s10 maxee=1\nA\n>s2 maxee=1\nA\n>s3 maxee=2\nA\n",
+			key:           metricSortKey(MaxEE, nil),
+			strictTies:    true,
+			wantViolation: "record 2: s2 (maxee=1) should precede s10 (maxee=1)",
+			wantTies:      1,
+			wantTieErrors: 1,
+		},
+		{
+			name:    "Missing metric",
+			content: ">s1 maxee=1\nA\n>s2\nA\n",
+			key:     metricSortKey(MaxEE, nil),
+			wantErr: "record 2: s2 has no 'maxee' value",
+		},
+		{
+			name:    "Truncated FASTQ",
+			content: "@s1 maxee=1\nACGT\n+\nII\n",
+			key:     metricSortKey(MaxEE, nil),
+			wantErr: "error reading record",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "input.fx")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			summary, err := runCheck(testInput(path), tt.key, tt.ascending, false, DEFAULT_MIN_PHRED, tt.strictTies)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("runCheck() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runCheck() error = %v", err)
+			}
+			if summary.Violation != tt.wantViolation {
+				t.Errorf("violation = %q, want %q", summary.Violation, tt.wantViolation)
+			}
+			if summary.Ties != tt.wantTies || summary.TieViolations != tt.wantTieErrors {
+				t.Errorf("ties = %d (%d not in natural order), want %d (%d)", summary.Ties, summary.TieViolations, tt.wantTies, tt.wantTieErrors)
+			}
+		})
+	}
+}
+
+func TestRunCheckComputed(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("r1", "ACGT", "5555"),
+		createTestRecord("r2", "ACGT", "IIII"),
+		createTestRecord("r10", "ACGT", "IIII"),
+		createTestRecord("r4", "ACGT", "++++"),
+	})
+
+	// Unsorted input
+	summary, err := runCheck(testInput(inputPath), metricSortKey(MaxEE, nil), false, true, DEFAULT_MIN_PHRED, false)
+	if err != nil {
+		t.Fatalf("runCheck() error = %v", err)
+	}
+	if !strings.HasPrefix(summary.Violation, "record 2: r2 ") {
+		t.Errorf("violation = %q", summary.Violation)
+	}
+
+	// Output of sort passes the check, including tie-breaks
+	for _, metric := range []QualityMetric{AvgPhred, MaxEE, LQCount} {
+		for _, ascending := range []bool{false, true} {
+			outputPath := filepath.Join(tmpDir, "sorted.fastq")
+			sortRecords(testInput(inputPath), outputPath, ascending, metric, 1, nil, defaultHeaderFormat, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{})
+
+			summary, err := runCheck(testInput(outputPath), metricSortKey(metric, nil), ascending, true, DEFAULT_MIN_PHRED, true)
+			if err != nil {
+				t.Fatalf("runCheck() error = %v", err)
+			}
+			if summary.Violation != "" || summary.Records != 4 || summary.Ties == 0 {
+				t.Errorf("%s (ascending %v): summary = %+v", metric, ascending, summary)
+			}
+		}
+	}
+
+	// SAM output of sort is read like any other input
+	samPath := filepath.Join(tmpDir, "sorted.sam")
+	sortRecords(testInput(inputPath), samPath, false, MaxEE, 1, nil, defaultHeaderFormat, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{})
+	summary, err = runCheck(testInput(samPath), metricSortKey(MaxEE, nil), false, true, DEFAULT_MIN_PHRED, true)
+	if err != nil || summary.Violation != "" || summary.Records != 4 {
+		t.Errorf("SAM input: summary = %+v, error = %v", summary, err)
+	}
+
+	// Tie-breaks compare IDs (not the descriptions that follow them)
+	tiesPath := filepath.Join(tmpDir, "ties.fastq")
+	writeFastqRecords(t, tiesPath, []*fastx.Record{
+		createTestRecord("r1 sample=B", "ACGT", "IIII"),
+		createTestRecord("r1 sample=A", "ACGT", "IIII"),
+		createTestRecord("r2 sample=A", "ACGT", "IIII"),
+	})
+	summary, err = runCheck(testInput(tiesPath), metricSortKey(MaxEE, nil), false, true, DEFAULT_MIN_PHRED, true)
+	if err != nil || summary.Violation != "" || summary.Ties != 2 || summary.TieViolations != 0 {
+		t.Errorf("ties: summary = %+v, error = %v", summary, err)
+	}
+}
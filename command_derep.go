@@ -0,0 +1,354 @@
+// Subcommand (`phredsort derep`) for quality-aware dereplication of sequences
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// QualityCombiner defines the quality string of a dereplicated sequence
+type QualityCombiner int
+
+const (
+	CombineBest QualityCombiner = iota // Qualities of the best read (by the quality metric)
+	CombineMin                         // Per-position minimum over all reads
+	CombineMean                        // Per-position mean error probability over all reads
+	CombineMax                         // Per-position maximum over all reads
+)
+
+// String returns the string representation of a QualityCombiner
+func (c QualityCombiner) String() string {
+	switch c {
+	case CombineBest:
+		return "best"
+	case CombineMin:
+		return "min"
+	case CombineMean:
+		return "mean"
+	case CombineMax:
+		return "max"
+	default:
+		return "unknown"
+	}
+}
+
+// parseQualityCombiner parses the value of the --quality flag
+func parseQualityCombiner(s string) (QualityCombiner, error) {
+	switch s {
+	case "best":
+		return CombineBest, nil
+	case "min":
+		return CombineMin, nil
+	case "mean":
+		return CombineMean, nil
+	case "max":
+		return CombineMax, nil
+	default:
+		return CombineBest, fmt.Errorf("invalid --quality combiner: %s (must be 'best', 'min', 'mean' or 'max')", s)
+	}
+}
+
+// DerepCommand creates the `derep` subcommand which collapses identical sequences,
+// keeping the best-quality read of each as the representative
+func DerepCommand() *cobra.Command {
+	var (
+		inFiles       []string
+		tagSource     bool
+		keepTags      string
+		duplicates    string
+		outFile       string
+		seqFormat     string
+		lineWidth     int
+		metric        string
+		minPhred      int
+		combiner      string
+		minSize       int
+		sizeIn        bool
+		headerMetrics string
+		compLevel     int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "derep",
+		Short: "Dereplicate sequences, keeping the best-quality read as the representative",
+		Long: `Collapse identical sequences (case-insensitive) into a single record. The read with
+the best quality metric becomes the representative, and its qualities are either kept
+(--quality best) or replaced by a per-position consensus of all reads (min, mean or max).
+The representative header gets a ";size=N" annotation, and the output is sorted by size,
+then by quality. The output can be sorted again with headersort.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			qualityMetric, err := validateMetric(metric)
+			if err != nil {
+				return err
+			}
+			qualityCombiner, err := parseQualityCombiner(combiner)
+			if err != nil {
+				return err
+			}
+			parsedHeaderMetrics, err := parseHeaderMetrics(headerMetrics)
+			if err != nil {
+				return err
+			}
+			if compLevel < 0 || compLevel > 22 {
+				return fmt.Errorf("compression level must be between 0 and 22")
+			}
+
+			input, err := parseInput(cmd, inFiles, args, tagSource, duplicates)
+			if err != nil {
+				return err
+			}
+			if input.KeepTags, err = parseTagFilter(keepTags); err != nil {
+				return err
+			}
+
+			outFormat, err := parseOutputFormat(seqFormat, lineWidth)
+			if err != nil {
+				return err
+			}
+
+			summary, err := runDerep(input, outFile, qualityMetric, minPhred, qualityCombiner, minSize, sizeIn, parsedHeaderMetrics, compLevel, outFormat)
+			if err != nil {
+				return err
+			}
+			summary.Write(os.Stderr)
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringArrayVarP(&inFiles, "in", "i", []string{"-"}, "Input FASTQ file; may be repeated, or files may be given as arguments (default: stdin)")
+	flags.BoolVar(&tagSource, "tag-source", false, "Add the name of the input file to headers (file=<basename>)")
+	flags.StringVar(&keepTags, "keep-tags", "", "SAM/BAM input: comma-separated tags to keep in headers (e.g., 'RG,BC'; 'all' for all tags)")
+	flags.StringVar(&duplicates, "duplicates", "ignore", "Check for sequence IDs occurring more than once in the input (ignore, warn, error)")
+	flags.StringVarP(&outFile, "out", "o", "-", "Output FASTQ file (default: stdout)")
+	flags.StringVar(&seqFormat, "out-format", "", "Output sequence format (fasta, fastq; default: fastq)")
+	flags.IntVar(&lineWidth, "line-width", 0, "Line width of FASTA sequences (0 = no wrapping)")
+	flags.StringVarP(&metric, "metric", "s", "avgphred", "Quality metric used to choose the representative (avgphred, maxee, meep, lqcount, lqpercent)")
+	flags.IntVarP(&minPhred, "minphred", "p", DEFAULT_MIN_PHRED, "Quality threshold for 'lqcount' and 'lqpercent' metrics")
+	flags.StringVarP(&combiner, "quality", "q", "best", "Qualities of the representative (best, min, mean, max)")
+	flags.IntVar(&minSize, "minsize", 1, "Minimum number of reads of a unique sequence to be written")
+	flags.BoolVar(&sizeIn, "sizein", false, "Take abundances from 'size=' annotations of the input headers")
+	flags.StringVarP(&headerMetrics, "header", "H", "", "Comma-separated list of metrics to add to headers after 'size' (e.g., 'maxee,length')")
+	flags.IntVarP(&compLevel, "compress", "c", 1, "Memory compression level (0=disabled, 1-22; default: 1)")
+
+	return cmd
+}
+
+// derepCluster is a unique sequence with its representative and quality accumulators
+type derepCluster struct {
+	Record []byte    // Serialized representative (see recordCodec), replaced by better reads
+	ID     string    // Representative ID (for tie-breaking)
+	Size   int       // Number of reads (or the sum of their abundances with --sizein)
+	Value  float64   // Quality metric of the representative
+	qual   []byte    // Per-position minimum or maximum quality (CombineMin, CombineMax)
+	probs  []float64 // Per-position sum of error probabilities (CombineMean)
+}
+
+// DerepSummary counts the reads processed by `phredsort derep`
+type DerepSummary struct {
+	Reads   int // Reads read
+	Uniques int // Unique sequences
+	Written int // Unique sequences written (with at least --minsize reads)
+}
+
+// Write prints the summary in a human-readable form
+func (s DerepSummary) Write(w io.Writer) {
+	fmt.Fprintf(w, "%s %d reads collapsed into %d unique sequences; %d written\n",
+		bold("Dereplicated:"), s.Reads, s.Uniques, s.Written)
+}
+
+// derepHeaderFormat is the syntax of the annotations added to representatives
+// (VSEARCH-style, e.g., "seq1;size=10;maxee=0.120000")
+var derepHeaderFormat = HeaderFormat{Semicolon: true, Precision: 6}
+
+// runDerep reads FASTQ records, collapses identical sequences, and writes one
+// representative per unique sequence, sorted by size and then by quality
+//
+// Parameters:
+//   - in: Input FASTQ files (use "-" for stdin), read as one
+//   - outFile: Output FASTQ file path (use "-" for stdout)
+//   - metric: Quality metric used to choose representatives and to sort equal sizes
+//   - minPhred: Minimum Phred threshold for lqcount/lqpercent calculations
+//   - combiner: Qualities of the representative (best read or per-position consensus)
+//   - minSize: Minimum size of unique sequences to be written
+//   - sizeIn: Take read abundances from "size=" annotations
+//   - headerMetrics: Optional metrics (of the written qualities) to add after "size"
+//   - compLevel: Compression level of stored representatives (0-22, 0 = disabled)
+//   - outFormat: Sequence format of the output (FASTA or FASTQ, line width)
+//
+// Returns an error if file I/O fails or the input is not FASTQ
+func runDerep(in Input, outFile string, metric QualityMetric, minPhred int, combiner QualityCombiner, minSize int, sizeIn bool, headerMetrics []HeaderMetric, compLevel int, outFormat OutputFormat) (DerepSummary, error) {
+	var summary DerepSummary
+
+	reader, err := NewInputReader(in)
+	if err != nil {
+		return summary, fmt.Errorf("error creating reader: %v", err)
+	}
+	defer reader.Close()
+
+	outfh, err := xopen.Wopen(outFile)
+	if err != nil {
+		return summary, fmt.Errorf("error creating output file: %v", err)
+	}
+	defer outfh.Close()
+
+	// Each cluster keeps only its current representative (ZSTD-compressed when
+	// compLevel > 0), so memory grows with the number of unique sequences.
+	// A ChunkedStorage can't be used here: it is append-only, so every replaced
+	// representative would stay in memory. Records are compressed one by one
+	// either way (as in sort), so the compression ratio is the same
+	codec, err := newRecordCodec(compLevel)
+	if err != nil {
+		return summary, err
+	}
+	defer codec.Close()
+	clusters := make([]derepCluster, 0, 10000)
+	index := make(map[string]int, 10000)
+
+	for chunk := range reader.ChunkChan(100, 1000) {
+		if chunk.Err != nil {
+			return summary, fmt.Errorf("error reading chunk: %v", chunk.Err)
+		}
+
+		for _, record := range chunk.Data {
+			if len(record.Seq.Qual) == 0 && len(record.Seq.Seq) > 0 {
+				return summary, errors.New(computedQualityFastqError)
+			}
+			summary.Reads++
+
+			size := 1
+			if sizeIn {
+				if s, found, err := parseHeaderFields(string(record.Name)).Int("size"); found && err == nil && s > 0 {
+					size = s
+				}
+			}
+			value := calculateQuality(record, metric, minPhred)
+			id := recordID(record)
+
+			key := string(bytes.ToUpper(record.Seq.Seq))
+			ci, seen := index[key]
+			if !seen {
+				index[key] = len(clusters)
+				clusters = append(clusters, derepCluster{Record: bytes.Clone(codec.Encode(record)), ID: id, Value: value})
+				ci = len(clusters) - 1
+			} else if qualityLess(value, clusters[ci].Value, "", "", false, metric) {
+				// Strictly better read (ties keep the first one); the previous
+				// representative is overwritten (or released if it is shorter)
+				c := &clusters[ci]
+				c.Record = append(c.Record[:0], codec.Encode(record)...)
+				c.ID, c.Value = id, value
+			}
+
+			c := &clusters[ci]
+			c.Size += size
+			combineQualities(c, record.Seq.Qual, size, combiner, !seen)
+		}
+	}
+	summary.Uniques = len(clusters)
+
+	// Consensus qualities change the quality metric of representatives
+	if combiner != CombineBest {
+		for i := range clusters {
+			qual := consensusQualities(&clusters[i], combiner)
+			clusters[i].Value = qualityCalculators[metric](qual, minPhred)
+		}
+	}
+
+	// Largest clusters first, then by quality, then by ID
+	sort.Slice(clusters, func(i, j int) bool {
+		a, b := &clusters[i], &clusters[j]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return qualityLess(a.Value, b.Value, a.ID, b.ID, false, metric)
+	})
+
+	for i := range clusters {
+		c := &clusters[i]
+		if c.Size < minSize {
+			continue
+		}
+		record, err := codec.Decode(c.Record)
+		if err != nil {
+			return summary, err
+		}
+		if combiner != CombineBest {
+			record.Seq.Qual = consensusQualities(c, combiner)
+		}
+
+		annotations := []HeaderAnnotation{{"size", strconv.Itoa(c.Size)}}
+		for _, hm := range headerMetrics {
+			if hm.IsLength {
+				annotations = append(annotations, HeaderAnnotation{hm.Name, strconv.Itoa(len(record.Seq.Seq))})
+			} else {
+				annotations = append(annotations, HeaderAnnotation{hm.Name, derepHeaderFormat.FormatValue(headerMetricValue(record, hm.Name, minPhred))})
+			}
+		}
+		// Annotations go to the ID (e.g., "seq1;size=10 description"), where VSEARCH expects them
+		id, desc, hasDesc := bytes.Cut(record.Name, []byte(" "))
+		name, err := derepHeaderFormat.Annotate(append([]byte(nil), id...), annotations)
+		if err != nil {
+			return summary, err
+		}
+		if hasDesc {
+			name = append(append(name, ' '), desc...)
+		}
+		record.Name = name
+
+		if err := outFormat.WriteRecord(outfh, record, reader.IsFastq); err != nil {
+			return summary, err
+		}
+		summary.Written++
+	}
+
+	return summary, nil
+}
+
+// combineQualities adds the qualities of a read (with the given abundance)
+// to the per-position accumulators of a cluster
+func combineQualities(c *derepCluster, qual []byte, size int, combiner QualityCombiner, first bool) {
+	switch combiner {
+	case CombineMin, CombineMax:
+		if first {
+			c.qual = append([]byte(nil), qual...)
+			return
+		}
+		for i, q := range qual {
+			if (combiner == CombineMin) == (q < c.qual[i]) {
+				c.qual[i] = q
+			}
+		}
+	case CombineMean:
+		if first {
+			c.probs = make([]float64, len(qual))
+		}
+		for i, q := range qual {
+			c.probs[i] += errorProbs[q] * float64(size)
+		}
+	}
+}
+
+// consensusQualities returns the per-position consensus qualities of a cluster
+func consensusQualities(c *derepCluster, combiner QualityCombiner) []byte {
+	if combiner != CombineMean {
+		return c.qual
+	}
+
+	// Mean error probability, converted back to the Phred scale
+	qual := make([]byte, len(c.probs))
+	for i, p := range c.probs {
+		q := math.Round(-10 * math.Log10(p/float64(c.Size)))
+		qual[i] = byte(math.Min(q, 126-PHRED_OFFSET)) + PHRED_OFFSET
+	}
+	return qual
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func writeDerepInput(t *testing.T, path string) {
+	t.Helper()
+	writeFastqRecords(t, path, []*fastx.Record{
+		createTestRecord("s1", "ACGT", "5555"),      // Q20
+		createTestRecord("s2 desc", "ACGT", "IIII"), // Q40, best
+		createTestRecord("s3", "acgt", "????"),      // Q30, same sequence (case-insensitive)
+		createTestRecord("s4", "GG", "II"),
+		createTestRecord("s5;size=5;", "TT", "##"),
+		createTestRecord("s6", "GG", "++"),
+	})
+}
+
+func TestRunDerep(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeDerepInput(t, inputPath)
+
+	tests := []struct {
+		name     string
+		combiner QualityCombiner
+		minSize  int
+		sizeIn   bool
+		want     string
+	}{
+		{
+			name:     "Best read",
+			combiner: CombineBest,
+			minSize:  1,
+			want:     "@s2;size=3 desc\nACGT\n+\nIIII\n@s4;size=2\nGG\n+\nII\n@s5;size=1;\nTT\n+\n##\n",
+		},
+		{
+			name:     "Per-position minimum, with --minsize",
+			combiner: CombineMin,
+			minSize:  2,
+			want:     "@s2;size=3 desc\nACGT\n+\n5555\n@s4;size=2\nGG\n+\n++\n",
+		},
+		{
+			name:     "Per-position maximum",
+			combiner: CombineMax,
+			minSize:  3,
+			want:     "@s2;size=3 desc\nACGT\n+\nIIII\n",
+		},
+		{
+			// mean(1e-2, 1e-4, 1e-3) = 0.0037 -> Q24
+			name:     "Mean error probability",
+			combiner: CombineMean,
+			minSize:  3,
+			want:     "@s2;size=3 desc\nACGT\n+\n9999\n",
+		},
+		{
+			name:     "Abundances from headers",
+			combiner: CombineBest,
+			minSize:  1,
+			sizeIn:   true,
+			want:     "@s5;size=5;\nTT\n+\n##\n@s2;size=3 desc\nACGT\n+\nIIII\n@s4;size=2\nGG\n+\nII\n",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, compLevel := range []int{0, 1} {
+			t.Run(tt.name, func(t *testing.T) {
+				outputPath := filepath.Join(tmpDir, "output.fastq")
+				summary, err := runDerep(testInput(inputPath), outputPath, AvgPhred, DEFAULT_MIN_PHRED, tt.combiner, tt.minSize, tt.sizeIn, nil, compLevel, OutputFormat{})
+				if err != nil {
+					t.Fatalf("runDerep() error = %v", err)
+				}
+				if summary.Reads != 6 || summary.Uniques != 3 {
+					t.Errorf("summary = %+v, want 6 reads and 3 unique sequences", summary)
+				}
+
+				got, err := os.ReadFile(outputPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.want {
+					t.Errorf("compLevel %d: output = %q, want %q", compLevel, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestRunDerepOutputForHeadersort(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	derepPath := filepath.Join(tmpDir, "derep.fastq")
+	writeDerepInput(t, inputPath)
+
+	headerMetrics, _ := parseHeaderMetrics("maxee")
+	if _, err := runDerep(testInput(inputPath), derepPath, MaxEE, DEFAULT_MIN_PHRED, CombineBest, 1, false, headerMetrics, 1, OutputFormat{}); err != nil {
+		t.Fatalf("runDerep() error = %v", err)
+	}
+
+	derep, err := os.ReadFile(derepPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(derep), "@s2;size=3;maxee=0.000400 desc\n") {
+		t.Errorf("unexpected output:\n%s", derep)
+	}
+
+	// Re-sort by maxee with headersort
+	sortedPath := filepath.Join(tmpDir, "sorted.fastq")
+	err = runPresort(testInput(derepPath), sortedPath, metricSortKey(MaxEE, nil), false, 0, -math.MaxFloat64, math.MaxFloat64, MissingError, "", DEFAULT_MIN_PHRED, OutputOptions{})
+	if err != nil {
+		t.Fatalf("runPresort() error = %v", err)
+	}
+	want := []string{"s4;size=2;maxee=0.000200", "s2;size=3;maxee=0.000400", "s5;size=1;maxee=1.261915"}
+	if got := readFastxIDs(t, sortedPath); !reflect.DeepEqual(got, want) {
+		t.Errorf("headersort order = %v", got)
+	}
+}
@@ -3,32 +3,182 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
+	"io"
 	"math"
-	"regexp"
+	"os"
 	"sort"
-	"strconv"
-	"strings"
 
 	"github.com/shenwei356/bio/seqio/fastx"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
 )
 
-// Regular expressions for header parsing
-var (
-	spaceMetricRe = regexp.MustCompile(`\s+(\w+)=(\d+\.?\d*)`)
-	semiMetricRe  = regexp.MustCompile(`;(\w+)=(\d+\.?\d*)`)
-	sizeRe        = regexp.MustCompile(`(?:\s|;)size=(\d+)`)
+// HeaderKeyType defines how header values used as a sort key are compared
+type HeaderKeyType int
+
+const (
+	KeyFloat   HeaderKeyType = iota // Floating-point numbers (e.g., maxee=0.5, score=-3.2)
+	KeyInt                          // Integers (e.g., abundance=120)
+	KeyNatural                      // Strings in natural order (e.g., sample2 < sample10)
+	KeyString                       // Strings in byte-wise order
+)
+
+// String returns the string representation of a HeaderKeyType
+func (t HeaderKeyType) String() string {
+	switch t {
+	case KeyFloat:
+		return "float"
+	case KeyInt:
+		return "int"
+	case KeyNatural:
+		return "natural"
+	case KeyString:
+		return "string"
+	default:
+		return "unknown"
+	}
+}
+
+// IsNumeric reports whether values of this type can be used with --minqual/--maxqual
+func (t HeaderKeyType) IsNumeric() bool {
+	return t == KeyFloat || t == KeyInt
+}
+
+// parseHeaderKeyType parses the value of the --key-type flag
+func parseHeaderKeyType(s string) (HeaderKeyType, error) {
+	switch s {
+	case "float":
+		return KeyFloat, nil
+	case "int":
+		return KeyInt, nil
+	case "natural":
+		return KeyNatural, nil
+	case "string":
+		return KeyString, nil
+	default:
+		return KeyFloat, fmt.Errorf("invalid key type: %s (must be 'float', 'int', 'natural' or 'string')", s)
+	}
+}
+
+// HeaderSortKey describes the header field used as a sort key by headersort
+type HeaderSortKey struct {
+	Name          string        // Header key (e.g., "maxee" or "abundance")
+	Type          HeaderKeyType // How values are compared
+	LowerIsBetter bool          // Put lower values first in the default order (e.g., for maxee)
+	IsMetric      bool          // Whether the key holds a built-in quality metric (see Metric)
+	Metric        QualityMetric // Quality metric that can be computed for records missing the key
+	Table         *MetricsTable // External table of values (nil = values are read from headers)
+}
+
+// MissingPolicy defines how headersort treats records without the sort key
+type MissingPolicy int
+
+const (
+	MissingError   MissingPolicy = iota // Abort with an error
+	MissingSkip                         // Drop the record (optionally writing it to a rejects file)
+	MissingFirst                        // Place the record before all records with the key
+	MissingLast                         // Place the record after all records with the key
+	MissingCompute                      // Compute the quality metric from base qualities (FASTQ only)
 )
 
+// String returns the string representation of a MissingPolicy
+func (p MissingPolicy) String() string {
+	switch p {
+	case MissingError:
+		return "error"
+	case MissingSkip:
+		return "skip"
+	case MissingFirst:
+		return "first"
+	case MissingLast:
+		return "last"
+	case MissingCompute:
+		return "compute"
+	default:
+		return "unknown"
+	}
+}
+
+// parseMissingPolicy parses the value of the --missing flag
+func parseMissingPolicy(s string) (MissingPolicy, error) {
+	switch s {
+	case "error":
+		return MissingError, nil
+	case "skip":
+		return MissingSkip, nil
+	case "first":
+		return MissingFirst, nil
+	case "last":
+		return MissingLast, nil
+	case "compute":
+		return MissingCompute, nil
+	default:
+		return MissingError, fmt.Errorf("invalid --missing policy: %s (must be 'error', 'skip', 'first', 'last' or 'compute')", s)
+	}
+}
+
+// metricSortKey returns the sort key for a built-in quality metric
+// (stored under its name, or under an alias from --header-alias)
+func metricSortKey(metric QualityMetric, aliases map[string]string) HeaderSortKey {
+	return HeaderSortKey{
+		Name:          HeaderFormat{Aliases: aliases}.Key(metric.String()),
+		Type:          KeyFloat,
+		LowerIsBetter: metricLowerIsBetter(metric),
+		IsMetric:      true,
+		Metric:        metric,
+	}
+}
+
+// SidecarValue returns the key value of a record for a metrics table
+// (see MetricsWriter.WriteRow), or nil if the record has no such key
+func (k HeaderSortKey) SidecarValue(si HeaderSortIndex) any {
+	switch {
+	case si.Missing:
+		return nil
+	case k.Type == KeyInt:
+		return si.Int
+	case !k.Type.IsNumeric():
+		return si.Text
+	default:
+		return si.Quality
+	}
+}
+
+// Value extracts the sort key from a parsed header (or, with Table, from the
+// table row of the record) into a HeaderSortIndex (Quality for numeric keys,
+// Text for string keys). Returns found = false if the header has no such key,
+// and an error if the value doesn't match the key type
+func (k HeaderSortKey) Value(h ParsedHeader) (si HeaderSortIndex, found bool, err error) {
+	if k.Table != nil {
+		h = k.Table.Lookup(h.ID)
+	}
+
+	switch k.Type {
+	case KeyInt:
+		var v int
+		v, found, err = h.Int(k.Name)
+		si.Int = int64(v)
+		si.Quality = float64(v)
+	case KeyNatural, KeyString:
+		si.Text, found = h.Lookup(k.Name)
+	default:
+		si.Quality, found, err = h.Float(k.Name)
+	}
+	return si, found, err
+}
+
 // HeaderSortIndex is a memory-efficient struct for sorting pre-computed headers.
 // Uses index-based approach to minimize per-record memory overhead.
 type HeaderSortIndex struct {
 	Index   int     // Position in records slice
-	Quality float64 // Parsed quality value from header
+	Quality float64 // Parsed quality value from header (numeric keys)
+	Int     int64   // Parsed integer value from header (exact comparison of int keys)
+	Text    string  // Parsed string value from header (natural and string keys)
 	Size    int     // Parsed size value from header (0 if not present)
 	HasSize bool    // Whether size was present in header
+	Missing bool    // Whether the sort key was missing from header (see MissingFirst/MissingLast)
 }
 
 // HeaderSortIndexList implements sort.Interface for memory-efficient header-based sorting
@@ -36,16 +186,25 @@ type HeaderSortIndexList struct {
 	items     []HeaderSortIndex
 	ids       []string // External reference for tie-breaking (sequence IDs)
 	ascending bool
-	metric    QualityMetric
+	key       HeaderSortKey
+	// Records with a missing key are placed first (true) or last (false)
+	missingFirst bool
 }
 
-// NewHeaderSortIndexList creates a new HeaderSortIndexList
+// NewHeaderSortIndexList creates a new HeaderSortIndexList for a built-in quality metric
 func NewHeaderSortIndexList(items []HeaderSortIndex, ids []string, ascending bool, metric QualityMetric) *HeaderSortIndexList {
+	return NewHeaderKeySortIndexList(items, ids, ascending, metricSortKey(metric, nil), false)
+}
+
+// NewHeaderKeySortIndexList creates a new HeaderSortIndexList for an arbitrary header key.
+// Items with Missing set are placed before (missingFirst) or after all other items
+func NewHeaderKeySortIndexList(items []HeaderSortIndex, ids []string, ascending bool, key HeaderSortKey, missingFirst bool) *HeaderSortIndexList {
 	return &HeaderSortIndexList{
-		items:     items,
-		ids:       ids,
-		ascending: ascending,
-		metric:    metric,
+		items:        items,
+		ids:          ids,
+		ascending:    ascending,
+		key:          key,
+		missingFirst: missingFirst,
 	}
 }
 
@@ -54,24 +213,48 @@ func (list *HeaderSortIndexList) Swap(i, j int) {
 	list.items[i], list.items[j] = list.items[j], list.items[i]
 }
 
+// Less orders records by the key value (descending by default, or ascending
+// with LowerIsBetter; the ascending flag flips the order), then by sequence ID
 func (list *HeaderSortIndexList) Less(i, j int) bool {
-	qi, qj := list.items[i].Quality, list.items[j].Quality
-	idI := list.ids[list.items[i].Index]
-	idJ := list.ids[list.items[j].Index]
-
-	// Primary sort by quality
-	if qi != qj {
-		if metricLowerIsBetter(list.metric) {
-			if list.ascending {
-				return qi > qj
+	a, b := &list.items[i], &list.items[j]
+	return list.lessItems(a, b, list.ids[a.Index], list.ids[b.Index])
+}
+
+// lessItems compares two items with the given sequence IDs (see Less)
+func (list *HeaderSortIndexList) lessItems(a, b *HeaderSortIndex, idI, idJ string) bool {
+
+	// Records without the key go to one end, ordered by ID
+	if a.Missing || b.Missing {
+		if a.Missing != b.Missing {
+			return a.Missing == list.missingFirst
+		}
+		return naturalNameLess(idI, idJ)
+	}
+
+	// Primary sort by the key value
+	var order int
+	switch list.key.Type {
+	case KeyInt:
+		order = cmp.Compare(a.Int, b.Int)
+	case KeyNatural:
+		if a.Text != b.Text {
+			order = 1
+			if naturalNameLess(a.Text, b.Text) {
+				order = -1
 			}
-			return qi < qj
 		}
+	case KeyString:
+		order = cmp.Compare(a.Text, b.Text)
+	default:
+		order = cmp.Compare(a.Quality, b.Quality)
+	}
 
-		if list.ascending {
-			return qi < qj
+	if order != 0 {
+		lowerFirst := list.key.LowerIsBetter != list.ascending
+		if lowerFirst {
+			return order < 0
 		}
-		return qi > qj
+		return order > 0
 	}
 
 	return naturalNameLess(idI, idJ)
@@ -94,60 +277,21 @@ type PreSortRecord struct {
 	HasQual bool
 }
 
-// parseHeaderInfo extracts quality metric, size, and ID from a record header.
-// Returns the parsed values for use with index-based sorting.
+// parseHeaderInfo extracts quality metric (stored under the given key), size, and ID
+// from a record header. Returns the parsed values for use with index-based sorting.
 // This is a more efficient version that doesn't allocate a full PreSortRecord.
-func parseHeaderInfo(header string, metric QualityMetric) (id string, quality float64, size int, hasQual bool, hasSize bool) {
-	parts := strings.SplitN(header, " ", 2)
-	id = parts[0]
-	if strings.HasPrefix(id, ">") || strings.HasPrefix(id, "@") {
-		id = id[1:]
-	}
-
-	// Try to find size annotation
-	if sizeMatch := sizeRe.FindStringSubmatch(header); sizeMatch != nil {
-		if s, err := strconv.Atoi(sizeMatch[1]); err == nil {
-			size = s
-			hasSize = true
-		}
-	}
-
-	// Look for quality metric in both formats
-	metricStr := metric.String()
-	var qualityStr string
-	found := false
-
-	// Check space-separated format
-	if matches := spaceMetricRe.FindAllStringSubmatch(header, -1); matches != nil {
-		for _, match := range matches {
-			if match[1] == metricStr {
-				qualityStr = match[2]
-				found = true
-				break
-			}
-		}
-	}
-
-	// Check semicolon-separated format if not found
-	if !found {
-		if matches := semiMetricRe.FindAllStringSubmatch(header, -1); matches != nil {
-			for _, match := range matches {
-				if match[1] == metricStr {
-					qualityStr = match[2]
-					found = true
-					break
-				}
-			}
-		}
-	}
-
-	if found {
-		if q, err := strconv.ParseFloat(qualityStr, 64); err == nil {
-			quality = q
-			hasQual = true
-		}
+// Returns an error naming the record if the metric value is not a valid number
+// (a malformed size annotation is ignored)
+func parseHeaderInfo(header string, key string) (id string, quality float64, size int, hasQual bool, hasSize bool, err error) {
+	parsed := parseHeaderFields(header)
+	id = parsed.ID
+
+	if s, found, sizeErr := parsed.Int("size"); found && sizeErr == nil {
+		size = s
+		hasSize = true
 	}
 
+	quality, hasQual, err = parsed.Float(key)
 	return
 }
 
@@ -157,14 +301,17 @@ func parseHeaderInfo(header string, metric QualityMetric) (id string, quality fl
 // The function looks for metric annotations in the format "metric=value" (e.g., "maxee=2.5")
 // and size annotations as "size=value" (e.g., "size=100")
 //
-// Returns a PreSortRecord with parsed information, or an error if the required
-// metric is missing from the header
+// Returns a PreSortRecord with parsed information (HasQual is false if the required
+// metric is missing from the header), or an error if the metric value is malformed
 //
 // Note: This function is kept for backward compatibility with tests.
 // The new index-based sorting uses parseHeaderInfo instead.
 func parsePreSortRecord(record *fastx.Record, metric QualityMetric) (*PreSortRecord, error) {
 	header := string(record.Name)
-	id, quality, size, hasQual, hasSize := parseHeaderInfo(header, metric)
+	id, quality, size, hasQual, hasSize, err := parseHeaderInfo(header, metric.String())
+	if err != nil {
+		return nil, err
+	}
 
 	return &PreSortRecord{
 		ID:      id,
@@ -188,12 +335,31 @@ func parsePreSortRecord(record *fastx.Record, metric QualityMetric) (*PreSortRec
 // Equal metric values are tie-broken by sequence ID using natural ordering
 func HeaderSortCommand() *cobra.Command {
 	var (
-		inFile        string
+		inFiles       []string
+		tagSource     bool
+		keepTags      string
+		duplicates    string
 		outFile       string
+		seqFormat     string
+		lineWidth     int
 		metric        string
 		ascending     bool
 		minQualFilter float64
 		maxQualFilter float64
+		headerAliases string
+		keyName       string
+		keyType       string
+		missing       string
+		rejectsFile   string
+		minPhred      int
+		compLevel     int
+		within        string
+		groupOrder    string
+		metricsFile   string
+		metricsFormat string
+		metricsFrom   string
+		keyColumn     string
+		idColumn      string
 	)
 
 	cmd := &cobra.Command{
@@ -202,51 +368,194 @@ func HeaderSortCommand() *cobra.Command {
 		Long: `Sort sequences using pre-computed quality scores stored in sequence headers.
 Supports both FASTA and FASTQ formats with space-separated (">seq1 maxee=2") or 
 semicolon-separated (">seq1;maxee=2") quality annotations. Equal metric values
-are tie-broken by sequence ID using natural ordering.`,
+are tie-broken by sequence ID using natural ordering.
+
+With --key, any header field (e.g., "abundance=", "score=" or "sample=") can be
+used instead of a quality metric. Values are compared according to --key-type
+and sorted in descending order (use --ascending to reverse).
+
+With --within (a header key such as "sample", or a regular expression), records
+are sorted within groups, and groups are written one after another.
+
+With --metrics-from, values are taken from a table (TSV with a header line, or
+JSON Lines, e.g. written with --metrics-out) joined to the records by sequence ID.
+
+Records without the sort key abort the run by default; see --missing for
+other options (skip, first, last, compute).`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Validate metric flag
-			qualityMetric, err := validateMetric(metric)
+			if compLevel < 0 || compLevel > 22 {
+				return fmt.Errorf("compression level must be between 0 and 22")
+			}
+
+			missingPolicy, err := parseMissingPolicy(missing)
 			if err != nil {
 				return err
 			}
+			if rejectsFile != "" && missingPolicy != MissingSkip {
+				return fmt.Errorf("--rejects requires --missing skip")
+			}
+			if metricsFrom == "" && (keyColumn != "" || cmd.Flags().Changed("id-column")) {
+				return fmt.Errorf("--key-column and --id-column require --metrics-from")
+			}
+			if metricsFrom != "" && keyName != "" {
+				return fmt.Errorf("--key and --metrics-from can't be used together (use --key-column to select the table column)")
+			}
+			if metricsFrom != "" && keyColumn != "" {
+				// A table column named after a quality metric is sorted like that metric
+				if qualityMetric, err := validateMetric(keyColumn); err == nil && keyColumn == qualityMetric.String() && keyType == "float" {
+					metric = keyColumn
+				} else {
+					keyName = keyColumn
+				}
+			}
+			if missingPolicy == MissingCompute && keyName != "" {
+				return fmt.Errorf("--missing compute is only available for quality metrics (not with --key)")
+			}
+
+			var key HeaderSortKey
+			if keyName != "" {
+				// Table columns may have any name
+				if metricsFrom == "" && !isHeaderKey(keyName) {
+					return fmt.Errorf("invalid header key: %s (only letters, digits and '_' are allowed)", keyName)
+				}
+				parsedType, err := parseHeaderKeyType(keyType)
+				if err != nil {
+					return err
+				}
+				if !parsedType.IsNumeric() && (cmd.Flags().Changed("minqual") || cmd.Flags().Changed("maxqual")) {
+					return fmt.Errorf("--minqual/--maxqual require a numeric key type (float or int)")
+				}
+				key = HeaderSortKey{Name: keyName, Type: parsedType}
+			} else {
+				// Validate metric flag
+				qualityMetric, err := validateMetric(metric)
+				if err != nil {
+					return err
+				}
+
+				aliases, err := parseHeaderAliases(headerAliases)
+				if err != nil {
+					return err
+				}
+				key = metricSortKey(qualityMetric, aliases)
+			}
+
+			if metricsFrom != "" {
+				key.Table, err = ReadMetricsTable(metricsFrom, idColumn, key.Name)
+				if err != nil {
+					return err
+				}
+			}
 
-			return runPresort(inFile, outFile, qualityMetric, ascending, minQualFilter, maxQualFilter)
+			var groups *Grouping
+			if within != "" {
+				order, err := parseGroupOrder(groupOrder)
+				if err != nil {
+					return err
+				}
+				if order == GroupOrderGlobal {
+					return fmt.Errorf("--group-order must be 'natural' or 'size'")
+				}
+				if groups, err = parseGrouping(within, 0, order); err != nil {
+					return err
+				}
+			}
+
+			var metricsOut *MetricsWriter
+			if metricsFile != "" {
+				metricsOut, err = NewMetricsWriter(metricsFile, metricsFormat, []string{key.Name, "length"})
+				if err != nil {
+					return err
+				}
+			}
+
+			input, err := parseInput(cmd, inFiles, args, tagSource, duplicates)
+			if err != nil {
+				return err
+			}
+			if input.KeepTags, err = parseTagFilter(keepTags); err != nil {
+				return err
+			}
+
+			outFormat, err := parseOutputFormat(seqFormat, lineWidth)
+			if err != nil {
+				return err
+			}
+
+			err = runPresort(input, outFile, key, ascending, compLevel, minQualFilter, maxQualFilter, missingPolicy, rejectsFile, minPhred, OutputOptions{MetricsOut: metricsOut, Groups: groups, Format: outFormat})
+			if metricsOut != nil {
+				if closeErr := metricsOut.Close(); err == nil {
+					err = closeErr
+				}
+			}
+			if err == nil && groups != nil {
+				groups.Summary.Write(os.Stderr)
+				groups.Summary.WriteCounts(os.Stderr)
+			}
+			return err
 		},
 	}
 
 	// Define flags
 	flags := cmd.Flags()
-	flags.StringVarP(&inFile, "in", "i", "-", "Input sequence file (default: stdin)")
+	flags.StringArrayVarP(&inFiles, "in", "i", []string{"-"}, "Input sequence file; may be repeated, or files may be given as arguments (default: stdin)")
+	flags.BoolVar(&tagSource, "tag-source", false, "Add the name of the input file to headers (file=<basename>)")
+	flags.StringVar(&keepTags, "keep-tags", "", "SAM/BAM input: comma-separated tags to keep in headers (e.g., 'RG,BC'; 'all' for all tags)")
+	flags.StringVar(&duplicates, "duplicates", "ignore", "Check for sequence IDs occurring more than once in the input (ignore, warn, error)")
 	flags.StringVarP(&outFile, "out", "o", "-", "Output sequence file (default: stdout)")
+	flags.StringVar(&seqFormat, "out-format", "", "Output sequence format (fasta, fastq; default: same as input)")
+	flags.IntVar(&lineWidth, "line-width", 0, "Line width of FASTA sequences (0 = no wrapping)")
 	flags.StringVarP(&metric, "metric", "s", "avgphred", "Quality metric to use from headers")
 	flags.BoolVarP(&ascending, "ascending", "a", false, "Sort in ascending order")
 	flags.Float64VarP(&minQualFilter, "minqual", "m", -math.MaxFloat64, "Minimum quality threshold")
 	flags.Float64VarP(&maxQualFilter, "maxqual", "M", math.MaxFloat64, "Maximum quality threshold")
+	flags.StringVar(&headerAliases, "header-alias", "", "Comma-separated metric=key aliases used in headers (e.g., 'maxee=ee')")
+	flags.StringVarP(&keyName, "key", "k", "", "Sort by an arbitrary header field instead of a quality metric (e.g., 'abundance')")
+	flags.StringVar(&keyType, "key-type", "float", "Type of --key values (float, int, natural, string)")
+	flags.IntVarP(&compLevel, "compress", "c", 1, "Memory compression level (0=disabled, 1-22; default: 1)")
+	flags.StringVar(&missing, "missing", "error", "What to do with records missing the sort key (error, skip, first, last, compute)")
+	flags.StringVar(&rejectsFile, "rejects", "", "Write records skipped with '--missing skip' to this file")
+	flags.IntVarP(&minPhred, "minphred", "p", DEFAULT_MIN_PHRED, "Quality threshold for 'lqcount' and 'lqpercent' metrics (with '--missing compute')")
+	flags.StringVar(&within, "within", "", "Sort records within groups (header key or regular expression, e.g., 'sample'); groups are written one after another")
+	flags.StringVar(&groupOrder, "group-order", "natural", "Order of groups with --within ('natural' or 'size')")
+	flags.StringVar(&metricsFrom, "metrics-from", "", "Take sort key values from this table (TSV or JSON Lines) instead of headers")
+	flags.StringVar(&keyColumn, "key-column", "", "Column of the --metrics-from table to sort by (default: the --metric name)")
+	flags.StringVar(&idColumn, "id-column", "id", "Column of the --metrics-from table with sequence IDs")
+	flags.StringVar(&metricsFile, "metrics-out", "", "Write the sort key value and length of each output record to this table")
+	flags.StringVar(&metricsFormat, "metrics-format", "tsv", "Format of the --metrics-out table (tsv, jsonl)")
 
 	return cmd
 }
 
-// runPresort reads FASTQ/FASTA records, extracts quality metrics from headers,
-// filters records based on quality thresholds, sorts them, and writes the
-// sorted output. This function requires that quality metrics are already present
+// runPresort reads FASTQ/FASTA records, extracts quality metrics (or other sort keys)
+// from headers, filters records based on quality thresholds, sorts them, and writes the
+// sorted output. This function requires that the sort key is already present
 // in sequence headers
 //
 // Memory optimization: Uses index-based sorting with slices instead of storing
-// full PreSortRecord structs. Records are stored in a slice and referenced by
-// integer indices during sorting.
+// full PreSortRecord structs. Records are kept in a RecordStore (ZSTD-compressed
+// when compLevel > 0) and referenced by integer indices during sorting.
 //
 // Parameters:
-//   - inFile: Input sequence file path
+//   - in: Input sequence files (use "-" for stdin), read as one
 //   - outFile: Output sequence file path
-//   - metric: Quality metric to extract from headers and use for sorting
+//   - key: Header field to extract and use for sorting (see metricSortKey for quality metrics)
 //   - ascending: If true, sort in ascending order; if false, sort in descending order
-//   - minQual: Minimum quality threshold for filtering
-//   - maxQual: Maximum quality threshold for filtering
+//   - compLevel: Compression level of stored records (0-22, 0 = disabled)
+//   - minQual: Minimum quality threshold for filtering (numeric keys only)
+//   - maxQual: Maximum quality threshold for filtering (numeric keys only)
+//   - missing: What to do with records missing the key (see MissingPolicy)
+//   - rejectsFile: Output file for records dropped with MissingSkip ("" = discard)
+//   - minPhred: Minimum Phred threshold for lqcount/lqpercent (with MissingCompute)
+//   - opts: Optional table of key values and lengths of output records (opts.MetricsOut),
+//     grouping (opts.Groups, records are sorted within groups) and the sequence format
 //
-// Returns an error if file I/O fails or if a record is missing the required metric
-func runPresort(inFile, outFile string, metric QualityMetric, ascending bool, minQual, maxQual float64) error {
+// A summary of records missing the key is printed to stderr.
+// Returns an error if file I/O fails, if a record is missing the required key
+// (with MissingError) or has a value that doesn't match the key type
+func runPresort(in Input, outFile string, key HeaderSortKey, ascending bool, compLevel int, minQual, maxQual float64, missing MissingPolicy, rejectsFile string, minPhred int, opts OutputOptions) error {
 	// Create reader with automatic format detection
-	reader, err := fastx.NewDefaultReader(inFile)
+	reader, err := NewInputReader(in)
 	if err != nil {
 		return fmt.Errorf("error creating reader: %v", err)
 	}
@@ -259,16 +568,30 @@ func runPresort(inFile, outFile string, metric QualityMetric, ascending bool, mi
 	}
 	defer outfh.Close()
 
+	var rejectsfh *xopen.Writer
+	if rejectsFile != "" {
+		rejectsfh, err = xopen.Wopen(rejectsFile)
+		if err != nil {
+			return fmt.Errorf("error creating rejects file: %v", err)
+		}
+		defer rejectsfh.Close()
+	}
+	summary := MissingSummary{Key: key.Name, Policy: missing}
+
 	// Memory-efficient storage using slices and index-based sorting
-	records := make([]*fastx.Record, 0, 10000)
+	records, err := newRecordStore(compLevel)
+	if err != nil {
+		return err
+	}
+	defer records.Close()
 	ids := make([]string, 0, 10000)
+	var groupNames []string // Group of each stored record (with groups only)
 	sortIndices := make([]HeaderSortIndex, 0, 10000)
 
 	// Use ChunkChan for asynchronous reading with reasonable buffer sizes
 	bufferSize := 100 // Number of chunks to buffer
 	chunkSize := 1000 // Records per chunk
 
-	var idx int
 	for chunk := range reader.ChunkChan(bufferSize, chunkSize) {
 		if chunk.Err != nil {
 			return fmt.Errorf("error reading chunk: %v", chunk.Err)
@@ -276,36 +599,113 @@ func runPresort(inFile, outFile string, metric QualityMetric, ascending bool, mi
 
 		for _, record := range chunk.Data {
 			header := string(record.Name)
-			id, quality, size, hasQual, hasSize := parseHeaderInfo(header, metric)
+			parsed := parseHeaderFields(header)
+			si, found, err := key.Value(parsed)
+			if err != nil {
+				return err
+			}
 
-			if !hasQual {
-				return fmt.Errorf("record missing required quality metric (%s): %s", metric, header)
+			summary.Total++
+			if !found {
+				summary.Missing++
+				switch missing {
+				case MissingSkip:
+					if rejectsfh != nil {
+						if err := opts.Format.WriteRecord(rejectsfh, record, reader.IsFastq); err != nil {
+							return err
+						}
+					}
+					continue
+				case MissingFirst, MissingLast:
+					si.Missing = true
+				case MissingCompute:
+					if len(record.Seq.Qual) == 0 && len(record.Seq.Seq) > 0 {
+						return fmt.Errorf("cannot compute %s for record %s: no quality scores (FASTQ input is required)", key.Metric, parsed.ID)
+					}
+					si.Quality = calculateQuality(record, key.Metric, minPhred)
+				default:
+					if key.Table != nil {
+						return fmt.Errorf("record %s has no '%s' value in metrics table %s (see --missing)", parsed.ID, key.Name, key.Table.Path)
+					}
+					return fmt.Errorf("record missing required quality metric (%s): %s", key.Name, header)
+				}
 			}
 
-			// Apply quality filters
-			if quality >= minQual && quality <= maxQual {
-				// Store record and add to sort indices
-				records = append(records, record) // ChunkChan already provides copies
-				ids = append(ids, id)
-				sortIndices = append(sortIndices, HeaderSortIndex{
-					Index:   idx,
-					Quality: quality,
-					Size:    size,
-					HasSize: hasSize,
-				})
-				idx++
+			// Apply quality filters (string keys and records without a value are never filtered)
+			if !key.Type.IsNumeric() || si.Missing || (si.Quality >= minQual && si.Quality <= maxQual) {
+				if size, hasSize, err := parsed.Int("size"); hasSize && err == nil {
+					si.Size = size
+					si.HasSize = true
+				}
+
+				// Store record and add to sort indices (ChunkChan already provides copies)
+				if si.Index, err = records.Append(record); err != nil {
+					return err
+				}
+				ids = append(ids, parsed.ID)
+				if opts.Groups != nil {
+					groupNames = append(groupNames, opts.Groups.GroupOf(header))
+				}
+				sortIndices = append(sortIndices, si)
+			} else {
+				summary.Filtered++
 			}
 		}
 	}
 
 	// Sort using index-based sorting
-	sortList := NewHeaderSortIndexList(sortIndices, ids, ascending, metric)
+	sortList := NewHeaderKeySortIndexList(sortIndices, ids, ascending, key, missing == MissingFirst)
 	sort.Sort(sortList)
+	items := sortList.Items()
+	if opts.Groups != nil {
+		items = groupRecords(opts.Groups, items, func(si HeaderSortIndex) string { return groupNames[si.Index] })
+	}
 
 	// Write sorted records using indices
-	for _, si := range sortList.Items() {
-		records[si.Index].FormatToWriter(outfh, 0)
+	for _, si := range items {
+		record, err := records.Get(si.Index)
+		if err != nil {
+			return err
+		}
+		if opts.MetricsOut != nil {
+			if err := opts.MetricsOut.WriteRow(ids[si.Index], key.SidecarValue(si), len(record.Seq.Seq)); err != nil {
+				return err
+			}
+		}
+		if err := opts.Format.WriteRecord(outfh, record, reader.IsFastq); err != nil {
+			return err
+		}
+	}
+
+	if summary.Missing > 0 {
+		summary.Write(os.Stderr)
 	}
 
 	return nil
 }
+
+// MissingSummary counts records processed by headersort that lack the sort key
+type MissingSummary struct {
+	Key      string
+	Policy   MissingPolicy
+	Total    int // Records read
+	Missing  int // Records without the key
+	Filtered int // Records removed by --minqual/--maxqual
+}
+
+// Write prints the summary in a human-readable form
+func (s MissingSummary) Write(w io.Writer) {
+	var action string
+	switch s.Policy {
+	case MissingSkip:
+		action = "skipped"
+	case MissingFirst:
+		action = "placed first"
+	case MissingLast:
+		action = "placed last"
+	case MissingCompute:
+		action = "computed from base qualities"
+	}
+	fmt.Fprintf(w, "%s %d of %d records without '%s' (%s); %d records removed by quality filters\n",
+		bold("Missing sort key:"), s.Missing, s.Total, s.Key, action, s.Filtered)
+}
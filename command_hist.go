@@ -0,0 +1,95 @@
+// Subcommand (`phredsort hist`) for drawing the distribution of a quality metric in the terminal
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// HistCommand creates the `hist` subcommand which draws a histogram of the
+// per-read quality metric distribution directly in the terminal
+//
+// The proposed --minqual/--maxqual thresholds are drawn as cut lines, and the
+// fraction of reads and bases that would be retained is reported, which allows
+// for quick interactive threshold picking
+func HistCommand() *cobra.Command {
+	var (
+		inFiles       []string
+		duplicates    string
+		metric        string
+		minPhred      int
+		minQualFilter float64
+		maxQualFilter float64
+		nBins         int
+		width         int
+		logX          bool
+		logY          bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "hist",
+		Short: "Draw a histogram of the quality metric distribution in the terminal",
+		Long: `Draw a histogram of per-read quality metric values directly in the terminal.
+Proposed --minqual/--maxqual thresholds are marked with cut lines, and the
+fraction of reads and bases that would be retained by these filters is reported.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			qualityMetric, err := validateMetric(metric)
+			if err != nil {
+				return err
+			}
+			if nBins < 1 {
+				return fmt.Errorf("number of bins must be a positive integer")
+			}
+			if width < 1 {
+				return fmt.Errorf("histogram width must be a positive integer")
+			}
+
+			input, err := parseInput(cmd, inFiles, args, false, duplicates)
+			if err != nil {
+				return err
+			}
+
+			return runHist(os.Stdout, input, qualityMetric, minPhred, minQualFilter, maxQualFilter, nBins, width, logX, logY)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringArrayVarP(&inFiles, "in", "i", []string{"-"}, "Input FASTQ file; may be repeated, or files may be given as arguments (default: stdin)")
+	flags.StringVar(&duplicates, "duplicates", "ignore", "Check for sequence IDs occurring more than once in the input (ignore, warn, error)")
+	flags.StringVarP(&metric, "metric", "s", "avgphred", "Quality metric (avgphred, maxee, meep, lqcount, lqpercent)")
+	flags.IntVarP(&minPhred, "minphred", "p", DEFAULT_MIN_PHRED, "Quality threshold for 'lqcount' and 'lqpercent' metrics")
+	flags.Float64VarP(&minQualFilter, "minqual", "m", -math.MaxFloat64, "Proposed minimum quality threshold (drawn as a cut line)")
+	flags.Float64VarP(&maxQualFilter, "maxqual", "M", math.MaxFloat64, "Proposed maximum quality threshold (drawn as a cut line)")
+	flags.IntVarP(&nBins, "bins", "b", 20, "Number of histogram bins")
+	flags.IntVarP(&width, "width", "w", 50, "Maximum bar width (in characters)")
+	flags.BoolVar(&logX, "log-x", false, "Use logarithmic scale for metric values")
+	flags.BoolVar(&logY, "log-y", false, "Use logarithmic scale for read counts")
+
+	return cmd
+}
+
+// runHist computes the per-read metric distribution of the input and writes
+// a terminal histogram, a sparkline summary, and retention statistics to w
+//
+// Returns an error if file I/O fails or the input is not FASTQ
+func runHist(w io.Writer, in Input, metric QualityMetric, minPhred int, minQualFilter, maxQualFilter float64, nBins, width int, logX, logY bool) error {
+	observations, err := collectMetricObservations(in, metric, minPhred)
+	if err != nil {
+		return err
+	}
+
+	hist := NewMetricHistogram(observations, nBins, logX)
+	retention := computeRetention(observations, minQualFilter, maxQualFilter)
+
+	fmt.Fprintf(w, "%s %s\n\n", bold(fmt.Sprintf("Distribution of %s (%d reads)", metric, retention.TotalReads)), cyan(hist.Sparkline()))
+	fmt.Fprint(w, hist.Render(width, logY, minQualFilter, maxQualFilter))
+	fmt.Fprintf(w, "\n%s %d / %d (%.2f%%)\n", bold("Reads retained:"), retention.Reads, retention.TotalReads, 100*retention.ReadFraction())
+	fmt.Fprintf(w, "%s %d / %d (%.2f%%)\n", bold("Bases retained:"), retention.Bases, retention.TotalBases, 100*retention.BaseFraction())
+
+	return nil
+}
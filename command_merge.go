@@ -0,0 +1,251 @@
+// Subcommand (`phredsort merge`) for merging files that are already sorted by a header key
+
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// MergeCommand creates the `merge` subcommand which combines files sorted with
+// phredsort (e.g., per-lane files sorted in parallel) into one sorted file
+func MergeCommand() *cobra.Command {
+	var (
+		inFiles       []string
+		tagSource     bool
+		keepTags      string
+		duplicates    string
+		outFile       string
+		seqFormat     string
+		lineWidth     int
+		metric        string
+		ascending     bool
+		headerAliases string
+		keyName       string
+		keyType       string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "merge [flags] file1 file2 ...",
+		Short: "Merge files already sorted by a header key into one sorted file",
+		Long: `Merge FASTA/FASTQ files that are already sorted by a quality metric (or another
+header key) stored in sequence headers, e.g. by "phredsort --header" or headersort.
+Records are compared exactly like in headersort (by the key value, then by sequence ID
+in natural order), and only one record per input file is kept in memory.
+The run is aborted if an input file turns out not to be sorted.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(inFiles) == 0 && len(args) == 0 {
+				return fmt.Errorf("at least one input file is required")
+			}
+			input, err := parseInput(cmd, inFiles, args, tagSource, duplicates)
+			if err != nil {
+				return err
+			}
+			if input.KeepTags, err = parseTagFilter(keepTags); err != nil {
+				return err
+			}
+
+			var key HeaderSortKey
+			if keyName != "" {
+				if !isHeaderKey(keyName) {
+					return fmt.Errorf("invalid header key: %s (only letters, digits and '_' are allowed)", keyName)
+				}
+				parsedType, err := parseHeaderKeyType(keyType)
+				if err != nil {
+					return err
+				}
+				key = HeaderSortKey{Name: keyName, Type: parsedType}
+			} else {
+				qualityMetric, err := validateMetric(metric)
+				if err != nil {
+					return err
+				}
+				aliases, err := parseHeaderAliases(headerAliases)
+				if err != nil {
+					return err
+				}
+				key = metricSortKey(qualityMetric, aliases)
+			}
+
+			outFormat, err := parseOutputFormat(seqFormat, lineWidth)
+			if err != nil {
+				return err
+			}
+
+			summary, err := runMerge(input, outFile, key, ascending, outFormat)
+			if err != nil {
+				return err
+			}
+			summary.Write(os.Stderr)
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringArrayVarP(&inFiles, "in", "i", nil, "Input sequence file; may be repeated, or files may be given as arguments")
+	flags.BoolVar(&tagSource, "tag-source", false, "Add the name of the input file to headers (file=<basename>)")
+	flags.StringVar(&keepTags, "keep-tags", "", "SAM/BAM input: comma-separated tags to keep in headers (e.g., 'RG,BC'; 'all' for all tags)")
+	flags.StringVar(&duplicates, "duplicates", "ignore", "Check for sequence IDs occurring more than once in the input (ignore, warn, error)")
+	flags.StringVarP(&outFile, "out", "o", "-", "Output sequence file (default: stdout)")
+	flags.StringVar(&seqFormat, "out-format", "", "Output sequence format (fasta, fastq; default: same as input)")
+	flags.IntVar(&lineWidth, "line-width", 0, "Line width of FASTA sequences (0 = no wrapping)")
+	flags.StringVarP(&metric, "metric", "s", "avgphred", "Quality metric the input files are sorted by")
+	flags.BoolVarP(&ascending, "ascending", "a", false, "Input files are sorted in ascending order")
+	flags.StringVar(&headerAliases, "header-alias", "", "Comma-separated metric=key aliases used in headers (e.g., 'maxee=ee')")
+	flags.StringVarP(&keyName, "key", "k", "", "Header field the input files are sorted by, instead of a quality metric")
+	flags.StringVar(&keyType, "key-type", "float", "Type of --key values (float, int, natural, string)")
+
+	return cmd
+}
+
+// MergeSummary counts the records merged by `phredsort merge`
+type MergeSummary struct {
+	Files   int
+	Records int
+}
+
+// Write prints the summary in a human-readable form
+func (s MergeSummary) Write(w io.Writer) {
+	fmt.Fprintf(w, "%s %d records from %d files\n", bold("Merged:"), s.Records, s.Files)
+}
+
+// mergeSource is an input file of a merge with its current (not yet written) record
+type mergeSource struct {
+	path   string
+	reader *InputReader
+	record *fastx.Record
+	count  int // Records read
+}
+
+// mergeHeap holds the current record of each input file (Index is the
+// position of the file), ordered by HeaderSortIndexList.Less
+type mergeHeap struct {
+	*HeaderSortIndexList
+}
+
+func (h mergeHeap) Push(x any) { h.items = append(h.items, x.(HeaderSortIndex)) }
+func (h mergeHeap) Pop() any {
+	n := len(h.items)
+	x := h.items[n-1]
+	h.items = h.items[:n-1]
+	return x
+}
+
+// runMerge performs a k-way merge of sorted input files
+//
+// Parameters:
+//   - in: Input sequence files, each sorted by key (use "-" for stdin); records
+//     are tagged with their file and checked for duplicate IDs as set in in
+//   - outFile: Output sequence file path (use "-" for stdout)
+//   - key: Header field the files are sorted by (see metricSortKey for quality metrics)
+//   - ascending: Whether the files are sorted in ascending order (as with headersort --ascending)
+//   - outFormat: Sequence format of the output (FASTA or FASTQ, line width)
+//
+// Returns an error if file I/O fails, a record has no (valid) key value,
+// or a record of an input file precedes the record before it
+func runMerge(in Input, outFile string, key HeaderSortKey, ascending bool, outFormat OutputFormat) (MergeSummary, error) {
+	summary := MergeSummary{Files: len(in.Files)}
+
+	sources := make([]*mergeSource, len(in.Files))
+	for i, path := range in.Files {
+		// Each file is read separately (tagging and duplicate checks are done here)
+		reader, err := NewInputReader(Input{Files: []string{path}, KeepTags: in.KeepTags})
+		if err != nil {
+			return summary, fmt.Errorf("error creating reader: %v", err)
+		}
+		defer reader.Close()
+		sources[i] = &mergeSource{path: path, reader: reader}
+	}
+
+	outfh, err := xopen.Wopen(outFile)
+	if err != nil {
+		return summary, fmt.Errorf("error creating output file: %v", err)
+	}
+	defer outfh.Close()
+
+	// ids holds the sequence ID of the current record of each file (used for tie-breaking)
+	ids := make([]string, len(sources))
+	h := mergeHeap{NewHeaderKeySortIndexList(make([]HeaderSortIndex, 0, len(sources)), ids, ascending, key, false)}
+
+	dups := newDuplicateIDs(in.Duplicates, in.Files)
+
+	// next reads the next record of a file, checking that the file is sorted
+	next := func(i int, prev *HeaderSortIndex) (HeaderSortIndex, bool, error) {
+		src := sources[i]
+		record, err := src.reader.Read()
+		if err == io.EOF {
+			return HeaderSortIndex{}, false, nil
+		}
+		if err != nil {
+			return HeaderSortIndex{}, false, fmt.Errorf("error reading %s: %v", src.path, err)
+		}
+		src.record = record
+		src.count++
+		if err := dups.Add(record.Name, i); err != nil {
+			return HeaderSortIndex{}, false, err
+		}
+
+		parsed := parseHeaderFields(string(record.Name))
+		si, found, err := key.Value(parsed)
+		if err != nil {
+			return si, false, fmt.Errorf("%s: %v", src.path, err)
+		}
+		if !found {
+			return si, false, fmt.Errorf("%s: record %s has no '%s' value", src.path, parsed.ID, key.Name)
+		}
+		si.Index = i
+
+		if prev != nil && h.lessItems(&si, prev, parsed.ID, ids[i]) {
+			return si, false, fmt.Errorf("%s is not sorted by %s: record %d (%s) should precede %s", src.path, key.Name, src.count, parsed.ID, ids[i])
+		}
+		ids[i] = parsed.ID
+		return si, true, nil
+	}
+
+	for i := range sources {
+		si, ok, err := next(i, nil)
+		if err != nil {
+			return summary, err
+		}
+		if ok {
+			heap.Push(h, si)
+		}
+	}
+
+	for h.Len() > 0 {
+		top := h.items[0]
+		src := sources[top.Index]
+		if in.TagSource {
+			name := append([]byte(nil), src.record.Name...)
+			if src.record.Name, err = in.Format.Annotate(name, []HeaderAnnotation{{"file", sourceTag(src.path)}}); err != nil {
+				return summary, err
+			}
+		}
+		if err := outFormat.WriteRecord(outfh, src.record, src.reader.IsFastq); err != nil {
+			return summary, err
+		}
+		summary.Records++
+
+		// The record is written before the next one of the same file is read,
+		// since the reader reuses it
+		si, ok, err := next(top.Index, &top)
+		if err != nil {
+			return summary, err
+		}
+		if ok {
+			h.items[0] = si
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	dups.Warn(os.Stderr)
+
+	return summary, nil
+}
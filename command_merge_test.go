@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+// writeMergeInputs writes one FASTQ file per list of headers and returns their paths
+func writeMergeInputs(t *testing.T, dir string, files ...[]string) []string {
+	t.Helper()
+	var paths []string
+	for i, headers := range files {
+		var records []*fastx.Record
+		for _, h := range headers {
+			records = append(records, createTestRecord(h, "ACGT", "IIII"))
+		}
+		path := filepath.Join(dir, fmt.Sprintf("input%d.fastq", i+1))
+		writeFastqRecords(t, path, records)
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestRunMerge(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     [][]string
+		key       HeaderSortKey
+		ascending bool
+		want      []string
+		wantErr   string
+	}{
+		{
+			name: "maxee (lower is better), ties broken by ID",
+			files: [][]string{
+				{"a1;maxee=0.1", "a2;maxee=0.5", "a3;maxee=2"},
+				{"b1;maxee=0.2", "b10;maxee=0.5"},
+				{},
+				{"c1;maxee=0.05", "b2;maxee=0.5", "c3;maxee=3"},
+			},
+			key:  metricSortKey(MaxEE, nil),
+			want: []string{"c1", "a1", "b1", "a2", "b2", "b10", "a3", "c3"},
+		},
+		{
+			name: "avgphred in ascending order",
+			files: [][]string{
+				{"a1 avgphred=20", "a2 avgphred=35"},
+				{"b1 avgphred=10", "b2 avgphred=30"},
+			},
+			key:       metricSortKey(AvgPhred, nil),
+			ascending: true,
+			want:      []string{"b1", "a1", "b2", "a2"},
+		},
+		{
+			name: "Integer key",
+			files: [][]string{
+				{"a1;size=100", "a2;size=9"},
+				{"b1;size=10", "b2;size=1"},
+			},
+			key:  HeaderSortKey{Name: "size", Type: KeyInt},
+			want: []string{"a1", "b1", "a2", "b2"},
+		},
+		{
+			name: "Unsorted input",
+			files: [][]string{
+				{"a1;maxee=0.1", "a2;maxee=0.5"},
+				{"b1;maxee=0.2", "b2;maxee=0.1"},
+			},
+			key:     metricSortKey(MaxEE, nil),
+			wantErr: "input2.fastq is not sorted by maxee: record 2 (b2;maxee=0.1) should precede b1;maxee=0.2",
+		},
+		{
+			name: "Unsorted ties",
+			files: [][]string{
+				{"a10;maxee=0.1", "a2;maxee=0.1"},
+			},
+			key:     metricSortKey(MaxEE, nil),
+			wantErr: "record 2 (a2;maxee=0.1) should precede a10;maxee=0.1",
+		},
+		{
+			name: "Missing key",
+			files: [][]string{
+				{"a1;maxee=0.1", "a2"},
+			},
+			key:     metricSortKey(MaxEE, nil),
+			wantErr: "record a2 has no 'maxee' value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			inputs := writeMergeInputs(t, tmpDir, tt.files...)
+			outputPath := filepath.Join(tmpDir, "merged.fastq")
+
+			summary, err := runMerge(testInput(inputs...), outputPath, tt.key, tt.ascending, OutputFormat{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("runMerge() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runMerge() error = %v", err)
+			}
+
+			var got []string
+			for _, id := range readFastxIDs(t, outputPath) {
+				got = append(got, strings.SplitN(strings.SplitN(id, ";", 2)[0], " ", 2)[0])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("runMerge() order = %v, want %v", got, tt.want)
+			}
+			if summary.Records != len(tt.want) || summary.Files != len(tt.files) {
+				t.Errorf("summary = %+v", summary)
+			}
+		})
+	}
+}
+
+func TestRunMergeMatchesHeadersort(t *testing.T) {
+	tmpDir := t.TempDir()
+	var all []string
+	var files [][]string
+	for f := 0; f < 3; f++ {
+		var headers []string
+		for i := 0; i < 20; i++ {
+			h := fmt.Sprintf("r%d_%d;maxee=%.1f", f, i, float64((i*7+f*3)%10)/10)
+			headers = append(headers, h)
+			all = append(all, h)
+		}
+		files = append(files, headers)
+	}
+	inputs := writeMergeInputs(t, tmpDir, files...)
+	combined := writeMergeInputs(t, t.TempDir(), all)[0]
+
+	// Sort each file separately, then merge them
+	key := metricSortKey(MaxEE, nil)
+	var sorted []string
+	for i, path := range inputs {
+		out := filepath.Join(tmpDir, fmt.Sprintf("sorted%d.fastq", i))
+		if err := runPresort(testInput(path), out, key, false, 0, -1, 100, MissingError, "", DEFAULT_MIN_PHRED, OutputOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		sorted = append(sorted, out)
+	}
+	mergedPath := filepath.Join(tmpDir, "merged.fastq")
+	if _, err := runMerge(testInput(sorted...), mergedPath, key, false, OutputFormat{}); err != nil {
+		t.Fatalf("runMerge() error = %v", err)
+	}
+
+	// Sort all records at once
+	wholePath := filepath.Join(tmpDir, "whole.fastq")
+	if err := runPresort(testInput(combined), wholePath, key, false, 0, -1, 100, MissingError, "", DEFAULT_MIN_PHRED, OutputOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if merged, whole := readFastxIDs(t, mergedPath), readFastxIDs(t, wholePath); !reflect.DeepEqual(merged, whole) {
+		t.Errorf("merged order differs from headersort:\n%v\n%v", merged, whole)
+	}
+}
@@ -7,9 +7,8 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"os"
 
-	"github.com/shenwei356/bio/seq"
-	"github.com/shenwei356/bio/seqio/fastx"
 	"github.com/shenwei356/xopen"
 	"github.com/spf13/cobra"
 )
@@ -23,13 +22,33 @@ import (
 // large input files
 func NoSortCommand() *cobra.Command {
 	var (
-		inFile        string
+		inFiles       []string
+		tagSource     bool
+		keepTags      string
+		duplicates    string
 		outFile       string
+		seqFormat     string
+		lineWidth     int
 		metric        string
 		minPhred      int
 		minQualFilter float64
 		maxQualFilter float64
 		headerMetrics string
+		headerSep     string
+		headerTrail   bool
+		headerAliases string
+		headerPrec    int
+		headerDigits  int
+		onExisting    string
+		htmlReport    string
+		metricsFile   string
+		metricsFormat string
+		metricsOnly   bool
+		outPattern    string
+		bins          string
+		binLabels     string
+		splitRecords  int
+		splitBases    int
 	)
 
 	cmd := &cobra.Command{
@@ -52,27 +71,130 @@ not perform any reordering of records.`,
 			if err != nil {
 				return err
 			}
+			parsedHeaderFormat, err := parseHeaderFormat(headerSep, headerTrail, headerAliases, headerPrec, headerDigits, onExisting)
+			if err != nil {
+				return err
+			}
+
+			// Collect statistics for the HTML report during the same pass
+			var report *ReportCollector
+			if htmlReport != "" {
+				report = NewReportCollector(qualityMetric, minPhred, minQualFilter, maxQualFilter)
+			}
+
+			// Write metrics to a sidecar table instead of annotating headers
+			var metricsOut *MetricsWriter
+			if metricsFile != "" {
+				metricsOut, err = NewRecordMetricsWriter(metricsFile, metricsFormat, sidecarMetrics(parsedHeaderMetrics, qualityMetric), parsedHeaderFormat)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Read all input files as one
+			input, err := parseInput(cmd, inFiles, args, tagSource, duplicates)
+			if err != nil {
+				return err
+			}
+			if input.KeepTags, err = parseTagFilter(keepTags); err != nil {
+				return err
+			}
+			input.Format = parsedHeaderFormat
+
+			// Split the output into quality tiers or fixed-size parts
+			split, err := NewOutputSplitter(outPattern, bins, binLabels, splitRecords, splitBases)
+			if err != nil {
+				return err
+			}
+			if split != nil && cmd.Flags().Changed("out") {
+				return fmt.Errorf("--out and --out-pattern can't be used together")
+			}
+			if metricsOnly {
+				if metricsOut == nil {
+					return fmt.Errorf("--metrics-only requires --metrics-out")
+				}
+				if split != nil || cmd.Flags().Changed("out") {
+					return fmt.Errorf("--metrics-only can't be used with --out or --out-pattern")
+				}
+				outFile = ""
+			}
+
+			outFormat, err := parseOutputFormat(seqFormat, lineWidth)
+			if err == nil {
+				err = outFormat.checkSAM(outFile)
+			}
+			if err != nil {
+				return err
+			}
 
-			return runNoSort(
-				inFile,
+			err = runNoSort(
+				input,
 				outFile,
 				qualityMetric,
 				parsedHeaderMetrics,
+				parsedHeaderFormat,
 				minPhred,
 				minQualFilter,
 				maxQualFilter,
+				OutputOptions{
+					Report:     report,
+					MetricsOut: metricsOut,
+					Split:      split,
+					Format:     outFormat,
+				},
 			)
+			if metricsOut != nil {
+				if closeErr := metricsOut.Close(); err == nil {
+					err = closeErr
+				}
+			}
+			if split != nil {
+				if closeErr := split.Close(); err == nil {
+					err = closeErr
+				}
+			}
+			if err != nil {
+				return err
+			}
+			if split != nil {
+				split.Summary.Write(os.Stderr)
+			}
+
+			if report != nil {
+				return report.WriteHTML(htmlReport, collectReportParams(cmd))
+			}
+			return nil
 		},
 	}
 
 	flags := cmd.Flags()
-	flags.StringVarP(&inFile, "in", "i", "-", "Input FASTQ file (default: stdin)")
-	flags.StringVarP(&outFile, "out", "o", "-", "Output FASTQ file (default: stdout)")
+	flags.StringArrayVarP(&inFiles, "in", "i", []string{"-"}, "Input FASTQ file; may be repeated, or files may be given as arguments (default: stdin)")
+	flags.BoolVar(&tagSource, "tag-source", false, "Add the name of the input file to headers (file=<basename>)")
+	flags.StringVar(&keepTags, "keep-tags", "", "SAM/BAM input: comma-separated tags to keep in headers (e.g., 'RG,BC'; 'all' for all tags)")
+	flags.StringVar(&duplicates, "duplicates", "ignore", "Check for sequence IDs occurring more than once in the input (ignore, warn, error)")
+	flags.StringVarP(&outFile, "out", "o", "-", "Output FASTQ file (default: stdout); .sam or .bam for unaligned SAM/BAM")
+	flags.StringVar(&seqFormat, "out-format", "", "Output sequence format (fasta, fastq; default: fastq)")
+	flags.IntVar(&lineWidth, "line-width", 0, "Line width of FASTA sequences (0 = no wrapping)")
 	flags.StringVarP(&metric, "metric", "s", "avgphred", "Quality metric (avgphred, maxee, meep, lqcount, lqpercent)")
 	flags.IntVarP(&minPhred, "minphred", "p", DEFAULT_MIN_PHRED, "Quality threshold for 'lqcount' and 'lqpercent' metrics")
 	flags.Float64VarP(&minQualFilter, "minqual", "m", -math.MaxFloat64, "Minimum quality threshold for filtering")
 	flags.Float64VarP(&maxQualFilter, "maxqual", "M", math.MaxFloat64, "Maximum quality threshold for filtering")
 	flags.StringVarP(&headerMetrics, "header", "H", "", "Comma-separated list of metrics to add to headers (e.g., 'avgphred,maxee,length')")
+	flags.StringVar(&headerSep, "header-sep", "space", "Separator of header annotations ('space' or 'semicolon')")
+	flags.BoolVar(&headerTrail, "header-trailing", false, "Terminate header annotations with ';' (requires --header-sep semicolon)")
+	flags.StringVar(&headerAliases, "header-alias", "", "Comma-separated metric=key aliases for header annotations (e.g., 'maxee=ee')")
+	flags.IntVar(&headerPrec, "header-precision", 6, "Number of decimal places of metric values in headers")
+	flags.IntVar(&headerDigits, "header-digits", 0, "Number of significant digits of metric values in headers (overrides --header-precision)")
+	flags.StringVar(&onExisting, "on-existing", "replace", "What to do with header keys that already exist (replace, keep, append, error)")
+	flags.StringVar(&htmlReport, "html", "", "Write a self-contained HTML QC report to this file")
+	flags.StringVar(&metricsFile, "metrics-out", "", "Write per-record metrics to this table instead of annotating headers")
+	flags.StringVar(&metricsFormat, "metrics-format", "tsv", "Format of the --metrics-out table (tsv, jsonl, parquet)")
+	flags.BoolVar(&metricsOnly, "metrics-only", false, "Only write the --metrics-out table, without sequence output")
+	flags.StringVar(&outPattern, "out-pattern", "", "Write output to several files named after this pattern (e.g., 'tier_{bin}.fq.gz', 'part_{part}.fq.gz')")
+	flags.StringVar(&bins, "bins", "", "Comma-separated metric breakpoints splitting the output into quality tiers (e.g., '0.5,1,2')")
+	flags.StringVar(&binLabels, "bin-labels", "", "Comma-separated names of the --bins tiers used for {bin} (e.g., 'gold,silver,bronze,rest')")
+	flags.IntVar(&splitRecords, "split-records", 0, "Start a new output file every N records")
+	flags.IntVar(&splitBases, "split-bases", 0, "Start a new output file every N bases")
 
 	return cmd
 }
@@ -86,23 +208,29 @@ not perform any reordering of records.`,
 // Records that don't meet the quality thresholds are filtered out and not written
 //
 // Parameters:
-//   - inFile: Input FASTQ file path (use "-" for stdin)
-//   - outFile: Output FASTQ file path (use "-" for stdout)
+//   - in: Input FASTQ files (use "-" for stdin), read as one
+//   - outFile: Output FASTQ file path (use "-" for stdout, "" for no output)
 //   - metric: Quality metric to calculate for filtering
 //   - headerMetrics: Optional metrics to append to headers
+//   - headerFormat: Syntax of the header annotations
 //   - minPhred: Minimum Phred threshold for lqcount/lqpercent calculations
 //   - minQualFilter: Minimum quality threshold for filtering
 //   - maxQualFilter: Maximum quality threshold for filtering
+//   - opts: Optional outputs (report, metrics table, splitting) and the sequence format;
+//     opts.Groups is not used, as records are written in the input order
 //
 // Returns an error if file I/O operations fail
 func runNoSort(
-	inFile, outFile string,
+	in Input,
+	outFile string,
 	metric QualityMetric,
 	headerMetrics []HeaderMetric,
+	headerFormat HeaderFormat,
 	minPhred int,
 	minQualFilter, maxQualFilter float64,
+	opts OutputOptions,
 ) error {
-	reader, err := fastx.NewReader(seq.DNAredundant, inFile, fastx.DefaultIDRegexp)
+	reader, err := NewInputReader(in)
 	if err != nil {
 		return fmt.Errorf("error creating reader: %v", err)
 	}
@@ -113,11 +241,26 @@ func runNoSort(
 		}
 	}()
 
-	outfh, err := xopen.Wopen(outFile)
-	if err != nil {
-		return fmt.Errorf("error creating output file: %v", err)
+	// Split output files are created on demand; without an output file
+	// (outFile = "") only the metrics table is written
+	var outfh io.Writer
+	var sam *SAMWriter
+	if opts.Split == nil && outFile != "" {
+		fh, err := xopen.Wopen(outFile)
+		if err != nil {
+			return fmt.Errorf("error creating output file: %v", err)
+		}
+		defer fh.Close()
+		outfh = fh
+
+		// SAM/BAM output (by file extension), with the metrics as tags
+		if sam, err = NewSAMOutput(fh, outFile, reader.SAMHeader()); err != nil {
+			return fmt.Errorf("error creating output file: %v", err)
+		}
+		if sam != nil {
+			outfh = sam
+		}
 	}
-	defer outfh.Close()
 
 	for {
 		record, err := reader.Read()
@@ -133,9 +276,23 @@ func runNoSort(
 		}
 
 		quality := calculateQuality(record, metric, minPhred)
+		if opts.Report != nil {
+			opts.Report.Add(record, quality)
+		}
+		fh := outfh
+		if opts.Split != nil && quality >= minQualFilter && quality <= maxQualFilter {
+			if fh, err = opts.Split.Writer(quality, len(record.Seq.Seq)); err != nil {
+				return err
+			}
+		}
 		// writeRecord handles header annotation and filtering
-		writeRecord(outfh, record, quality, headerMetrics, metric, minPhred, minQualFilter, maxQualFilter)
+		if _, err := writeRecord(fh, record, quality, headerMetrics, headerFormat, metric, minPhred, minQualFilter, maxQualFilter, opts); err != nil {
+			return err
+		}
 	}
 
+	if sam != nil {
+		return sam.Close()
+	}
 	return nil
 }
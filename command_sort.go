@@ -195,7 +195,7 @@ func zstdEncodeCapacity(inputLen int) int {
 	return nextPowerOfTwo(inputLen + inputLen/8 + 64)
 }
 
-func exitIfNotFastq(reader *fastx.Reader, closeReader *bool) {
+func exitIfNotFastq(reader *InputReader, closeReader *bool) {
 	if reader.IsFastq {
 		return
 	}
@@ -238,9 +238,136 @@ func runDefaultCommand(cmd *cobra.Command, args []string) {
 		fmt.Fprintln(os.Stderr, red(err.Error()))
 		exitFunc(1)
 	}
+	parsedHeaderFormat, err := parseHeaderFormat(headerSep, headerTrail, headerAliases, headerPrec, headerDigits, onExisting)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+		exitFunc(1)
+	}
+
+	// Collect statistics for the HTML report during the same pass
+	var report *ReportCollector
+	if htmlReport != "" {
+		report = NewReportCollector(qualityMetric, minPhred, minQualFilter, maxQualFilter)
+	}
+
+	// Write metrics to a sidecar table instead of annotating headers
+	var metricsOut *MetricsWriter
+	if metricsFile != "" {
+		metricsOut, err = NewRecordMetricsWriter(metricsFile, metricsFormat, sidecarMetrics(parsedHeaderMetrics, qualityMetric), parsedHeaderFormat)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+			exitFunc(1)
+		}
+	}
+
+	// Group records (e.g., by UMI or sample) and keep the best ones of each group,
+	// or sort records within groups (--within, groups are never interleaved)
+	groups, err := parseSortGrouping(cmd, groupBy, within, perGroup, groupOrder)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+		exitFunc(1)
+	}
+
+	// Split the output into quality tiers or fixed-size parts
+	split, err := NewOutputSplitter(outPattern, bins, binLabels, splitRecords, splitBases)
+	if err == nil && split != nil && cmd.Flags().Changed("out") {
+		err = fmt.Errorf("--out and --out-pattern can't be used together")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+		exitFunc(1)
+	}
+
+	// FASTA or FASTQ output (the quality annotations are kept in FASTA headers)
+	outFormat, err := parseOutputFormat(seqFormat, lineWidth)
+	if err == nil {
+		err = outFormat.checkSAM(outFile)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+		exitFunc(1)
+	}
+
+	// Read all input files as one
+	input, err := parseInput(cmd, inFiles, args, tagSource, duplicates)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+		exitFunc(1)
+	}
+	input.Format = parsedHeaderFormat
+	if input.KeepTags, err = parseTagFilter(keepTags); err != nil {
+		fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+		exitFunc(1)
+	}
 
 	// Process input (unified approach for both stdin and file)
-	sortRecords(inFile, outFile, ascending, qualityMetric, compLevel, parsedHeaderMetrics, minPhred, minQualFilter, maxQualFilter)
+	sortRecords(input, outFile, ascending, qualityMetric, compLevel, parsedHeaderMetrics, parsedHeaderFormat, minPhred, minQualFilter, maxQualFilter, OutputOptions{
+		Report:     report,
+		MetricsOut: metricsOut,
+		Groups:     groups,
+		Split:      split,
+		Format:     outFormat,
+	})
+
+	if split != nil {
+		if err := split.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+			exitFunc(1)
+		}
+		split.Summary.Write(os.Stderr)
+	}
+
+	if groups != nil {
+		groups.Summary.Write(os.Stderr)
+		if within != "" {
+			groups.Summary.WriteCounts(os.Stderr)
+		}
+	}
+
+	if metricsOut != nil {
+		if err := metricsOut.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+			exitFunc(1)
+		}
+	}
+
+	if report != nil {
+		if err := report.WriteHTML(htmlReport, collectReportParams(cmd)); err != nil {
+			fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+			exitFunc(1)
+		}
+	}
+}
+
+// parseSortGrouping validates the grouping flags of the sort command.
+// --within is --group-by with records of each group written together
+// (in natural group order unless --group-order is given).
+// Returns nil if neither --group-by nor --within is used
+func parseSortGrouping(cmd *cobra.Command, groupBy, within string, perGroup int, groupOrder string) (*Grouping, error) {
+	if groupBy != "" && within != "" {
+		return nil, fmt.Errorf("--group-by and --within are mutually exclusive")
+	}
+	if groupBy == "" && within == "" {
+		if perGroup != 0 {
+			return nil, fmt.Errorf("--per-group requires --group-by or --within")
+		}
+		return nil, nil
+	}
+
+	order, err := parseGroupOrder(groupOrder)
+	if err != nil {
+		return nil, err
+	}
+	spec := groupBy
+	if within != "" {
+		spec = within
+		if !cmd.Flags().Changed("group-order") {
+			order = GroupOrderNatural
+		} else if order == GroupOrderGlobal {
+			return nil, fmt.Errorf("--within requires --group-order 'natural' or 'size'")
+		}
+	}
+	return parseGrouping(spec, perGroup, order)
 }
 
 // sortRecords reads FASTQ records from input, calculates quality metrics, sorts them,
@@ -254,17 +381,19 @@ func runDefaultCommand(cmd *cobra.Command, args []string) {
 // When compLevel == 0, records are stored uncompressed (faster but uses more memory)
 //
 // Parameters:
-//   - inFile: Input file path (use "-" for stdin)
+//   - in: Input files (use "-" for stdin), read as one
 //   - outFile: Output file path (use "-" for stdout)
 //   - ascending: If true, sort in ascending order; if false, sort in descending order
 //   - metric: Quality metric to use for sorting
 //   - compLevel: Compression level (0-22, 0 = disabled)
 //   - headerMetrics: Optional metrics to append to headers
+//   - headerFormat: Syntax of the header annotations
 //   - minPhred: Minimum Phred threshold for lqcount/lqpercent calculations
 //   - minQualFilter: Minimum quality threshold for filtering
 //   - maxQualFilter: Maximum quality threshold for filtering
-func sortRecords(inFile, outFile string, ascending bool, metric QualityMetric, compLevel int, headerMetrics []HeaderMetric, minPhred int, minQualFilter float64, maxQualFilter float64) {
-	reader, err := fastx.NewReader(seq.DNAredundant, inFile, fastx.DefaultIDRegexp)
+//   - opts: Optional outputs (report, metrics table, grouping, splitting) and the sequence format
+func sortRecords(in Input, outFile string, ascending bool, metric QualityMetric, compLevel int, headerMetrics []HeaderMetric, headerFormat HeaderFormat, minPhred int, minQualFilter float64, maxQualFilter float64, opts OutputOptions) {
+	reader, err := NewInputReader(in)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, red("Error creating reader: %v\n"), err)
 		exitFunc(1)
@@ -276,24 +405,39 @@ func sortRecords(inFile, outFile string, ascending bool, metric QualityMetric, c
 		}
 	}()
 
-	// Create output file handle at the beginning
-	outfh, err := xopen.Wopen(outFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, red("Error creating output file: %v\n"), err)
-		exitFunc(1)
+	// Create output file handle at the beginning (split output files are created on demand)
+	var outfh io.Writer
+	if opts.Split == nil {
+		fh, err := xopen.Wopen(outFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, red("Error creating output file: %v\n"), err)
+			exitFunc(1)
+		}
+		defer fh.Close()
+		outfh = fh
+
+		// SAM/BAM output (by file extension), with the metrics as tags
+		sam, err := NewSAMOutput(fh, outFile, reader.SAMHeader())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, red("Error creating output file: %v\n"), err)
+			exitFunc(1)
+		}
+		if sam != nil {
+			defer sam.Close()
+			outfh = sam
+		}
 	}
-	defer outfh.Close()
 
 	if compLevel > 0 {
-		sortCompressed(reader, outfh, ascending, metric, compLevel, headerMetrics, minPhred, minQualFilter, maxQualFilter, &closeReader)
+		sortCompressed(reader, outfh, ascending, metric, compLevel, headerMetrics, headerFormat, minPhred, minQualFilter, maxQualFilter, opts, &closeReader)
 	} else {
-		sortUncompressed(reader, outfh, ascending, metric, headerMetrics, minPhred, minQualFilter, maxQualFilter, &closeReader)
+		sortUncompressed(reader, outfh, ascending, metric, headerMetrics, headerFormat, minPhred, minQualFilter, maxQualFilter, opts, &closeReader)
 	}
 }
 
 // sortCompressed handles sorting with ZSTD compression enabled
 // Uses chunked storage to avoid monolithic compressed-buffer reallocations
-func sortCompressed(reader *fastx.Reader, outfh *xopen.Writer, ascending bool, metric QualityMetric, compLevel int, headerMetrics []HeaderMetric, minPhred int, minQualFilter float64, maxQualFilter float64, closeReader *bool) {
+func sortCompressed(reader *InputReader, outfh io.Writer, ascending bool, metric QualityMetric, compLevel int, headerMetrics []HeaderMetric, headerFormat HeaderFormat, minPhred int, minQualFilter float64, maxQualFilter float64, opts OutputOptions, closeReader *bool) {
 	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(compLevel)))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, red("Error creating ZSTD encoder: %v\n"), err)
@@ -334,7 +478,14 @@ func sortCompressed(reader *fastx.Reader, outfh *xopen.Writer, ascending bool, m
 
 		name := string(record.Name)
 		avgQual := calculateQuality(record, metric, minPhred)
+		if opts.Report != nil {
+			opts.Report.Add(record, avgQual)
+		}
 		if avgQual < minQualFilter || avgQual > maxQualFilter {
+			if err := opts.MetricsOut.WriteFiltered(record, minPhred); err != nil {
+				fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+				exitFunc(1)
+			}
 			continue
 		}
 
@@ -366,13 +517,17 @@ func sortCompressed(reader *fastx.Reader, outfh *xopen.Writer, ascending bool, m
 	// Sort records using index-based sorting
 	qualityList := NewQualityIndexList(qualityScores, names, ascending, metric)
 	sort.Sort(qualityList)
+	items := qualityList.Items()
+	if opts.Groups != nil {
+		items = groupRecords(opts.Groups, items, func(qi QualityIndex) string { return opts.Groups.GroupOf(names[qi.Index]) })
+	}
 
 	// Get a reusable buffer for decompression
 	decompBuf := getDecompBuffer()
 	defer putDecompBuffer(decompBuf)
 
 	// Writing records in sorted order
-	for _, qi := range qualityList.Items() {
+	for _, qi := range items {
 		compData := storage.Get(int(qi.Index))
 
 		// Decompress using pooled buffer
@@ -391,13 +546,23 @@ func sortCompressed(reader *fastx.Reader, outfh *xopen.Writer, ascending bool, m
 				Qual: decompressed[seqLen:],
 			},
 		}
-		writeRecord(outfh, record, float64(qi.Value), headerMetrics, metric, minPhred, minQualFilter, maxQualFilter)
+		fh := outfh
+		if opts.Split != nil {
+			if fh, err = opts.Split.Writer(float64(qi.Value), len(record.Seq.Seq)); err != nil {
+				fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+				exitFunc(1)
+			}
+		}
+		if _, err := writeRecord(fh, record, float64(qi.Value), headerMetrics, headerFormat, metric, minPhred, minQualFilter, maxQualFilter, opts); err != nil {
+			fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+			exitFunc(1)
+		}
 	}
 }
 
 // sortUncompressed handles sorting without compression
 // Uses index-based sorting with a slice instead of a map for record storage
-func sortUncompressed(reader *fastx.Reader, outfh *xopen.Writer, ascending bool, metric QualityMetric, headerMetrics []HeaderMetric, minPhred int, minQualFilter float64, maxQualFilter float64, closeReader *bool) {
+func sortUncompressed(reader *InputReader, outfh io.Writer, ascending bool, metric QualityMetric, headerMetrics []HeaderMetric, headerFormat HeaderFormat, minPhred int, minQualFilter float64, maxQualFilter float64, opts OutputOptions, closeReader *bool) {
 	// Use slices instead of maps for more efficient memory layout
 	records := make([]*fastx.Record, 0, 10000)
 	names := make([]string, 0, 10000)
@@ -417,7 +582,14 @@ func sortUncompressed(reader *fastx.Reader, outfh *xopen.Writer, ascending bool,
 
 		name := string(record.Name)
 		avgQual := calculateQuality(record, metric, minPhred)
+		if opts.Report != nil {
+			opts.Report.Add(record, avgQual)
+		}
 		if avgQual < minQualFilter || avgQual > maxQualFilter {
+			if err := opts.MetricsOut.WriteFiltered(record, minPhred); err != nil {
+				fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+				exitFunc(1)
+			}
 			continue
 		}
 
@@ -433,10 +605,25 @@ func sortUncompressed(reader *fastx.Reader, outfh *xopen.Writer, ascending bool,
 	// Sort records using index-based sorting
 	qualityList := NewQualityIndexList(qualityScores, names, ascending, metric)
 	sort.Sort(qualityList)
+	items := qualityList.Items()
+	if opts.Groups != nil {
+		items = groupRecords(opts.Groups, items, func(qi QualityIndex) string { return opts.Groups.GroupOf(names[qi.Index]) })
+	}
 
 	// Output in sorted order using indices
-	for _, qi := range qualityList.Items() {
+	for _, qi := range items {
 		record := records[qi.Index]
-		writeRecord(outfh, record, float64(qi.Value), headerMetrics, metric, minPhred, minQualFilter, maxQualFilter)
+		fh := outfh
+		if opts.Split != nil {
+			var err error
+			if fh, err = opts.Split.Writer(float64(qi.Value), len(record.Seq.Seq)); err != nil {
+				fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+				exitFunc(1)
+			}
+		}
+		if _, err := writeRecord(fh, record, float64(qi.Value), headerMetrics, headerFormat, metric, minPhred, minQualFilter, maxQualFilter, opts); err != nil {
+			fmt.Fprintln(os.Stderr, red("Error: "+err.Error()))
+			exitFunc(1)
+		}
 	}
 }
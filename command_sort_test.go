@@ -130,8 +130,8 @@ func TestSortRecordsCompressedMatchesUncompressed(t *testing.T) {
 	}
 	writeFastqRecords(t, inputPath, records)
 
-	sortRecords(inputPath, outPlain, false, AvgPhred, 0, nil, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64)
-	sortRecords(inputPath, outCompressed, false, AvgPhred, 1, nil, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64)
+	sortRecords(testInput(inputPath), outPlain, false, AvgPhred, 0, nil, defaultHeaderFormat, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{})
+	sortRecords(testInput(inputPath), outCompressed, false, AvgPhred, 1, nil, defaultHeaderFormat, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{})
 
 	plainBytes, err := os.ReadFile(outPlain)
 	if err != nil {
@@ -163,7 +163,7 @@ func TestSortRecordsRejectsFasta(t *testing.T) {
 			}
 
 			expectExitWithFastqError(t, func() {
-				sortRecords(inputPath, outputPath, false, AvgPhred, compLevel, nil, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64)
+				sortRecords(testInput(inputPath), outputPath, false, AvgPhred, compLevel, nil, defaultHeaderFormat, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{})
 			})
 		})
 	}
@@ -177,7 +177,7 @@ func TestRunNoSortRejectsFasta(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err := runNoSort(inputPath, outputPath, AvgPhred, nil, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64)
+	err := runNoSort(testInput(inputPath), outputPath, AvgPhred, nil, defaultHeaderFormat, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{})
 	if err == nil {
 		t.Fatalf("expected FASTQ-only error")
 	}
@@ -195,7 +195,7 @@ func TestRunPresortAcceptsFasta(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := runPresort(inputPath, outputPath, MaxEE, false, -math.MaxFloat64, math.MaxFloat64); err != nil {
+	if err := runPresort(testInput(inputPath), outputPath, metricSortKey(MaxEE, nil), false, 0, -math.MaxFloat64, math.MaxFloat64, MissingError, "", DEFAULT_MIN_PHRED, OutputOptions{}); err != nil {
 		t.Fatalf("runPresort() error = %v", err)
 	}
 
@@ -229,7 +229,7 @@ func TestSortRecordsFilteringBothModes(t *testing.T) {
 			}
 			writeFastqRecords(t, inputPath, records)
 
-			sortRecords(inputPath, outputPath, false, AvgPhred, compLevel, nil, DEFAULT_MIN_PHRED, 20, 35)
+			sortRecords(testInput(inputPath), outputPath, false, AvgPhred, compLevel, nil, defaultHeaderFormat, DEFAULT_MIN_PHRED, 20, 35, OutputOptions{})
 
 			gotIDs := readFastxIDs(t, outputPath)
 			wantIDs := []string{"medium", "edge"}
@@ -239,3 +239,192 @@ func TestSortRecordsFilteringBothModes(t *testing.T) {
 		})
 	}
 }
+
+func TestRunPresortHeaderAliases(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	outputPath := filepath.Join(tmpDir, "output.fastq")
+	records := []*fastx.Record{
+		createTestRecord("seq1;size=3;ee=2.5e-01;", "ACGT", "IIII"),
+		createTestRecord("seq2;size=5;ee=1e-05;", "TT", "II"),
+		createTestRecord("seq3;size=1;ee=.5;", "GG", "II"),
+	}
+	writeFastqRecords(t, inputPath, records)
+
+	if err := runPresort(testInput(inputPath), outputPath, metricSortKey(MaxEE, map[string]string{"maxee": "ee"}), false, 0, -math.MaxFloat64, math.MaxFloat64, MissingError, "", DEFAULT_MIN_PHRED, OutputOptions{}); err != nil {
+		t.Fatalf("runPresort() error = %v", err)
+	}
+
+	var ids []string
+	for _, id := range readFastxIDs(t, outputPath) {
+		ids = append(ids, strings.SplitN(id, ";", 2)[0])
+	}
+	wantIDs := []string{"seq2", "seq1", "seq3"}
+	if !reflect.DeepEqual(ids, wantIDs) {
+		t.Fatalf("headersort IDs = %v, want %v", ids, wantIDs)
+	}
+
+	// Without the alias, the metric key is not found
+	if err := runPresort(testInput(inputPath), outputPath, metricSortKey(MaxEE, nil), false, 0, -math.MaxFloat64, math.MaxFloat64, MissingError, "", DEFAULT_MIN_PHRED, OutputOptions{}); err == nil {
+		t.Fatalf("runPresort() expected missing metric error")
+	}
+}
+
+func TestRunPresortCustomKey(t *testing.T) {
+	names := []string{
+		"seq1 abundance=9007199254740993 score=-3.2 sample=s10",
+		"seq2 abundance=9007199254740992 score=1e-05 sample=s9",
+		"seq3 abundance=12 score=+Inf sample=S1",
+		"seq4 abundance=12 score=-3.2 sample=s9",
+	}
+	tests := []struct {
+		name      string
+		key       HeaderSortKey
+		ascending bool
+		minQual   float64
+		maxQual   float64
+		wantIDs   []string
+		wantErr   string
+	}{
+		{
+			name: "Float descending",
+			key:  HeaderSortKey{Name: "score", Type: KeyFloat},
+			// Infinite values are outside of the default filter range (as for quality metrics)
+			wantIDs: []string{"seq2", "seq1", "seq4"},
+		},
+		{
+			name:      "Float ascending",
+			key:       HeaderSortKey{Name: "score", Type: KeyFloat},
+			ascending: true,
+			maxQual:   math.Inf(1),
+			wantIDs:   []string{"seq1", "seq4", "seq2", "seq3"},
+		},
+		{
+			name:    "Int exact comparison with filter",
+			key:     HeaderSortKey{Name: "abundance", Type: KeyInt},
+			minQual: 100,
+			wantIDs: []string{"seq1", "seq2"},
+		},
+		{
+			name:      "Natural order",
+			key:       HeaderSortKey{Name: "sample", Type: KeyNatural},
+			ascending: true,
+			wantIDs:   []string{"seq3", "seq2", "seq4", "seq1"},
+		},
+		{
+			name:      "String order",
+			key:       HeaderSortKey{Name: "sample", Type: KeyString},
+			ascending: true,
+			wantIDs:   []string{"seq3", "seq1", "seq2", "seq4"},
+		},
+		{
+			name:    "Non-integer value",
+			key:     HeaderSortKey{Name: "score", Type: KeyInt},
+			wantErr: "record seq1: invalid integer value",
+		},
+		{
+			name:    "Missing key",
+			key:     HeaderSortKey{Name: "barcode", Type: KeyNatural},
+			wantErr: "barcode",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			inputPath := filepath.Join(tmpDir, "input.fastq")
+			outputPath := filepath.Join(tmpDir, "output.fastq")
+			var records []*fastx.Record
+			for _, name := range names {
+				records = append(records, createTestRecord(name, "ACGT", "IIII"))
+			}
+			writeFastqRecords(t, inputPath, records)
+
+			minQual, maxQual := -math.MaxFloat64, math.MaxFloat64
+			if tt.minQual != 0 {
+				minQual = tt.minQual
+			}
+			if tt.maxQual != 0 {
+				maxQual = tt.maxQual
+			}
+			err := runPresort(testInput(inputPath), outputPath, tt.key, tt.ascending, 0, minQual, maxQual, MissingError, "", DEFAULT_MIN_PHRED, OutputOptions{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("runPresort() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runPresort() error = %v", err)
+			}
+
+			gotIDs := readFastxIDs(t, outputPath)
+			if !reflect.DeepEqual(gotIDs, tt.wantIDs) {
+				t.Fatalf("headersort IDs = %v, want %v", gotIDs, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestRunPresortMissingPolicy(t *testing.T) {
+	records := []*fastx.Record{
+		createTestRecord("seq1 maxee=0.5", "ACGT", "IIII"),
+		createTestRecord("seq2", "ACGT", "IIII"),
+		createTestRecord("seq3 maxee=2", "ACGT", "$$$$"),
+		createTestRecord("seq4", "ACGT", "$$$$"),
+	}
+	tests := []struct {
+		policy      MissingPolicy
+		wantIDs     []string
+		wantRejects []string
+		wantErr     bool
+	}{
+		{policy: MissingError, wantErr: true},
+		{policy: MissingSkip, wantIDs: []string{"seq1", "seq3"}, wantRejects: []string{"seq2", "seq4"}},
+		{policy: MissingFirst, wantIDs: []string{"seq2", "seq4", "seq1", "seq3"}},
+		{policy: MissingLast, wantIDs: []string{"seq1", "seq3", "seq2", "seq4"}},
+		{policy: MissingCompute, wantIDs: []string{"seq2", "seq1", "seq3", "seq4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			inputPath := filepath.Join(tmpDir, "input.fastq")
+			outputPath := filepath.Join(tmpDir, "output.fastq")
+			writeFastqRecords(t, inputPath, records)
+
+			rejectsPath := ""
+			if tt.wantRejects != nil {
+				rejectsPath = filepath.Join(tmpDir, "rejects.fastq")
+			}
+
+			err := runPresort(testInput(inputPath), outputPath, metricSortKey(MaxEE, nil), false, 0, -math.MaxFloat64, math.MaxFloat64, tt.policy, rejectsPath, DEFAULT_MIN_PHRED, OutputOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runPresort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if gotIDs := readFastxIDs(t, outputPath); !reflect.DeepEqual(gotIDs, tt.wantIDs) {
+				t.Fatalf("headersort IDs = %v, want %v", gotIDs, tt.wantIDs)
+			}
+			if rejectsPath != "" {
+				if gotIDs := readFastxIDs(t, rejectsPath); !reflect.DeepEqual(gotIDs, tt.wantRejects) {
+					t.Fatalf("rejected IDs = %v, want %v", gotIDs, tt.wantRejects)
+				}
+			}
+		})
+	}
+}
+
+func TestMissingSummaryWrite(t *testing.T) {
+	var buf bytes.Buffer
+	MissingSummary{Key: "ee", Policy: MissingSkip, Total: 10, Missing: 3, Filtered: 1}.Write(&buf)
+	got := buf.String()
+	for _, want := range []string{"3 of 10 records without 'ee' (skipped)", "1 records removed"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("summary = %q, want to contain %q", got, want)
+		}
+	}
+}
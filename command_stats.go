@@ -0,0 +1,263 @@
+// Subcommand (`phredsort stats`) for summarizing per-read quality metrics
+// and the per-position quality profile of a FASTQ file
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// Default list of per-read metrics summarized by `phredsort stats`
+const defaultStatsMetrics = "avgphred,maxee,meep,lqcount,lqpercent,length"
+
+// MetricSummary accumulates summary statistics of a per-read metric.
+// Infinite values (e.g., maxEE of zero-length reads) are counted separately
+// and excluded from min/max/mean
+type MetricSummary struct {
+	Metric    string  `json:"metric"`
+	Reads     uint64  `json:"reads"`
+	Undefined uint64  `json:"undefined"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	Mean      float64 `json:"mean"`
+	sum       float64
+}
+
+// Add includes a single per-read value into the summary
+func (s *MetricSummary) Add(value float64) {
+	s.Reads++
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		s.Undefined++
+		return
+	}
+
+	defined := s.Reads - s.Undefined
+	if defined == 1 || value < s.Min {
+		s.Min = value
+	}
+	if defined == 1 || value > s.Max {
+		s.Max = value
+	}
+	s.sum += value
+	s.Mean = s.sum / float64(defined)
+}
+
+// StatsReport is the complete output of `phredsort stats`
+type StatsReport struct {
+	Reads   uint64          `json:"reads"`
+	Bases   uint64          `json:"bases"`
+	Metrics []MetricSummary `json:"metrics"`
+	Profile []PositionStats `json:"profile,omitempty"`
+}
+
+// StatsCommand creates the `stats` subcommand which summarizes per-read quality
+// metrics and, optionally, the per-position quality profile of the input
+func StatsCommand() *cobra.Command {
+	var (
+		inFiles    []string
+		duplicates string
+		outFile    string
+		metrics    string
+		minPhred   int
+		format     string
+		profile    bool
+		binWidth   int
+
+		metricsFile   string
+		metricsFormat string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Summarize per-read quality metrics and per-position quality profile",
+		Long: `Summarize per-read quality metrics (min, max, mean) of a FASTQ file.
+With --profile, a per-position quality profile is reported as well (mean, median
+and quartiles of Phred scores, fraction of low-quality bases, and mean expected
+error at each position), as a second TSV table after an empty line or as the
+"profile" key in JSON. Positions may be binned for long reads.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			parsedMetrics, err := parseHeaderMetrics(metrics)
+			if err != nil {
+				return err
+			}
+			if len(parsedMetrics) == 0 {
+				return fmt.Errorf("at least one metric is required")
+			}
+			if format != "tsv" && format != "json" {
+				return fmt.Errorf("invalid format '%s'. Must be one of: tsv, json", format)
+			}
+			if binWidth < 1 {
+				return fmt.Errorf("bin width must be a positive integer")
+			}
+
+			input, err := parseInput(cmd, inFiles, args, false, duplicates)
+			if err != nil {
+				return err
+			}
+
+			// Per-read metrics table (in addition to the summary)
+			var metricsOut *MetricsWriter
+			if metricsFile != "" {
+				metricsOut, err = NewRecordMetricsWriter(metricsFile, metricsFormat, parsedMetrics, defaultHeaderFormat)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = runStats(input, outFile, parsedMetrics, minPhred, format, profile, binWidth, metricsOut)
+			if metricsOut != nil {
+				if closeErr := metricsOut.Close(); err == nil {
+					err = closeErr
+				}
+			}
+			return err
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringArrayVarP(&inFiles, "in", "i", []string{"-"}, "Input FASTQ file; may be repeated, or files may be given as arguments (default: stdin)")
+	flags.StringVar(&duplicates, "duplicates", "ignore", "Check for sequence IDs occurring more than once in the input (ignore, warn, error)")
+	flags.StringVarP(&outFile, "out", "o", "-", "Output file for statistics (default: stdout)")
+	flags.StringVarP(&metrics, "metrics", "s", defaultStatsMetrics, "Comma-separated list of per-read metrics to summarize")
+	flags.IntVarP(&minPhred, "minphred", "p", DEFAULT_MIN_PHRED, "Quality threshold for 'lqcount' and 'lqpercent' metrics, and low-quality fraction in the profile")
+	flags.StringVarP(&format, "format", "f", "tsv", "Output format (tsv, json)")
+	flags.BoolVarP(&profile, "profile", "P", false, "Report per-position quality profile")
+	flags.IntVarP(&binWidth, "bin", "b", 1, "Number of consecutive positions per profile bin")
+	flags.StringVar(&metricsFile, "metrics-out", "", "Write the metrics of each read to this table")
+	flags.StringVar(&metricsFormat, "metrics-format", "tsv", "Format of the --metrics-out table (tsv, jsonl, parquet)")
+
+	return cmd
+}
+
+// runStats streams FASTQ records, accumulating per-read metric summaries and
+// (optionally) the per-position quality profile, and writes the report
+//
+// Parameters:
+//   - in: Input FASTQ files (use "-" for stdin), read as one
+//   - outFile: Output file path (use "-" for stdout)
+//   - metrics: Per-read metrics to summarize
+//   - minPhred: Minimum Phred threshold for lqcount/lqpercent and low-quality fraction
+//   - format: Output format ("tsv" or "json")
+//   - profile: If true, the per-position quality profile is computed
+//   - binWidth: Number of consecutive positions per profile bin
+//   - metricsOut: Optional table of the metrics of each read (nil = disabled)
+//
+// Returns an error if file I/O fails or the input is not FASTQ
+func runStats(in Input, outFile string, metrics []HeaderMetric, minPhred int, format string, profile bool, binWidth int, metricsOut *MetricsWriter) error {
+	reader, err := NewInputReader(in)
+	if err != nil {
+		return fmt.Errorf("error creating reader: %v", err)
+	}
+	closeReader := true
+	defer func() {
+		if closeReader {
+			reader.Close()
+		}
+	}()
+
+	report := &StatsReport{Metrics: make([]MetricSummary, len(metrics))}
+	qualityMetrics := make([]QualityMetric, len(metrics))
+	for i, hm := range metrics {
+		report.Metrics[i].Metric = hm.Name
+		if !hm.IsLength {
+			qualityMetrics[i], _ = validateMetric(hm.Name)
+		}
+	}
+
+	var qp *QualityProfile
+	if profile {
+		qp = NewQualityProfile(binWidth, minPhred)
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading record: %v", err)
+		}
+		if !reader.IsFastq {
+			closeReader = false
+			return fmt.Errorf(computedQualityFastqError)
+		}
+
+		report.Reads++
+		report.Bases += uint64(len(record.Seq.Seq))
+		for i, hm := range metrics {
+			if hm.IsLength {
+				report.Metrics[i].Add(float64(len(record.Seq.Seq)))
+				continue
+			}
+			report.Metrics[i].Add(calculateQuality(record, qualityMetrics[i], minPhred))
+		}
+		if qp != nil {
+			qp.Add(record.Seq.Qual)
+		}
+		if metricsOut != nil {
+			if err := metricsOut.WriteRecord(record, minPhred); err != nil {
+				return err
+			}
+		}
+	}
+
+	if qp != nil {
+		report.Profile = qp.Positions()
+	}
+
+	outfh, err := xopen.Wopen(outFile)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+	defer outfh.Close()
+
+	if format == "json" {
+		enc := json.NewEncoder(outfh)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	// With --profile, the profile table follows the summary (after an empty line)
+	if err := writeSummaryTSV(outfh, report.Metrics); err != nil || !profile {
+		return err
+	}
+	if _, err := fmt.Fprintln(outfh); err != nil {
+		return err
+	}
+	return writeProfileTSV(outfh, report.Profile)
+}
+
+// writeSummaryTSV writes per-read metric summaries as a tab-separated table
+func writeSummaryTSV(w io.Writer, summaries []MetricSummary) error {
+	if _, err := fmt.Fprintln(w, strings.Join([]string{"metric", "reads", "undefined", "min", "max", "mean"}, "\t")); err != nil {
+		return err
+	}
+	for _, s := range summaries {
+		if _, err := fmt.Fprintf(w, "%s\t%d\t%d\t%.6f\t%.6f\t%.6f\n", s.Metric, s.Reads, s.Undefined, s.Min, s.Max, s.Mean); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeProfileTSV writes the per-position quality profile as a tab-separated table
+func writeProfileTSV(w io.Writer, positions []PositionStats) error {
+	header := []string{"start", "end", "bases", "mean", "q1", "median", "q3", "lq_fraction", "mean_ee"}
+	if _, err := fmt.Fprintln(w, strings.Join(header, "\t")); err != nil {
+		return err
+	}
+	for _, ps := range positions {
+		if _, err := fmt.Fprintf(w, "%d\t%d\t%d\t%.6f\t%.6f\t%.6f\t%.6f\t%.6f\t%.6f\n",
+			ps.Start, ps.End, ps.Bases, ps.Mean, ps.Q1, ps.Median, ps.Q3, ps.LowQualFraction, ps.MeanEE); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func TestMetricSummarySkipsUndefined(t *testing.T) {
+	var s MetricSummary
+	s.Add(2)
+	s.Add(math.Inf(1))
+	s.Add(4)
+
+	if s.Reads != 3 || s.Undefined != 1 {
+		t.Fatalf("reads/undefined = %d/%d, want 3/1", s.Reads, s.Undefined)
+	}
+	if s.Min != 2 || s.Max != 4 || s.Mean != 3 {
+		t.Fatalf("min/max/mean = %v/%v/%v, want 2/4/3", s.Min, s.Max, s.Mean)
+	}
+}
+
+func TestRunStats(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("read1", "ACGT", "IIII"),
+		createTestRecord("read2", "AC", "++"),
+	})
+
+	t.Run("summary TSV", func(t *testing.T) {
+		outPath := filepath.Join(tmpDir, "summary.tsv")
+		metrics, _ := parseHeaderMetrics("avgphred,length")
+		if err := runStats(testInput(inputPath), outPath, metrics, DEFAULT_MIN_PHRED, "tsv", false, 1, nil); err != nil {
+			t.Fatalf("runStats() error = %v", err)
+		}
+		out, _ := os.ReadFile(outPath)
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		want := []string{
+			"metric\treads\tundefined\tmin\tmax\tmean",
+			"avgphred\t2\t0\t10.000000\t40.000000\t25.000000",
+			"length\t2\t0\t2.000000\t4.000000\t3.000000",
+		}
+		if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+			t.Fatalf("summary =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+		}
+	})
+
+	t.Run("profile JSON", func(t *testing.T) {
+		outPath := filepath.Join(tmpDir, "profile.json")
+		metrics, _ := parseHeaderMetrics("maxee")
+		if err := runStats(testInput(inputPath), outPath, metrics, DEFAULT_MIN_PHRED, "json", true, 2, nil); err != nil {
+			t.Fatalf("runStats() error = %v", err)
+		}
+		out, _ := os.ReadFile(outPath)
+		var report StatsReport
+		if err := json.Unmarshal(out, &report); err != nil {
+			t.Fatalf("invalid JSON output: %v", err)
+		}
+		if report.Reads != 2 || report.Bases != 6 {
+			t.Errorf("reads/bases = %d/%d, want 2/6", report.Reads, report.Bases)
+		}
+		if len(report.Profile) != 2 {
+			t.Fatalf("len(profile) = %d, want 2", len(report.Profile))
+		}
+		if report.Profile[0].Bases != 4 || report.Profile[0].LowQualFraction != 0.5 {
+			t.Errorf("profile bin 1 = %+v, want bases=4 lq_fraction=0.5", report.Profile[0])
+		}
+		if len(report.Metrics) != 1 || report.Metrics[0].Metric != "maxee" || report.Metrics[0].Reads != 2 {
+			t.Errorf("metrics = %+v, want the maxee summary", report.Metrics)
+		}
+	})
+
+	t.Run("summary and profile TSV", func(t *testing.T) {
+		outPath := filepath.Join(tmpDir, "profile.tsv")
+		metrics, _ := parseHeaderMetrics("length")
+		if err := runStats(testInput(inputPath), outPath, metrics, DEFAULT_MIN_PHRED, "tsv", true, 4, nil); err != nil {
+			t.Fatalf("runStats() error = %v", err)
+		}
+		out, _ := os.ReadFile(outPath)
+		want := "metric\treads\tundefined\tmin\tmax\tmean\n" +
+			"length\t2\t0\t2.000000\t4.000000\t3.000000\n\n" +
+			"start\tend\tbases\tmean\tq1\tmedian\tq3\tlq_fraction\tmean_ee\n"
+		if !strings.HasPrefix(string(out), want) || strings.Count(string(out), "\n") != 5 {
+			t.Errorf("output =\n%s\nwant the summary, an empty line and a profile of one bin", out)
+		}
+	})
+
+	t.Run("rejects FASTA", func(t *testing.T) {
+		fastaPath := filepath.Join(tmpDir, "input.fasta")
+		if err := os.WriteFile(fastaPath, []byte(">seq1\nACGT\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := runStats(testInput(fastaPath), filepath.Join(tmpDir, "out.tsv"), nil, DEFAULT_MIN_PHRED, "tsv", false, 1, nil)
+		if err == nil || !strings.Contains(err.Error(), computedQualityFastqError) {
+			t.Fatalf("runStats() error = %v, want FASTQ-only error", err)
+		}
+	})
+}
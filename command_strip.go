@@ -0,0 +1,124 @@
+// Subcommand (`phredsort strip`) for removing quality annotations from sequence headers
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// StripCommand creates the `strip` subcommand which removes the annotations
+// written by --header (e.g., " avgphred=35.2 maxee=0.1 length=250") from
+// sequence headers, for downstream tools that don't accept them
+func StripCommand() *cobra.Command {
+	var (
+		inFiles    []string
+		tagSource  bool
+		keepTags   string
+		duplicates string
+		outFile    string
+		seqFormat  string
+		lineWidth  int
+		keys       string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "strip",
+		Short: "Remove quality annotations from sequence headers",
+		Long: `Remove key=value annotations (by default, all metrics that phredsort can add
+to headers) in both space- and semicolon-separated form. The rest of the header
+and the order of records are left unchanged. Records are processed in a streaming
+fashion, so memory usage does not depend on the input size.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			parsedKeys, err := parseStripKeys(keys)
+			if err != nil {
+				return err
+			}
+			input, err := parseInput(cmd, inFiles, args, tagSource, duplicates)
+			if err != nil {
+				return err
+			}
+			if input.KeepTags, err = parseTagFilter(keepTags); err != nil {
+				return err
+			}
+
+			outFormat, err := parseOutputFormat(seqFormat, lineWidth)
+			if err != nil {
+				return err
+			}
+
+			return runStrip(input, outFile, parsedKeys, outFormat)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringArrayVarP(&inFiles, "in", "i", []string{"-"}, "Input FASTA/FASTQ file; may be repeated, or files may be given as arguments (default: stdin)")
+	flags.BoolVar(&tagSource, "tag-source", false, "Add the name of the input file to headers (file=<basename>)")
+	flags.StringVar(&keepTags, "keep-tags", "", "SAM/BAM input: comma-separated tags to keep in headers (e.g., 'RG,BC'; 'all' for all tags)")
+	flags.StringVar(&duplicates, "duplicates", "ignore", "Check for sequence IDs occurring more than once in the input (ignore, warn, error)")
+	flags.StringVarP(&outFile, "out", "o", "-", "Output FASTA/FASTQ file (default: stdout)")
+	flags.StringVar(&seqFormat, "out-format", "", "Output sequence format (fasta, fastq; default: same as input)")
+	flags.IntVar(&lineWidth, "line-width", 0, "Line width of FASTA sequences (0 = no wrapping)")
+	flags.StringVarP(&keys, "keys", "k", "avgphred,maxee,meep,lqcount,lqpercent,length", "Comma-separated list of header keys to remove")
+
+	return cmd
+}
+
+// parseStripKeys parses the comma-separated list of keys to remove from headers
+func parseStripKeys(keys string) ([]string, error) {
+	var result []string
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if !isHeaderKey(key) {
+			return nil, fmt.Errorf("invalid header key: %s", key)
+		}
+		result = append(result, key)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("at least one header key (--keys) is required")
+	}
+	return result, nil
+}
+
+// runStrip streams records from input to output, removing the annotations with
+// the given keys from each header (see StripAnnotations), in the sequence
+// format given by outFormat
+//
+// Returns an error if file I/O operations fail
+func runStrip(in Input, outFile string, keys []string, outFormat OutputFormat) error {
+	reader, err := NewInputReader(in)
+	if err != nil {
+		return fmt.Errorf("error creating reader: %v", err)
+	}
+	defer reader.Close()
+
+	outfh, err := xopen.Wopen(outFile)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+	defer outfh.Close()
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading record: %v", err)
+		}
+
+		record.Name = StripAnnotations(record.Name, keys)
+		if err := outFormat.WriteRecord(outfh, record, reader.IsFastq); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func TestStripAnnotations(t *testing.T) {
+	keys := []string{"avgphred", "maxee", "meep", "lqcount", "lqpercent", "length"}
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"Space-separated", "seq1 avgphred=35.000000 maxee=0.100000 length=4", "seq1"},
+		{"Description is kept", "seq1 sample=A avgphred=35.0 some text maxee=1", "seq1 sample=A some text"},
+		{"Semicolon-separated", "seq1;size=10;ee=0.5;maxee=0.5;length=4", "seq1;size=10;ee=0.5"},
+		{"Semicolon-separated with trailing semicolon", "seq1;size=10;maxee=0.5;length=4;", "seq1;size=10;"},
+		{"Only annotations after the ID", "seq1;maxee=0.5;", "seq1"},
+		{"Mixed separators", "seq1 maxee=1;size=2\tlength=5", "seq1 size=2"},
+		{"Semicolon after the ID delimiter", "seq1 maxee=1;size=2", "seq1 size=2"},
+		{"Mixed VSEARCH and space-separated", "id;size=3 maxee=0.1 sample=A", "id;size=3 sample=A"},
+		{"Space after a semicolon-separated annotation", "id;size=3;maxee=0.1 sample=A", "id;size=3 sample=A"},
+		{"Tab-separated", "id\tmaxee=0.1\tsample=A", "id\tsample=A"},
+		{"Duplicate keys", "seq1 maxee=1 maxee=2", "seq1"},
+		{"ID is never stripped", "maxee=1 length=4", "maxee=1"},
+		{"Similar keys are kept", "seq1 maxee2=1 xmaxee=2", "seq1 maxee2=1 xmaxee=2"},
+		{"VSEARCH header without annotations", "seq1;size=3;", "seq1;size=3;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(StripAnnotations([]byte(tt.header), keys))
+			if got != tt.want {
+				t.Errorf("StripAnnotations(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripAnnotationsRoundTrip(t *testing.T) {
+	keys := []string{"avgphred", "maxee", "length"}
+	for _, header := range []string{"seq1", "seq1 desc", "seq1;size=10;", "seq1;size=10"} {
+		for _, sep := range []string{"space", "semicolon"} {
+			format, err := parseHeaderFormat(sep, sep == "semicolon", "", 6, 0, "replace")
+			if err != nil {
+				t.Fatal(err)
+			}
+			annotated, err := format.Annotate([]byte(header), []HeaderAnnotation{{"avgphred", "35.0"}, {"maxee", "0.1"}, {"length", "4"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			annotatedStr := string(annotated)
+			got := string(StripAnnotations(annotated, keys))
+			if got != header && !(header == "seq1;size=10" && got == "seq1;size=10;") {
+				t.Errorf("strip(%q) = %q, want %q", annotatedStr, got, header)
+			}
+		}
+	}
+}
+
+func TestRunStrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	outputPath := filepath.Join(tmpDir, "output.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("seq2 avgphred=40.000000 length=4", "ACGT", "IIII"),
+		createTestRecord("seq1;size=3;ee=0.5;", "GG", "##"),
+	})
+
+	keys, err := parseStripKeys("avgphred, length,ee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runStrip(testInput(inputPath), outputPath, keys, OutputFormat{}); err != nil {
+		t.Fatalf("runStrip() error = %v", err)
+	}
+
+	got, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "@seq2\nACGT\n+\nIIII\n@seq1;size=3;\nGG\n+\n##\n"
+	if string(got) != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	if _, err := parseStripKeys("maxee,bad-key"); err == nil {
+		t.Error("parseStripKeys() accepted an invalid key")
+	}
+}
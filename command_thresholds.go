@@ -0,0 +1,103 @@
+// Subcommand (`phredsort thresholds`) for recommending quality cutoffs
+// that retain a given fraction of reads or bases
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// ThresholdsCommand creates the `thresholds` subcommand which reports the
+// metric value needed to retain each requested fraction of reads or bases.
+// The reported values can be passed directly to --minqual (for metrics where
+// higher is better) or --maxqual (for metrics where lower is better)
+func ThresholdsCommand() *cobra.Command {
+	var (
+		inFiles    []string
+		duplicates string
+		metric     string
+		minPhred   int
+		keepReads  []float64
+		keepBases  []float64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "thresholds",
+		Short: "Recommend quality thresholds for target fractions of retained reads or bases",
+		Long: `Stream the input once and report, for each retention target, the quality metric
+cutoff that keeps at least the requested fraction of reads (--keep-reads) or
+bases (--keep-bases). The metric direction is taken into account: cutoffs for
+avgphred are meant for --minqual, and cutoffs for the other metrics for --maxqual.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			qualityMetric, err := validateMetric(metric)
+			if err != nil {
+				return err
+			}
+			if len(keepReads) == 0 && len(keepBases) == 0 {
+				return fmt.Errorf("at least one retention target (--keep-reads or --keep-bases) is required")
+			}
+			for _, f := range append(append([]float64{}, keepReads...), keepBases...) {
+				if f <= 0 || f > 1 {
+					return fmt.Errorf("retention targets must be fractions in (0, 1], got %g", f)
+				}
+			}
+
+			input, err := parseInput(cmd, inFiles, args, false, duplicates)
+			if err != nil {
+				return err
+			}
+
+			return runThresholds(os.Stdout, input, qualityMetric, minPhred, keepReads, keepBases)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringArrayVarP(&inFiles, "in", "i", []string{"-"}, "Input FASTQ file; may be repeated, or files may be given as arguments (default: stdin)")
+	flags.StringVar(&duplicates, "duplicates", "ignore", "Check for sequence IDs occurring more than once in the input (ignore, warn, error)")
+	flags.StringVarP(&metric, "metric", "s", "avgphred", "Quality metric (avgphred, maxee, meep, lqcount, lqpercent)")
+	flags.IntVarP(&minPhred, "minphred", "p", DEFAULT_MIN_PHRED, "Quality threshold for 'lqcount' and 'lqpercent' metrics")
+	flags.Float64SliceVarP(&keepReads, "keep-reads", "r", nil, "Comma-separated fractions of reads to retain (e.g., '0.9,0.8')")
+	flags.Float64SliceVarP(&keepBases, "keep-bases", "b", nil, "Comma-separated fractions of bases to retain (e.g., '0.9')")
+
+	return cmd
+}
+
+// runThresholds collects the metric distribution of the input and writes
+// a tab-separated table with a recommended cutoff for each retention target
+//
+// Returns an error if file I/O fails or the input is not FASTQ
+func runThresholds(w io.Writer, in Input, metric QualityMetric, minPhred int, keepReads, keepBases []float64) error {
+	observations, err := collectMetricObservations(in, metric, minPhred)
+	if err != nil {
+		return err
+	}
+	sortObservationsBestFirst(observations, metric)
+
+	var recs []ThresholdRecommendation
+	for _, f := range keepReads {
+		recs = append(recs, recommendThreshold(observations, metric, f, false))
+	}
+	for _, f := range keepBases {
+		recs = append(recs, recommendThreshold(observations, metric, f, true))
+	}
+
+	fmt.Fprintln(w, "target\tfraction\tthreshold\tflag\treads_kept\treads_fraction\tbases_kept\tbases_fraction")
+	for _, rec := range recs {
+		threshold := "NA"
+		if rec.Reachable {
+			// Full precision, so that the value can be used as a filter without rounding issues
+			threshold = strconv.FormatFloat(rec.Threshold, 'g', -1, 64)
+		}
+		fmt.Fprintf(w, "%s\t%g\t%s\t%s\t%d\t%.6f\t%d\t%.6f\n",
+			rec.Target, rec.Fraction, threshold, rec.Flag,
+			rec.Retention.Reads, rec.Retention.ReadFraction(),
+			rec.Retention.Bases, rec.Retention.BaseFraction())
+	}
+
+	return nil
+}
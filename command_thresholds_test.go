@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func TestRecommendThreshold(t *testing.T) {
+	observations := []MetricObservation{
+		{Value: 0.1, Length: 100},
+		{Value: 2.0, Length: 10},
+		{Value: 0.5, Length: 50},
+		{Value: 0.5, Length: 40},
+		{Value: math.Inf(1), Length: 0},
+		{Value: 1.0, Length: 100},
+		{Value: 0.2, Length: 100},
+		{Value: 0.3, Length: 100},
+		{Value: 0.4, Length: 100},
+		{Value: 3.0, Length: 100},
+	}
+	sortObservationsBestFirst(observations, MaxEE)
+
+	tests := []struct {
+		name          string
+		fraction      float64
+		byBases       bool
+		wantThreshold float64
+		wantReads     uint64
+		wantReachable bool
+	}{
+		{"70% of reads", 0.7, false, 1.0, 7, true},
+		{"50% of reads", 0.5, false, 0.5, 6, true}, // ties at 0.5 are kept together
+		{"50% of bases", 0.5, true, 0.4, 4, true},
+		{"100% of reads is unreachable due to infinite maxEE", 1.0, false, 0, 0, false},
+		{"100% of bases is reachable (empty read has no bases)", 1.0, true, 3.0, 9, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := recommendThreshold(observations, MaxEE, tt.fraction, tt.byBases)
+			if rec.Reachable != tt.wantReachable {
+				t.Fatalf("Reachable = %v, want %v", rec.Reachable, tt.wantReachable)
+			}
+			if rec.Threshold != tt.wantThreshold || rec.Retention.Reads != tt.wantReads {
+				t.Errorf("threshold/reads = %v/%d, want %v/%d", rec.Threshold, rec.Retention.Reads, tt.wantThreshold, tt.wantReads)
+			}
+			if rec.Flag != "--maxqual" {
+				t.Errorf("Flag = %q, want --maxqual", rec.Flag)
+			}
+		})
+	}
+
+	// Higher is better: the cutoff is a minimum
+	finite := observations[:len(observations)-1]
+	sortObservationsBestFirst(finite, AvgPhred)
+	rec := recommendThreshold(finite, AvgPhred, 0.2, false)
+	if rec.Flag != "--minqual" || rec.Threshold != 2.0 {
+		t.Errorf("avgphred recommendation = %s %v, want --minqual 2", rec.Flag, rec.Threshold)
+	}
+}
+
+func TestRunThresholds(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("read1", "ACGT", "IIII"),
+		createTestRecord("read2", "ACGT", "++++"),
+		createTestRecord("read3", "ACGTACGT", "55555555"),
+	})
+
+	var buf bytes.Buffer
+	if err := runThresholds(&buf, testInput(inputPath), AvgPhred, DEFAULT_MIN_PHRED, []float64{0.5}, []float64{0.9}); err != nil {
+		t.Fatalf("runThresholds() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		"target\tfraction\tthreshold\tflag\treads_kept\treads_fraction\tbases_kept\tbases_fraction",
+		"reads\t0.5\t20\t--minqual\t2\t0.666667\t12\t0.750000",
+		"bases\t0.9\t9.999999999999998\t--minqual\t3\t1.000000\t16\t1.000000",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("runThresholds() output =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
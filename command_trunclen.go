@@ -0,0 +1,352 @@
+// Subcommand (`phredsort trunclen`) for choosing a truncation length together with a maxEE cutoff
+// (e.g., for DADA2 `truncLen`/`maxEE` or VSEARCH `--fastq_trunclen`/`--fastq_maxee`)
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// Default minimum overlap of truncated read pairs (same as in DADA2 mergePairs)
+const defaultMinOverlap = 12
+
+// TruncLenRow is the retention at a single candidate truncation length (or pair of lengths)
+type TruncLenRow struct {
+	Length1  int
+	Length2  int // 0 for single-end data
+	Reads    uint64
+	Fraction float64
+	Score    float64 // retained reads x total truncated length
+}
+
+// TruncLenCommand creates the `trunclen` subcommand which evaluates every
+// candidate truncation length for the fraction of reads whose truncated
+// prefix passes a maxEE cutoff, and recommends the length that maximizes
+// the number of retained reads multiplied by the truncation length
+func TruncLenCommand() *cobra.Command {
+	var (
+		inFiles     []string
+		inFiles2    []string
+		outFile     string
+		maxEE       float64
+		minLength   int
+		ampliconLen int
+		minOverlap  int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "trunclen",
+		Short: "Recommend a truncation length for a given maxEE cutoff (single-end or paired-end)",
+		Long: `For every candidate truncation length, compute the fraction of reads whose truncated
+prefix passes the maxEE cutoff (reads shorter than the truncation length are discarded).
+The length that maximizes retained reads x length is recommended. For paired-end data
+(--in2), both mates must pass, and with --amplicon-length the truncated mates must
+overlap by at least --min-overlap bases.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if maxEE < 0 {
+				return fmt.Errorf("maxEE cutoff must be non-negative")
+			}
+			if minLength < 1 {
+				return fmt.Errorf("minimum truncation length must be a positive integer")
+			}
+			paired := len(inFiles2) > 0
+			if ampliconLen > 0 && !paired {
+				return fmt.Errorf("--amplicon-length requires paired-end input (--in2)")
+			}
+
+			input, err := parseInput(cmd, inFiles, args, false, "ignore")
+			if err != nil {
+				return err
+			}
+
+			var rows []TruncLenRow
+			if !paired {
+				rows, err = truncLenSingle(input, maxEE, minLength)
+			} else {
+				// R2 files are paired with R1 files in the order given
+				var input2 Input
+				input2.Files, err = expandInputFiles(inFiles2)
+				if err == nil && len(input2.Files) != len(input.Files) {
+					err = fmt.Errorf("--in2 requires as many files as --in (%d R1 files, %d R2 files)", len(input.Files), len(input2.Files))
+				}
+				if err == nil {
+					rows, err = truncLenPaired(input, input2, maxEE, minLength, ampliconLen, minOverlap)
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			outfh, err := xopen.Wopen(outFile)
+			if err != nil {
+				return fmt.Errorf("error creating output file: %v", err)
+			}
+			defer outfh.Close()
+
+			writeTruncLenTable(outfh, rows, paired)
+			reportTruncLenRecommendation(rows, maxEE, paired)
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringArrayVarP(&inFiles, "in", "i", []string{"-"}, "Input FASTQ file (R1 for paired-end data); may be repeated, or files may be given as arguments (default: stdin)")
+	flags.StringArrayVarP(&inFiles2, "in2", "I", nil, "Input FASTQ file with R2 reads (enables paired-end mode); may be repeated, in the order of --in")
+	flags.StringVarP(&outFile, "out", "o", "-", "Output table (default: stdout)")
+	flags.Float64VarP(&maxEE, "maxee", "e", 2, "Maximum expected error of the truncated read")
+	flags.IntVarP(&minLength, "min-length", "l", 1, "Minimum truncation length to evaluate")
+	flags.IntVarP(&ampliconLen, "amplicon-length", "A", 0, "Expected amplicon length for the overlap constraint (paired-end only; 0 = no constraint)")
+	flags.IntVarP(&minOverlap, "min-overlap", "O", defaultMinOverlap, "Minimum overlap of truncated mates (used with --amplicon-length)")
+
+	return cmd
+}
+
+// maxPassingPrefix returns the largest prefix length L such that the expected
+// number of errors in qual[:L] (i.e., calculateMaxEE(qual[:L])) does not exceed maxEE.
+// Since maxEE of a prefix never decreases with length, all shorter prefixes pass as well
+func maxPassingPrefix(qual []byte, maxEE float64) int {
+	var ee float64
+	for i, q := range qual {
+		ee += errorProbs[q]
+		if ee > maxEE {
+			return i
+		}
+	}
+	return len(qual)
+}
+
+// readFastqRecord reads the next record and checks that the input is FASTQ.
+// Returns io.EOF at the end of input. As elsewhere, a reader that turned out
+// not to be FASTQ is not returned to the pool (closeReader is set to false)
+func readFastqRecord(reader *InputReader, closeReader *bool) (*fastx.Record, error) {
+	record, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error reading record: %v", err)
+	}
+	if !reader.IsFastq {
+		*closeReader = false
+		return nil, fmt.Errorf(computedQualityFastqError)
+	}
+	return record, nil
+}
+
+// truncLenSingle evaluates candidate truncation lengths for single-end reads
+func truncLenSingle(in Input, maxEE float64, minLength int) ([]TruncLenRow, error) {
+	reader, err := NewInputReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("error creating reader: %v", err)
+	}
+	closeReader := true
+	defer func() {
+		if closeReader {
+			reader.Close()
+		}
+	}()
+
+	// passCounts[L] = number of reads whose longest passing prefix is exactly L
+	var passCounts []uint64
+	var total uint64
+	for {
+		record, err := readFastqRecord(reader, &closeReader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		total++
+		l := maxPassingPrefix(record.Seq.Qual, maxEE)
+		for len(passCounts) <= l {
+			passCounts = append(passCounts, 0)
+		}
+		passCounts[l]++
+	}
+
+	// A read is retained at length L if its longest passing prefix is >= L
+	var rows []TruncLenRow
+	var retained uint64
+	for l := len(passCounts) - 1; l >= minLength; l-- {
+		retained += passCounts[l]
+		rows = append(rows, newTruncLenRow(l, 0, retained, total))
+	}
+
+	// Report in order of increasing length
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+	return rows, nil
+}
+
+// mateID returns the sequence ID of a paired read, without a "/1" or "/2" suffix
+func mateID(record *fastx.Record) string {
+	id := recordID(record)
+	if strings.HasSuffix(id, "/1") || strings.HasSuffix(id, "/2") {
+		id = id[:len(id)-2]
+	}
+	return id
+}
+
+// truncLenPaired evaluates pairs of truncation lengths for paired-end reads.
+// A pair is retained at (L1, L2) if both mates pass the maxEE cutoff when truncated.
+// With ampliconLen > 0, only length pairs with L1 + L2 >= ampliconLen + minOverlap
+// are considered. For each L1, the row with the best-scoring L2 is reported
+func truncLenPaired(in1, in2 Input, maxEE float64, minLength, ampliconLen, minOverlap int) ([]TruncLenRow, error) {
+	reader1, err := NewInputReader(in1)
+	if err != nil {
+		return nil, fmt.Errorf("error creating reader: %v", err)
+	}
+	closeReader1 := true
+	defer func() {
+		if closeReader1 {
+			reader1.Close()
+		}
+	}()
+	reader2, err := NewInputReader(in2)
+	if err != nil {
+		return nil, fmt.Errorf("error creating reader: %v", err)
+	}
+	closeReader2 := true
+	defer func() {
+		if closeReader2 {
+			reader2.Close()
+		}
+	}()
+
+	// Sparse counts of (longest passing R1 prefix, longest passing R2 prefix)
+	pairCounts := make(map[[2]int]uint64)
+	var total uint64
+	max1, max2 := 0, 0
+	for {
+		record1, err1 := readFastqRecord(reader1, &closeReader1)
+		record2, err2 := readFastqRecord(reader2, &closeReader2)
+		if err1 == io.EOF && err2 == io.EOF {
+			break
+		}
+		if err1 == io.EOF || err2 == io.EOF {
+			more := "R2"
+			if err2 == io.EOF {
+				more = "R1"
+			}
+			return nil, fmt.Errorf("paired input files contain different numbers of reads (%s has more than %d reads)", more, total)
+		}
+		if err1 != nil {
+			return nil, err1
+		}
+		if err2 != nil {
+			return nil, err2
+		}
+		if id1, id2 := mateID(record1), mateID(record2); id1 != id2 {
+			return nil, fmt.Errorf("paired reads are out of sync: R1 read %s doesn't match R2 read %s (pair %d)", id1, id2, total+1)
+		}
+
+		total++
+		l1 := maxPassingPrefix(record1.Seq.Qual, maxEE)
+		l2 := maxPassingPrefix(record2.Seq.Qual, maxEE)
+		pairCounts[[2]int{l1, l2}]++
+		max1, max2 = max(max1, l1), max(max2, l2)
+	}
+
+	// retained[l1][l2] = number of pairs with passing prefixes >= (l1, l2) (2D suffix sums)
+	retained := make([][]uint64, max1+2)
+	for i := range retained {
+		retained[i] = make([]uint64, max2+2)
+	}
+	for key, n := range pairCounts {
+		retained[key[0]][key[1]] += n
+	}
+	for l1 := max1; l1 >= 0; l1-- {
+		for l2 := max2; l2 >= 0; l2-- {
+			retained[l1][l2] += retained[l1+1][l2] + retained[l1][l2+1] - retained[l1+1][l2+1]
+		}
+	}
+
+	var rows []TruncLenRow
+	for l1 := minLength; l1 <= max1; l1++ {
+		var best TruncLenRow
+		found := false
+		for l2 := minLength; l2 <= max2; l2++ {
+			if ampliconLen > 0 && l1+l2 < ampliconLen+minOverlap {
+				continue
+			}
+			row := newTruncLenRow(l1, l2, retained[l1][l2], total)
+			if !found || row.Score >= best.Score {
+				best = row
+				found = true
+			}
+		}
+		if found {
+			rows = append(rows, best)
+		}
+	}
+
+	return rows, nil
+}
+
+func newTruncLenRow(l1, l2 int, retained, total uint64) TruncLenRow {
+	row := TruncLenRow{
+		Length1: l1,
+		Length2: l2,
+		Reads:   retained,
+		Score:   float64(retained) * float64(l1+l2),
+	}
+	if total > 0 {
+		row.Fraction = float64(retained) / float64(total)
+	}
+	return row
+}
+
+// bestTruncLen returns the index of the row with the highest score
+// (the longest length wins in case of ties), or -1 if there are no rows
+func bestTruncLen(rows []TruncLenRow) int {
+	best := -1
+	for i, row := range rows {
+		if best < 0 || row.Score >= rows[best].Score {
+			best = i
+		}
+	}
+	return best
+}
+
+// writeTruncLenTable writes candidate truncation lengths as a tab-separated table
+func writeTruncLenTable(w io.Writer, rows []TruncLenRow, paired bool) {
+	if paired {
+		fmt.Fprintln(w, "trunclen_r1\ttrunclen_r2\tpairs_retained\tfraction\tscore")
+	} else {
+		fmt.Fprintln(w, "trunclen\treads_retained\tfraction\tscore")
+	}
+	for _, row := range rows {
+		if paired {
+			fmt.Fprintf(w, "%d\t%d\t%d\t%.6f\t%.0f\n", row.Length1, row.Length2, row.Reads, row.Fraction, row.Score)
+		} else {
+			fmt.Fprintf(w, "%d\t%d\t%.6f\t%.0f\n", row.Length1, row.Reads, row.Fraction, row.Score)
+		}
+	}
+}
+
+// reportTruncLenRecommendation prints the recommended truncation length(s) to stderr
+func reportTruncLenRecommendation(rows []TruncLenRow, maxEE float64, paired bool) {
+	best := bestTruncLen(rows)
+	if best < 0 {
+		fmt.Fprintln(os.Stderr, yellow("Warning: no truncation length satisfies the constraints"))
+		return
+	}
+	row := rows[best]
+	if paired {
+		fmt.Fprintf(os.Stderr, "%s R1=%d, R2=%d (%.2f%% of pairs retained with maxEE <= %g)\n",
+			bold("Recommended truncation lengths:"), row.Length1, row.Length2, 100*row.Fraction, maxEE)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s %d (%.2f%% of reads retained with maxEE <= %g)\n",
+		bold("Recommended truncation length:"), row.Length1, 100*row.Fraction, maxEE)
+}
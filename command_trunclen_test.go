@@ -0,0 +1,113 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func TestMaxPassingPrefix(t *testing.T) {
+	tests := []struct {
+		qual  string
+		maxEE float64
+		want  int
+	}{
+		{"IIII", 1, 4},
+		{"++++", 0.25, 2}, // 0.1 per base
+		{"!III", 0.5, 0},  // first base alone has EE=1
+		{"", 1, 0},
+	}
+	for _, tt := range tests {
+		if got := maxPassingPrefix([]byte(tt.qual), tt.maxEE); got != tt.want {
+			t.Errorf("maxPassingPrefix(%q, %v) = %d, want %d", tt.qual, tt.maxEE, got, tt.want)
+		}
+		// Consistency with calculateMaxEE applied to prefixes
+		if tt.want > 0 && calculateMaxEE([]byte(tt.qual[:tt.want])) > tt.maxEE {
+			t.Errorf("prefix of length %d of %q exceeds maxEE", tt.want, tt.qual)
+		}
+	}
+}
+
+func TestTruncLenSingle(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("read1", "ACGT", "IIII"), // passes at any length
+		createTestRecord("read2", "ACGT", "II++"), // passes up to 3 with maxEE 0.15
+		createTestRecord("read3", "AC", "II"),     // too short for L > 2
+	})
+
+	rows, err := truncLenSingle(testInput(inputPath), 0.15, 2)
+	if err != nil {
+		t.Fatalf("truncLenSingle() error = %v", err)
+	}
+	var gotLengths []int
+	var gotReads []uint64
+	for _, row := range rows {
+		gotLengths = append(gotLengths, row.Length1)
+		gotReads = append(gotReads, row.Reads)
+	}
+	if !reflect.DeepEqual(gotLengths, []int{2, 3, 4}) || !reflect.DeepEqual(gotReads, []uint64{3, 2, 1}) {
+		t.Fatalf("lengths/reads = %v/%v, want [2 3 4]/[3 2 1]", gotLengths, gotReads)
+	}
+	// Scores: 2*3=6, 3*2=6, 4*1=4; ties are resolved in favour of the longer length
+	if best := rows[bestTruncLen(rows)]; best.Length1 != 3 {
+		t.Errorf("recommended length = %d, want 3", best.Length1)
+	}
+}
+
+func TestTruncLenPaired(t *testing.T) {
+	tmpDir := t.TempDir()
+	r1 := filepath.Join(tmpDir, "R1.fastq")
+	r2 := filepath.Join(tmpDir, "R2.fastq")
+	writeFastqRecords(t, r1, []*fastx.Record{
+		createTestRecord("pair1", "ACGT", "IIII"),
+		createTestRecord("pair2", "ACGT", "II++"),
+	})
+	writeFastqRecords(t, r2, []*fastx.Record{
+		createTestRecord("pair1", "ACG", "II+"),
+		createTestRecord("pair2", "ACG", "III"),
+	})
+
+	rows, err := truncLenPaired(testInput(r1), testInput(r2), 0.15, 1, 0, 0)
+	if err != nil {
+		t.Fatalf("truncLenPaired() error = %v", err)
+	}
+	// Best R2 length for each R1 length
+	want := []TruncLenRow{
+		{Length1: 1, Length2: 3, Reads: 2, Fraction: 1, Score: 8},
+		{Length1: 2, Length2: 3, Reads: 2, Fraction: 1, Score: 10},
+		{Length1: 3, Length2: 3, Reads: 2, Fraction: 1, Score: 12},
+		{Length1: 4, Length2: 3, Reads: 1, Fraction: 0.5, Score: 7},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %+v, want %+v", rows, want)
+	}
+
+	// Overlap constraint: L1 + L2 >= 6 + 1
+	rows, err = truncLenPaired(testInput(r1), testInput(r2), 0.15, 1, 6, 1)
+	if err != nil {
+		t.Fatalf("truncLenPaired() error = %v", err)
+	}
+	for _, row := range rows {
+		if row.Length1+row.Length2 < 7 {
+			t.Errorf("row %+v violates the overlap constraint", row)
+		}
+	}
+
+	// Unequal numbers of reads
+	writeFastqRecords(t, r2, []*fastx.Record{createTestRecord("pair1", "ACG", "III")})
+	if _, err := truncLenPaired(testInput(r1), testInput(r2), 0.15, 1, 0, 0); err == nil || !strings.Contains(err.Error(), "different numbers of reads") {
+		t.Fatalf("truncLenPaired() error = %v, want unequal read count error", err)
+	}
+
+	// Mates with /1 and /2 suffixes match, reads of different pairs don't
+	writeFastqRecords(t, r1, []*fastx.Record{createTestRecord("pair1/1", "ACGT", "IIII"), createTestRecord("pair2/1", "ACGT", "IIII")})
+	writeFastqRecords(t, r2, []*fastx.Record{createTestRecord("pair1/2 x", "ACG", "III"), createTestRecord("pair3/2", "ACG", "III")})
+	if _, err := truncLenPaired(testInput(r1), testInput(r2), 0.15, 1, 0, 0); err == nil || !strings.Contains(err.Error(), "R1 read pair2 doesn't match R2 read pair3") {
+		t.Fatalf("truncLenPaired() error = %v, want out-of-sync error", err)
+	}
+}
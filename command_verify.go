@@ -0,0 +1,253 @@
+// Subcommand (`phredsort verify`) for checking that quality metrics annotated
+// in sequence headers still match the base qualities of the records
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// VerifyCommand creates the `verify` subcommand which recomputes the metrics
+// annotated in FASTQ headers (e.g., after trimming, which changes the qualities
+// but not the header) and reports the annotations that are out of date
+func VerifyCommand() *cobra.Command {
+	var (
+		inFiles       []string
+		tagSource     bool
+		keepTags      string
+		duplicates    string
+		outFile       string
+		seqFormat     string
+		lineWidth     int
+		headerMetrics string
+		headerAliases string
+		minPhred      int
+		tolerance     float64
+		relTolerance  float64
+		fixFile       string
+		headerPrec    int
+		headerDigits  int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check header quality annotations against recomputed metrics",
+		Long: `Recompute every quality metric annotated in the FASTQ headers from the base
+qualities and report the annotations that differ by more than the tolerance.
+The command fails if any stale annotation is found, unless --fix is used
+to write a copy of the input with the stale annotations rewritten.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			parsedHeaderMetrics, err := parseHeaderMetrics(headerMetrics)
+			if err != nil {
+				return err
+			}
+			if len(parsedHeaderMetrics) == 0 {
+				return fmt.Errorf("at least one metric to verify (--header) is required")
+			}
+			if tolerance < 0 || relTolerance < 0 {
+				return fmt.Errorf("tolerances must be non-negative")
+			}
+			if fixFile == "-" && outFile == "-" {
+				return fmt.Errorf("--fix and --out can't both write to stdout")
+			}
+			// Rewritten values only replace existing annotations, so the separator doesn't matter
+			headerFormat, err := parseHeaderFormat("space", false, headerAliases, headerPrec, headerDigits, "replace")
+			if err != nil {
+				return err
+			}
+
+			input, err := parseInput(cmd, inFiles, args, tagSource, duplicates)
+			if err != nil {
+				return err
+			}
+			if input.KeepTags, err = parseTagFilter(keepTags); err != nil {
+				return err
+			}
+
+			outFormat, err := parseOutputFormat(seqFormat, lineWidth)
+			if err != nil {
+				return err
+			}
+
+			summary, err := runVerify(input, outFile, fixFile, parsedHeaderMetrics, headerFormat, minPhred, tolerance, relTolerance, outFormat)
+			if err != nil {
+				return err
+			}
+			summary.Write(os.Stderr)
+
+			// Stale annotations are a verification result, not a usage error
+			if summary.Mismatches > 0 && fixFile == "" {
+				fmt.Fprintln(os.Stderr, red(fmt.Sprintf("Error: %d header annotations do not match the base qualities", summary.Mismatches)))
+				exitFunc(1)
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringArrayVarP(&inFiles, "in", "i", []string{"-"}, "Input FASTQ file; may be repeated, or files may be given as arguments (default: stdin)")
+	flags.BoolVar(&tagSource, "tag-source", false, "Add the name of the input file to headers (file=<basename>)")
+	flags.StringVar(&keepTags, "keep-tags", "", "SAM/BAM input: comma-separated tags to keep in headers (e.g., 'RG,BC'; 'all' for all tags)")
+	flags.StringVar(&duplicates, "duplicates", "ignore", "Check for sequence IDs occurring more than once in the input (ignore, warn, error)")
+	flags.StringVarP(&outFile, "out", "o", "-", "Output table of mismatched annotations (default: stdout)")
+	flags.StringVarP(&headerMetrics, "header", "H", "avgphred,maxee,meep,lqcount,lqpercent,length", "Comma-separated list of header metrics to verify")
+	flags.StringVar(&headerAliases, "header-alias", "", "Comma-separated metric=key aliases used in headers (e.g., 'maxee=ee')")
+	flags.IntVarP(&minPhred, "minphred", "p", DEFAULT_MIN_PHRED, "Quality threshold for 'lqcount' and 'lqpercent' metrics")
+	flags.Float64VarP(&tolerance, "tolerance", "t", 0.001, "Absolute tolerance of header values")
+	flags.Float64Var(&relTolerance, "rel-tolerance", 0.005, "Relative tolerance of header values")
+	flags.StringVar(&fixFile, "fix", "", "Write all records to this file, with stale annotations rewritten")
+	flags.StringVar(&seqFormat, "out-format", "", "Sequence format of the --fix output (fasta, fastq; default: fastq)")
+	flags.IntVar(&lineWidth, "line-width", 0, "Line width of FASTA sequences (0 = no wrapping)")
+	flags.IntVar(&headerPrec, "header-precision", 6, "Number of decimal places of rewritten values")
+	flags.IntVar(&headerDigits, "header-digits", 0, "Number of significant digits of rewritten values (overrides --header-precision)")
+
+	return cmd
+}
+
+// VerifySummary counts the header annotations checked by `phredsort verify`
+type VerifySummary struct {
+	Records      int // Records read
+	Annotations  int // Annotations checked
+	Mismatches   int // Annotations that differ from the recomputed values
+	StaleRecords int // Records with at least one mismatch
+}
+
+// Write prints the summary in a human-readable form
+func (s VerifySummary) Write(w io.Writer) {
+	fmt.Fprintf(w, "%s %d annotations in %d records checked; %d mismatches in %d records\n",
+		bold("Verified:"), s.Annotations, s.Records, s.Mismatches, s.StaleRecords)
+}
+
+// valuesMatch reports whether a header value agrees with the recomputed one,
+// either within the absolute or within the relative tolerance
+func valuesMatch(header, computed, tolerance, relTolerance float64) bool {
+	if header == computed {
+		return true // including infinities (e.g., maxee of empty reads)
+	}
+	diff := math.Abs(header - computed)
+	return diff <= tolerance || diff <= relTolerance*math.Abs(computed)
+}
+
+// runVerify compares the metrics annotated in the headers with the metrics
+// recomputed from the base qualities, and writes a tab-separated table of
+// mismatched annotations to outFile. Annotations with malformed values are
+// reported as mismatches. Metrics absent from a header are not checked
+//
+// If fixFile is not empty, all records are written to it, with mismatched
+// annotations replaced by the recomputed values (formatted with headerFormat),
+// in the sequence format given by outFormat
+//
+// Returns an error if file I/O fails or the input is not FASTQ
+func runVerify(
+	in Input,
+	outFile, fixFile string,
+	headerMetrics []HeaderMetric,
+	headerFormat HeaderFormat,
+	minPhred int,
+	tolerance, relTolerance float64,
+	outFormat OutputFormat,
+) (VerifySummary, error) {
+	var summary VerifySummary
+
+	reader, err := NewInputReader(in)
+	if err != nil {
+		return summary, fmt.Errorf("error creating reader: %v", err)
+	}
+	closeReader := true
+	defer func() {
+		if closeReader {
+			reader.Close()
+		}
+	}()
+
+	outfh, err := xopen.Wopen(outFile)
+	if err != nil {
+		return summary, fmt.Errorf("error creating output file: %v", err)
+	}
+	defer outfh.Close()
+
+	var fixfh *xopen.Writer
+	if fixFile != "" {
+		fixfh, err = xopen.Wopen(fixFile)
+		if err != nil {
+			return summary, fmt.Errorf("error creating output file: %v", err)
+		}
+		defer fixfh.Close()
+	}
+
+	fmt.Fprintln(outfh, "id\tkey\theader\tcomputed\tdifference")
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return summary, fmt.Errorf("error reading record: %v", err)
+		}
+		if !reader.IsFastq {
+			closeReader = false
+			return summary, fmt.Errorf(computedQualityFastqError)
+		}
+
+		summary.Records++
+		parsed := parseHeaderFields(string(record.Name))
+		var stale []HeaderAnnotation
+
+		for _, hm := range headerMetrics {
+			key := headerFormat.Key(hm.Name)
+			raw, found := parsed.Lookup(key)
+			if !found {
+				continue
+			}
+			summary.Annotations++
+
+			var computed float64
+			var value string
+			if hm.IsLength {
+				computed = float64(len(record.Seq.Seq))
+				value = strconv.Itoa(len(record.Seq.Seq))
+			} else {
+				computed = headerMetricValue(record, hm.Name, minPhred)
+				value = headerFormat.FormatValue(computed)
+			}
+
+			difference := "NA"
+			if v, err := strconv.ParseFloat(raw, 64); err == nil {
+				if valuesMatch(v, computed, tolerance, relTolerance) {
+					continue
+				}
+				difference = strconv.FormatFloat(v-computed, 'g', 6, 64)
+			}
+
+			summary.Mismatches++
+			stale = append(stale, HeaderAnnotation{key, value})
+			fmt.Fprintf(outfh, "%s\t%s\t%s\t%s\t%s\n", parsed.ID, key, raw, strconv.FormatFloat(computed, 'g', -1, 64), difference)
+		}
+
+		if len(stale) > 0 {
+			summary.StaleRecords++
+		}
+		if fixfh != nil {
+			if len(stale) > 0 {
+				name, err := headerFormat.Annotate(record.Name, stale)
+				if err != nil {
+					return summary, err
+				}
+				record.Name = name
+			}
+			if err := outFormat.WriteRecord(fixfh, record, reader.IsFastq); err != nil {
+				return summary, err
+			}
+		}
+	}
+
+	return summary, nil
+}
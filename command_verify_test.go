@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func TestValuesMatch(t *testing.T) {
+	tests := []struct {
+		header, computed float64
+		want             bool
+	}{
+		{0.5, 0.5, true},
+		{0.1234, 0.12345, true}, // within the absolute tolerance
+		{1000.4, 1000.0, true},  // within the relative tolerance
+		{2.5, 2.004749, false},  // e.g., qualities changed by trimming
+		{1e-05, 1.1e-05, true},  // tiny values are compared in absolute terms
+		{37.0, 38.0, false},
+	}
+	for _, tt := range tests {
+		if got := valuesMatch(tt.header, tt.computed, 0.001, 0.001); got != tt.want {
+			t.Errorf("valuesMatch(%v, %v) = %v, want %v", tt.header, tt.computed, got, tt.want)
+		}
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	records := []*fastx.Record{
+		createTestRecord("r1 maxee=0.000400 length=4", "ACGT", "IIII"),
+		createTestRecord("r2 maxee=2.5 length=5 sample=A", "ACGT", "$$$$"), // trimmed
+		createTestRecord("r3 maxee=abc", "ACGT", "IIII"),
+		createTestRecord("r4 size=2", "ACGT", "IIII"), // nothing to check
+	}
+	writeFastqRecords(t, inputPath, records)
+
+	headerMetrics, _ := parseHeaderMetrics("maxee,length")
+	reportPath := filepath.Join(tmpDir, "report.tsv")
+	fixPath := filepath.Join(tmpDir, "fixed.fastq")
+
+	summary, err := runVerify(testInput(inputPath), reportPath, fixPath, headerMetrics, defaultHeaderFormat, DEFAULT_MIN_PHRED, 0.001, 0.005, OutputFormat{})
+	if err != nil {
+		t.Fatalf("runVerify() error = %v", err)
+	}
+	want := VerifySummary{Records: 4, Annotations: 5, Mismatches: 3, StaleRecords: 2}
+	if summary != want {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+
+	report, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(report)), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], "r2\tmaxee\t2.5\t2.00474") ||
+		lines[2] != "r2\tlength\t5\t4\t1" || lines[3] != "r3\tmaxee\tabc\t0.0004\tNA" {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+
+	fixed, err := os.ReadFile(fixPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMaxEE := defaultHeaderFormat.FormatValue(calculateMaxEE([]byte("$$$$")))
+	for _, header := range []string{
+		"@r1 maxee=0.000400 length=4\n",
+		"@r2 maxee=" + wantMaxEE + " length=4 sample=A\n",
+		"@r3 maxee=0.000400\n",
+		"@r4 size=2\n",
+	} {
+		if !strings.Contains(string(fixed), header) {
+			t.Errorf("fixed output lacks %q:\n%s", header, fixed)
+		}
+	}
+}
+
+func TestRunVerifyAliasesAndFasta(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("r1;size=3;ee=0.0004;", "ACGT", "IIII"),
+		createTestRecord("r2;size=3;ee=1;", "ACGT", "IIII"),
+	})
+
+	format, err := parseHeaderFormat("space", false, "maxee=ee", 6, 0, "replace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerMetrics, _ := parseHeaderMetrics("maxee")
+	summary, err := runVerify(testInput(inputPath), filepath.Join(tmpDir, "report.tsv"), "", headerMetrics, format, DEFAULT_MIN_PHRED, 0.001, 0.005, OutputFormat{})
+	if err != nil {
+		t.Fatalf("runVerify() error = %v", err)
+	}
+	if summary.Annotations != 2 || summary.Mismatches != 1 {
+		t.Errorf("summary = %+v, want 2 annotations and 1 mismatch", summary)
+	}
+
+	fastaPath := filepath.Join(tmpDir, "input.fasta")
+	if err := os.WriteFile(fastaPath, []byte(">r1 maxee=1\nACGT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = runVerify(testInput(fastaPath), filepath.Join(tmpDir, "report2.tsv"), "", headerMetrics, format, DEFAULT_MIN_PHRED, 0.001, 0.005, OutputFormat{})
+	if err == nil || !strings.Contains(err.Error(), computedQualityFastqError) {
+		t.Errorf("runVerify() on FASTA error = %v, want %q", err, computedQualityFastqError)
+	}
+}
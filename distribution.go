@@ -0,0 +1,228 @@
+// Per-read metric distributions (used by `hist` and other distribution-based subcommands)
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// MetricObservation pairs a per-read quality metric value with the read length,
+// so that both read-based and base-based retention can be derived
+type MetricObservation struct {
+	Value  float64
+	Length int
+}
+
+// collectMetricObservations streams FASTQ records from the input and returns the
+// quality metric value and length of every record (in input order)
+//
+// Returns an error if file I/O fails or the input is not FASTQ
+func collectMetricObservations(in Input, metric QualityMetric, minPhred int) ([]MetricObservation, error) {
+	reader, err := NewInputReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("error creating reader: %v", err)
+	}
+	closeReader := true
+	defer func() {
+		if closeReader {
+			reader.Close()
+		}
+	}()
+
+	observations := make([]MetricObservation, 0, 10000)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading record: %v", err)
+		}
+		if !reader.IsFastq {
+			closeReader = false
+			return nil, fmt.Errorf(computedQualityFastqError)
+		}
+
+		observations = append(observations, MetricObservation{
+			Value:  calculateQuality(record, metric, minPhred),
+			Length: len(record.Seq.Seq),
+		})
+	}
+
+	return observations, nil
+}
+
+// Retention summarizes how many reads and bases pass a pair of quality filters
+type Retention struct {
+	Reads      uint64
+	Bases      uint64
+	TotalReads uint64
+	TotalBases uint64
+}
+
+// ReadFraction returns the fraction of reads retained (0 for empty input)
+func (r Retention) ReadFraction() float64 {
+	if r.TotalReads == 0 {
+		return 0
+	}
+	return float64(r.Reads) / float64(r.TotalReads)
+}
+
+// BaseFraction returns the fraction of bases retained (0 for empty input)
+func (r Retention) BaseFraction() float64 {
+	if r.TotalBases == 0 {
+		return 0
+	}
+	return float64(r.Bases) / float64(r.TotalBases)
+}
+
+// computeRetention counts reads and bases that would pass the
+// --minqual/--maxqual filters (same semantics as in writeRecord)
+func computeRetention(observations []MetricObservation, minQualFilter, maxQualFilter float64) Retention {
+	var r Retention
+	for _, obs := range observations {
+		r.TotalReads++
+		r.TotalBases += uint64(obs.Length)
+		if obs.Value < minQualFilter || obs.Value > maxQualFilter {
+			continue
+		}
+		r.Reads++
+		r.Bases += uint64(obs.Length)
+	}
+	return r
+}
+
+// RetentionPoint is a single point on a cumulative retention curve:
+// the fraction of reads and bases kept when Threshold is used as a quality cutoff
+type RetentionPoint struct {
+	Threshold    float64
+	ReadFraction float64
+	BaseFraction float64
+}
+
+// sortObservationsBestFirst sorts observations from the best to the worst
+// quality, honouring the metric direction (see metricLowerIsBetter)
+func sortObservationsBestFirst(observations []MetricObservation, metric QualityMetric) {
+	lowerIsBetter := metricLowerIsBetter(metric)
+	sort.SliceStable(observations, func(i, j int) bool {
+		if lowerIsBetter {
+			return observations[i].Value < observations[j].Value
+		}
+		return observations[i].Value > observations[j].Value
+	})
+}
+
+// retentionCurve computes the cumulative fraction of reads and bases retained
+// as the quality cutoff is relaxed from the best to the worst observed value.
+// Each point corresponds to using its Threshold as --maxqual (for metrics where
+// lower is better) or --minqual (otherwise). Infinite values are never retained.
+// The curve is downsampled to at most maxPoints points
+func retentionCurve(observations []MetricObservation, metric QualityMetric, maxPoints int) []RetentionPoint {
+	sorted := make([]MetricObservation, len(observations))
+	copy(sorted, observations)
+	sortObservationsBestFirst(sorted, metric)
+
+	var totalBases uint64
+	for _, obs := range sorted {
+		totalBases += uint64(obs.Length)
+	}
+	totalReads := len(sorted)
+
+	points := make([]RetentionPoint, 0, len(sorted))
+	var reads, bases uint64
+	for i, obs := range sorted {
+		if math.IsInf(obs.Value, 0) || math.IsNaN(obs.Value) {
+			continue
+		}
+		reads++
+		bases += uint64(obs.Length)
+		// Reads with equal values are retained together
+		if i+1 < len(sorted) && sorted[i+1].Value == obs.Value {
+			continue
+		}
+		p := RetentionPoint{Threshold: obs.Value, ReadFraction: float64(reads) / float64(totalReads)}
+		if totalBases > 0 {
+			p.BaseFraction = float64(bases) / float64(totalBases)
+		}
+		points = append(points, p)
+	}
+
+	if maxPoints > 1 && len(points) > maxPoints {
+		step := float64(len(points)-1) / float64(maxPoints-1)
+		sampled := make([]RetentionPoint, 0, maxPoints)
+		for i := 0; i < maxPoints; i++ {
+			sampled = append(sampled, points[int(math.Round(float64(i)*step))])
+		}
+		points = sampled
+	}
+
+	return points
+}
+
+// ThresholdRecommendation is the metric cutoff needed to reach a retention target
+type ThresholdRecommendation struct {
+	Target    string  // "reads" or "bases"
+	Fraction  float64 // Requested retention fraction (0..1)
+	Threshold float64 // Metric value to use as a cutoff
+	Flag      string  // Filtering flag the threshold is intended for (--minqual or --maxqual)
+	Retention Retention
+	Reachable bool // false if the target can't be met (e.g., too many reads with undefined metric)
+}
+
+// recommendThreshold finds the least permissive metric cutoff that retains at
+// least `fraction` of reads (or bases, if byBases is true). For metrics where
+// lower is better, the cutoff is meant for --maxqual; otherwise for --minqual.
+// All reads sharing the cutoff value are retained, so the actual retention
+// may exceed the target
+func recommendThreshold(sorted []MetricObservation, metric QualityMetric, fraction float64, byBases bool) ThresholdRecommendation {
+	rec := ThresholdRecommendation{Target: "reads", Fraction: fraction, Flag: "--minqual"}
+	if byBases {
+		rec.Target = "bases"
+	}
+	if metricLowerIsBetter(metric) {
+		rec.Flag = "--maxqual"
+	}
+
+	var totalBases uint64
+	for _, obs := range sorted {
+		totalBases += uint64(obs.Length)
+	}
+	rec.Retention.TotalReads = uint64(len(sorted))
+	rec.Retention.TotalBases = totalBases
+
+	total := float64(len(sorted))
+	if byBases {
+		total = float64(totalBases)
+	}
+	// Tolerate floating-point noise (e.g., 0.7 * 10 = 7.000000000000001)
+	need := math.Ceil(fraction*total - 1e-9)
+
+	var reads, bases uint64
+	for i, obs := range sorted {
+		if math.IsInf(obs.Value, 0) || math.IsNaN(obs.Value) {
+			break
+		}
+		reads++
+		bases += uint64(obs.Length)
+		// Reads with equal values can't be separated by a threshold
+		if i+1 < len(sorted) && sorted[i+1].Value == obs.Value {
+			continue
+		}
+		kept := float64(reads)
+		if byBases {
+			kept = float64(bases)
+		}
+		if kept >= need {
+			rec.Threshold = obs.Value
+			rec.Retention.Reads = reads
+			rec.Retention.Bases = bases
+			rec.Reachable = true
+			return rec
+		}
+	}
+
+	return rec
+}
@@ -0,0 +1,207 @@
+// Grouping of records by a header field or a regular expression (e.g., UMI, sample or barcode)
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// GroupOrder defines how groups are arranged in the output
+type GroupOrder int
+
+const (
+	GroupOrderGlobal  GroupOrder = iota // Keep the global quality order (groups are interleaved)
+	GroupOrderNatural                   // Groups in natural order of their names (e.g., s2 before s10)
+	GroupOrderSize                      // Largest groups first
+)
+
+// String returns the string representation of a GroupOrder
+func (o GroupOrder) String() string {
+	switch o {
+	case GroupOrderGlobal:
+		return "global"
+	case GroupOrderNatural:
+		return "natural"
+	case GroupOrderSize:
+		return "size"
+	default:
+		return "unknown"
+	}
+}
+
+// parseGroupOrder parses the value of the --group-order flag
+func parseGroupOrder(s string) (GroupOrder, error) {
+	switch s {
+	case "global":
+		return GroupOrderGlobal, nil
+	case "natural":
+		return GroupOrderNatural, nil
+	case "size":
+		return GroupOrderSize, nil
+	default:
+		return GroupOrderGlobal, fmt.Errorf("invalid --group-order: %s (must be 'global', 'natural' or 'size')", s)
+	}
+}
+
+// Grouping assigns records to groups by a header field (e.g., "umi=ACGT")
+// or by a regular expression matched against the whole header (the first
+// capture group, or the whole match if the expression has no groups).
+// Records without the field (or not matching the expression) form one group
+// with an empty name
+type Grouping struct {
+	Key      string         // Header key holding the group name
+	Regexp   *regexp.Regexp // Regular expression (used if Key is empty)
+	PerGroup int            // Maximum number of records written per group (0 = no limit)
+	Order    GroupOrder     // Arrangement of groups in the output
+	Summary  GroupSummary   // Filled in by groupRecords
+}
+
+// parseGrouping builds a Grouping from the value of --group-by. Values that are
+// valid header keys (letters, digits and '_') are header keys, anything else
+// is a regular expression (e.g., "^[^:]+:([ACGT]+)" for a UMI in the read ID)
+func parseGrouping(spec string, perGroup int, order GroupOrder) (*Grouping, error) {
+	if perGroup < 0 {
+		return nil, fmt.Errorf("--per-group must be non-negative")
+	}
+	g := &Grouping{PerGroup: perGroup, Order: order}
+	if isHeaderKey(spec) {
+		g.Key = spec
+		return g, nil
+	}
+
+	re, err := regexp.Compile(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid group regular expression: %v", err)
+	}
+	g.Regexp = re
+	return g, nil
+}
+
+// GroupOf returns the group name of a record header.
+// The name is copied, so that it does not keep the header in memory
+func (g *Grouping) GroupOf(header string) string {
+	if g.Regexp == nil {
+		value, _ := parseHeaderFields(header).Lookup(g.Key)
+		return strings.Clone(value)
+	}
+
+	m := g.Regexp.FindStringSubmatch(header)
+	switch {
+	case m == nil:
+		return ""
+	case len(m) > 1:
+		return strings.Clone(m[1])
+	default:
+		return strings.Clone(m[0])
+	}
+}
+
+// GroupSummary counts the records and groups processed by groupRecords
+type GroupSummary struct {
+	Groups  int          // Number of groups
+	Records int          // Records assigned to groups
+	Written int          // Records kept after the per-group limit
+	Counts  []GroupCount // Per-group counts, in output order
+}
+
+// GroupCount is the number of records of a single group
+type GroupCount struct {
+	Name    string
+	Records int
+	Written int
+}
+
+// Write prints the summary in a human-readable form
+func (s GroupSummary) Write(w io.Writer) {
+	fmt.Fprintf(w, "%s %d records in %d groups; %d records written\n",
+		bold("Groups:"), s.Records, s.Groups, s.Written)
+}
+
+// WriteCounts prints the per-group counts as a table (records without a group are shown as "(none)")
+func (s GroupSummary) WriteCounts(w io.Writer) {
+	width := len("(none)")
+	for _, c := range s.Counts {
+		width = max(width, len(c.Name))
+	}
+	fmt.Fprintf(w, "  %-*s %10s %10s\n", width, "group", "records", "written")
+	for _, c := range s.Counts {
+		name := c.Name
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Fprintf(w, "  %-*s %10d %10d\n", width, name, c.Records, c.Written)
+	}
+}
+
+// groupRecords applies the grouping to records that are already sorted by quality:
+// at most PerGroup records (the first ones, i.e. the best) are kept from each group,
+// and groups are arranged according to Order. The relative order of records within
+// a group is preserved. group returns the group name of an item (see GroupOf)
+func groupRecords[T any](g *Grouping, items []T, group func(T) string) []T {
+	type grouped struct {
+		item  T
+		group int
+	}
+
+	index := make(map[string]int)
+	var names []string
+	var sizes []int
+	kept := make([]grouped, 0, len(items))
+
+	for _, item := range items {
+		name := group(item)
+		gi, ok := index[name]
+		if !ok {
+			gi = len(names)
+			index[name] = gi
+			names = append(names, name)
+			sizes = append(sizes, 0)
+		}
+		sizes[gi]++
+		if g.PerGroup == 0 || sizes[gi] <= g.PerGroup {
+			kept = append(kept, grouped{item, gi})
+		}
+	}
+
+	// Groups in order of first appearance (for the global order), or ranked by name or size
+	order := make([]int, len(names))
+	for i := range order {
+		order[i] = i
+	}
+	if g.Order != GroupOrderGlobal {
+		sort.Slice(order, func(i, j int) bool {
+			a, b := order[i], order[j]
+			if g.Order == GroupOrderSize && sizes[a] != sizes[b] {
+				return sizes[a] > sizes[b]
+			}
+			return naturalNameLess(names[a], names[b])
+		})
+		// Stably sort records by the rank of their group
+		rank := make([]int, len(names))
+		for r, gi := range order {
+			rank[gi] = r
+		}
+		sort.SliceStable(kept, func(i, j int) bool {
+			return rank[kept[i].group] < rank[kept[j].group]
+		})
+	}
+
+	g.Summary = GroupSummary{Groups: len(names), Records: len(items), Written: len(kept)}
+	for _, gi := range order {
+		written := sizes[gi]
+		if g.PerGroup > 0 {
+			written = min(written, g.PerGroup)
+		}
+		g.Summary.Counts = append(g.Summary.Counts, GroupCount{names[gi], sizes[gi], written})
+	}
+
+	result := items[:0]
+	for _, k := range kept {
+		result = append(result, k.item)
+	}
+	return result
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/spf13/cobra"
+)
+
+func TestGroupingGroupOf(t *testing.T) {
+	tests := []struct {
+		spec   string
+		header string
+		want   string
+	}{
+		{"umi", "read1 umi=ACGT sample=s1", "ACGT"},
+		{"umi", "read1 sample=s1", ""},
+		{`_([ACGT]+)$`, "read1_ACGT", "ACGT"},
+		{`^[a-z]+`, "read1_ACGT", "read"},
+		{`^[a-z]+`, "1read", ""},
+	}
+
+	for _, tt := range tests {
+		g, err := parseGrouping(tt.spec, 0, GroupOrderGlobal)
+		if err != nil {
+			t.Fatalf("parseGrouping(%q) error = %v", tt.spec, err)
+		}
+		if got := g.GroupOf(tt.header); got != tt.want {
+			t.Errorf("GroupOf(%q) with %q = %q, want %q", tt.header, tt.spec, got, tt.want)
+		}
+	}
+
+	if _, err := parseGrouping("([", 0, GroupOrderGlobal); err == nil {
+		t.Error("parseGrouping() expected an error for an invalid regular expression")
+	}
+	if _, err := parseGrouping("umi", -1, GroupOrderGlobal); err == nil {
+		t.Error("parseGrouping() expected an error for a negative --per-group")
+	}
+}
+
+func TestSortRecordsGrouped(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("r1 umi=s10", "ACGT", "5555"), // Q20
+		createTestRecord("r2 umi=s2", "ACGT", "IIII"),  // Q40
+		createTestRecord("r3 umi=s10", "ACGT", "????"), // Q30
+		createTestRecord("r4 umi=s2", "ACGT", "++++"),  // Q10
+		createTestRecord("r5 umi=s10", "ACGT", "IIII"), // Q40
+		createTestRecord("r6", "ACGT", "$$$$"),         // Q3, no UMI
+	})
+
+	tests := []struct {
+		name     string
+		perGroup int
+		order    GroupOrder
+		want     []string
+		summary  GroupSummary
+	}{
+		{
+			name:    "Global order, no limit",
+			order:   GroupOrderGlobal,
+			want:    []string{"r2", "r5", "r3", "r1", "r4", "r6"},
+			summary: GroupSummary{Groups: 3, Records: 6, Written: 6},
+		},
+		{
+			name:     "Global order, best record per group",
+			perGroup: 1,
+			order:    GroupOrderGlobal,
+			want:     []string{"r2", "r5", "r6"},
+			summary:  GroupSummary{Groups: 3, Records: 6, Written: 3},
+		},
+		{
+			name:     "Natural group order",
+			perGroup: 2,
+			order:    GroupOrderNatural,
+			want:     []string{"r6", "r2", "r4", "r5", "r3"},
+			summary:  GroupSummary{Groups: 3, Records: 6, Written: 5},
+		},
+		{
+			name:    "Largest groups first",
+			order:   GroupOrderSize,
+			want:    []string{"r5", "r3", "r1", "r2", "r4", "r6"},
+			summary: GroupSummary{Groups: 3, Records: 6, Written: 6},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, compLevel := range []int{0, 1} {
+			t.Run(tt.name, func(t *testing.T) {
+				groups, err := parseGrouping("umi", tt.perGroup, tt.order)
+				if err != nil {
+					t.Fatal(err)
+				}
+				outputPath := filepath.Join(tmpDir, "output.fastq")
+				sortRecords(testInput(inputPath), outputPath, false, AvgPhred, compLevel, nil, defaultHeaderFormat, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{Groups: groups})
+
+				if got := readFastxIDs(t, outputPath); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("compLevel %d: order = %v, want %v", compLevel, got, tt.want)
+				}
+				summary := groups.Summary
+				summary.Counts = nil
+				if !reflect.DeepEqual(summary, tt.summary) {
+					t.Errorf("compLevel %d: summary = %+v, want %+v", compLevel, summary, tt.summary)
+				}
+			})
+		}
+	}
+}
+
+func TestParseSortGrouping(t *testing.T) {
+	tests := []struct {
+		name       string
+		groupBy    string
+		within     string
+		perGroup   int
+		groupOrder string // "" = flag not set
+		want       GroupOrder
+		wantErr    bool
+	}{
+		{name: "No grouping"},
+		{name: "--per-group alone", perGroup: 1, wantErr: true},
+		{name: "--group-by", groupBy: "umi", want: GroupOrderGlobal},
+		{name: "--within defaults to natural order", within: "sample", want: GroupOrderNatural},
+		{name: "--within by size", within: "sample", groupOrder: "size", want: GroupOrderSize},
+		{name: "--within with global order", within: "sample", groupOrder: "global", wantErr: true},
+		{name: "Both --group-by and --within", groupBy: "umi", within: "sample", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			order := cmd.Flags().String("group-order", "global", "")
+			if tt.groupOrder != "" {
+				cmd.Flags().Set("group-order", tt.groupOrder)
+			}
+
+			groups, err := parseSortGrouping(cmd, tt.groupBy, tt.within, tt.perGroup, *order)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("parseSortGrouping() expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSortGrouping() error = %v", err)
+			}
+			if tt.groupBy == "" && tt.within == "" {
+				if groups != nil {
+					t.Errorf("parseSortGrouping() = %+v, want nil", groups)
+				}
+				return
+			}
+			if groups.Order != tt.want {
+				t.Errorf("parseSortGrouping() order = %v, want %v", groups.Order, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunPresortWithin(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("r1;sample=s10;maxee=0.5", "ACGT", "IIII"),
+		createTestRecord("r2;sample=s2;maxee=0.1", "ACGT", "IIII"),
+		createTestRecord("r3;sample=s10;maxee=0.2", "ACGT", "IIII"),
+		createTestRecord("r4;sample=s2;maxee=0.3", "ACGT", "IIII"),
+		createTestRecord("r5;sample=s10;maxee=0.4", "ACGT", "IIII"),
+		createTestRecord("r6;maxee=0.01", "ACGT", "IIII"),
+	})
+
+	tests := []struct {
+		name   string
+		order  GroupOrder
+		want   []string
+		counts []GroupCount
+	}{
+		{
+			name:   "Natural group order",
+			order:  GroupOrderNatural,
+			want:   []string{"r6", "r2", "r4", "r3", "r5", "r1"},
+			counts: []GroupCount{{"", 1, 1}, {"s2", 2, 2}, {"s10", 3, 3}},
+		},
+		{
+			name:   "Largest groups first",
+			order:  GroupOrderSize,
+			want:   []string{"r3", "r5", "r1", "r2", "r4", "r6"},
+			counts: []GroupCount{{"s10", 3, 3}, {"s2", 2, 2}, {"", 1, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups, err := parseGrouping("sample", 0, tt.order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outputPath := filepath.Join(tmpDir, "output.fastq")
+			err = runPresort(testInput(inputPath), outputPath, metricSortKey(MaxEE, nil), false, 0, -math.MaxFloat64, math.MaxFloat64, MissingError, "", DEFAULT_MIN_PHRED, OutputOptions{Groups: groups})
+			if err != nil {
+				t.Fatalf("runPresort() error = %v", err)
+			}
+
+			var got []string
+			for _, id := range readFastxIDs(t, outputPath) {
+				got = append(got, strings.SplitN(id, ";", 2)[0])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("runPresort() order = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(groups.Summary.Counts, tt.counts) {
+				t.Errorf("group counts = %+v, want %+v", groups.Summary.Counts, tt.counts)
+			}
+		})
+	}
+}
+
+func TestGroupSummaryWriteCounts(t *testing.T) {
+	summary := GroupSummary{Counts: []GroupCount{{"sample10", 3, 2}, {"", 1, 1}}}
+	var buf bytes.Buffer
+	summary.WriteCounts(&buf)
+
+	want := "  group       records    written\n" +
+		"  sample10          3          2\n" +
+		"  (none)            1          1\n"
+	if buf.String() != want {
+		t.Errorf("WriteCounts() = %q, want %q", buf.String(), want)
+	}
+}
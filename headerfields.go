@@ -0,0 +1,113 @@
+// Tokenised parser of key=value annotations in sequence headers
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HeaderField is a single key=value annotation parsed from a sequence header
+type HeaderField struct {
+	Key   string
+	Value string
+}
+
+// ParsedHeader holds the sequence ID and the key=value annotations of a header.
+// Both space-separated (">seq1 maxee=2 size=10") and semicolon-separated
+// (">seq1;maxee=2;size=10;") annotations are recognized, and may be mixed
+type ParsedHeader struct {
+	ID     string
+	Fields []HeaderField
+}
+
+// isHeaderKey reports whether s is a valid annotation key (letters, digits and '_')
+func isHeaderKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseHeaderFields splits a header into tokens separated by whitespace or ";"
+// and collects the tokens of the form key=value as annotations.
+// The ID is the first whitespace-delimited word of the header (without a leading '>' or '@').
+// The first token is never treated as an annotation, and tokens whose key
+// contains characters other than letters, digits and '_' are ignored
+func parseHeaderFields(header string) ParsedHeader {
+	if strings.HasPrefix(header, ">") || strings.HasPrefix(header, "@") {
+		header = header[1:]
+	}
+
+	var parsed ParsedHeader
+	parsed.ID, _, _ = strings.Cut(header, " ")
+
+	start := 0
+	first := true
+	for i := 0; i <= len(header); i++ {
+		if i < len(header) && !isHeaderSeparator(header[i]) {
+			continue
+		}
+		token := header[start:i]
+		start = i + 1
+		if token == "" {
+			continue
+		}
+		if first {
+			first = false
+			continue
+		}
+		if key, value, ok := strings.Cut(token, "="); ok && isHeaderKey(key) {
+			parsed.Fields = append(parsed.Fields, HeaderField{Key: key, Value: value})
+		}
+	}
+
+	return parsed
+}
+
+// Lookup returns the value of the first annotation with the given key
+func (h ParsedHeader) Lookup(key string) (string, bool) {
+	for _, f := range h.Fields {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// Float returns the numeric value of the annotation with the given key.
+// Any number accepted by strconv.ParseFloat is valid (e.g., "2", ".5", "-3.2",
+// "1e-05", "+Inf"). Returns found = false if the key is absent, and an error
+// naming the record if the value is not a number
+func (h ParsedHeader) Float(key string) (value float64, found bool, err error) {
+	s, ok := h.Lookup(key)
+	if !ok {
+		return 0, false, nil
+	}
+	value, err = strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, true, fmt.Errorf("record %s: invalid value of '%s' annotation: %q", h.ID, key, s)
+	}
+	return value, true, nil
+}
+
+// Int returns the integer value of the annotation with the given key
+// (see Float for the meaning of the returned values)
+func (h ParsedHeader) Int(key string) (value int, found bool, err error) {
+	s, ok := h.Lookup(key)
+	if !ok {
+		return 0, false, nil
+	}
+	value, err = strconv.Atoi(s)
+	if err != nil {
+		return 0, true, fmt.Errorf("record %s: invalid integer value of '%s' annotation: %q", h.ID, key, s)
+	}
+	return value, true, nil
+}
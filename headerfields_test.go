@@ -0,0 +1,178 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseHeaderFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   ParsedHeader
+	}{
+		{
+			name:   "Space-separated",
+			header: ">seq1 maxee=2.5 size=100",
+			want:   ParsedHeader{ID: "seq1", Fields: []HeaderField{{"maxee", "2.5"}, {"size", "100"}}},
+		},
+		{
+			name:   "Semicolon-separated with trailing semicolon",
+			header: "@seq1;size=10;ee=1e-05;",
+			want:   ParsedHeader{ID: "seq1;size=10;ee=1e-05;", Fields: []HeaderField{{"size", "10"}, {"ee", "1e-05"}}},
+		},
+		{
+			name:   "Mixed separators, tabs and free text",
+			header: "seq1 sample=A;score=-3.2\tsome description x-y=1 a=b=c",
+			want: ParsedHeader{ID: "seq1", Fields: []HeaderField{
+				{"sample", "A"}, {"score", "-3.2"}, {"a", "b=c"},
+			}},
+		},
+		{
+			name:   "ID is never an annotation",
+			header: "maxee=1 length=4",
+			want:   ParsedHeader{ID: "maxee=1", Fields: []HeaderField{{"length", "4"}}},
+		},
+		{
+			name:   "Empty value",
+			header: "seq1 maxee=",
+			want:   ParsedHeader{ID: "seq1", Fields: []HeaderField{{"maxee", ""}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseHeaderFields(tt.header)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHeaderFields(%q) = %+v, want %+v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsedHeaderFloat(t *testing.T) {
+	tests := []struct {
+		header    string
+		want      float64
+		wantFound bool
+		wantErr   bool
+	}{
+		{header: "seq1 maxee=1e-05", want: 1e-05, wantFound: true},
+		{header: "seq1 maxee=.5", want: 0.5, wantFound: true},
+		{header: "seq1;maxee=-3.2;", want: -3.2, wantFound: true},
+		{header: "seq1 maxee=+Inf", want: math.Inf(1), wantFound: true},
+		{header: "seq1 maxee=2E+3", want: 2000, wantFound: true},
+		{header: "seq1 maxee=1 maxee=2", want: 1, wantFound: true},
+		{header: "seq1 maxee2=1", wantFound: false},
+		{header: "seq1 maxee=abc", wantFound: true, wantErr: true},
+		{header: "seq1 maxee=1.5.3", wantFound: true, wantErr: true},
+		{header: "seq1 maxee=", wantFound: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, found, err := parseHeaderFields(tt.header).Float("maxee")
+			if found != tt.wantFound {
+				t.Fatalf("Float() found = %v, want %v", found, tt.wantFound)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Float() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), "seq1") {
+					t.Errorf("Float() error = %q, want record ID", err.Error())
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Float() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHeaderInfoMalformedValue(t *testing.T) {
+	_, _, _, _, _, err := parseHeaderInfo(">read7 maxee=1e-0x size=3", "maxee")
+	if err == nil || !strings.Contains(err.Error(), "read7") {
+		t.Fatalf("parseHeaderInfo() error = %v, want error naming the record", err)
+	}
+
+	// A malformed size is not an error
+	_, q, _, hasQual, hasSize, err := parseHeaderInfo(">read7 maxee=1 size=many", "maxee")
+	if err != nil || !hasQual || q != 1 || hasSize {
+		t.Fatalf("parseHeaderInfo() = %v, %v, %v, %v", q, hasQual, hasSize, err)
+	}
+}
+
+// FuzzParseHeaderFields checks that arbitrary headers are parsed without panics
+// and that all parsed annotations are well-formed
+func FuzzParseHeaderFields(f *testing.F) {
+	for _, seed := range []string{
+		">seq1 maxee=2.5 size=100",
+		"@seq1;size=10;ee=1e-05;",
+		"seq1 a=b=c ;; = =1 x=",
+		"",
+		";",
+		"=",
+		"seq1\tmaxee=+Inf\tNaN=NaN",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, header string) {
+		parsed := parseHeaderFields(header)
+		if strings.Contains(parsed.ID, " ") {
+			t.Errorf("ID %q contains a space", parsed.ID)
+		}
+		for _, field := range parsed.Fields {
+			if !isHeaderKey(field.Key) {
+				t.Errorf("invalid key %q", field.Key)
+			}
+			if strings.ContainsAny(field.Value, " \t;") {
+				t.Errorf("value %q contains a separator", field.Value)
+			}
+			if !strings.Contains(header, field.Key+"="+field.Value) {
+				t.Errorf("field %s=%s not found in header %q", field.Key, field.Value, header)
+			}
+		}
+		if _, _, err := parsed.Float("maxee"); err != nil && !strings.Contains(err.Error(), parsed.ID) {
+			t.Errorf("error %q does not name the record", err.Error())
+		}
+	})
+}
+
+// FuzzHeaderValueRoundTrip checks that every value written by HeaderFormat
+// is parsed back by the header parser
+func FuzzHeaderValueRoundTrip(f *testing.F) {
+	f.Add(0.123456789, 6, 0, false, false)
+	f.Add(1e-05, 6, 3, true, true)
+	f.Add(math.Inf(1), 6, 0, false, false)
+	f.Add(-3.2, 2, 0, true, false)
+	f.Add(1e300, 0, 17, true, true)
+
+	f.Fuzz(func(t *testing.T, v float64, precision, digits int, semicolon, trailing bool) {
+		format := HeaderFormat{
+			Semicolon: semicolon,
+			Trailing:  semicolon && trailing,
+			Precision: ((precision % 18) + 18) % 18,
+			Digits:    ((digits % 18) + 18) % 18,
+			Aliases:   map[string]string{"maxee": "ee"},
+		}
+		name, err := format.Annotate([]byte("seq1;size=2;"), []HeaderAnnotation{{format.Key("maxee"), format.FormatValue(v)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, found, err := parseHeaderFields(string(name)).Float("ee")
+		if !found || err != nil {
+			t.Fatalf("header %q: found = %v, error = %v", name, found, err)
+		}
+		want, _ := strconv.ParseFloat(format.FormatValue(v), 64)
+		if got != want && !(math.IsNaN(got) && math.IsNaN(want)) {
+			t.Errorf("header %q: parsed %v, want %v", name, got, want)
+		}
+	})
+}
@@ -29,31 +29,75 @@ func helpFunc(cmd *cobra.Command, args []string) {
   %s
   %s
   %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
 
 %s
   %s
+  %s
+  %s
 
 %s
   %s
   %s
   %s
+  %s
 
 `,
 			bold(getColorizedLogo()+" phredsort headersort - Sorts sequences using header quality metrics"),
 			bold(yellow("Description:")),
 			bold(yellow("Flags:")),
-			cyan("-i, --in")+" <string>      : Input FASTA/FASTQ file (default: stdin)",
+			cyan("-i, --in")+" <string>      : Input FASTA/FASTQ file (default: stdin), may be repeated or given as arguments",
+			cyan("--tag-source")+" <bool>    : Add the name of the input file to headers (file=<basename>)",
+			cyan("--keep-tags")+" <string>   : Tags of SAM/BAM input records to keep in headers (e.g., 'RG,BC', or 'all') (optional)",
+			cyan("--duplicates")+" <string>  : Check for sequence IDs occurring more than once in the input (ignore, warn, error) (default, 'ignore')",
 			cyan("-o, --out")+" <string>     : Output FASTA/FASTQ file (default: stdout)",
+			cyan("--out-format")+" <string> : Output sequence format (fasta, fastq) (default, same as input)",
+			cyan("--line-width")+" <int> : Line width of FASTA sequences (default, 0 = no wrapping)",
 			cyan("-s, --metric")+" <string>  : Header metric to use (avgphred, maxee, meep, lqcount, lqpercent) (default, 'avgphred')",
 			cyan("-a, --ascending")+" <bool> : Sort in ascending order of the header metric (default, false)",
 			cyan("-m, --minqual")+" <float>  : Minimum header metric value for filtering (optional)",
 			cyan("-M, --maxqual")+" <float>  : Maximum header metric value for filtering (optional)",
+			cyan("--header-alias")+" <string> : Comma-separated metric=key aliases used in headers (e.g., 'maxee=ee')",
+			cyan("-k, --key")+" <string>     : Sort by an arbitrary header field instead of a quality metric (e.g., 'abundance')",
+			cyan("--key-type")+" <string>    : Type of --key values (float, int, natural, string) (default, 'float')",
+			cyan("-c, --compress")+" <int>   : Memory compression level (0=disabled, 1-22; default, 1)",
+			cyan("--within")+" <string> : Sort records within groups (header key, e.g., 'sample', or a regular expression); groups are written one after another (optional)",
+			cyan("--group-order")+" <string> : Order of groups with --within ('natural' or 'size') (default, 'natural')",
+			cyan("--metrics-from")+" <string> : Take sort key values from this table (TSV or JSON Lines) instead of headers",
+			cyan("--key-column")+" <string> : Column of the --metrics-from table to sort by (default, the --metric name)",
+			cyan("--id-column")+" <string>  : Column of the --metrics-from table with sequence IDs (default, 'id')",
+			cyan("--missing")+" <string>     : What to do with records missing the sort key (error, skip, first, last, compute) (default, 'error')",
+			cyan("--rejects")+" <string>     : Write records skipped with '--missing skip' to this file (optional)",
+			cyan("-p, --minphred")+" <int>   : Quality threshold for 'lqcount' and 'lqpercent' metrics (with '--missing compute') (default, 15)",
+			cyan("--metrics-out")+" <string> : Write the sort key value and length of each output record to this table",
+			cyan("--metrics-format")+" <string> : Format of the --metrics-out table (tsv, jsonl) (default, 'tsv')",
 			bold(yellow("Examples:")),
 			cyan("phredsort headersort -i input.fasta -o output.fasta --metric maxee"),
+			cyan("phredsort headersort -i input.fasta -o output.fasta --key sample --key-type natural --ascending"),
+			cyan("phredsort headersort -i input.fasta -o output.fasta --metrics-from scores.tsv --key-column confidence --missing last"),
 			bold(yellow("Supported header formats:")),
 			`  ">seq1 maxee=2.5 size=100"`,
 			`  ">seq1;maxee=2.5;size=100"`,
 			`  (other metrics use the same "name=value" syntax)`,
+			`  (values may be in scientific notation, e.g., ">seq1;ee=1.5e-05;"; see --header-alias)`,
 		)
 		return
 	case "sort":
@@ -75,6 +119,29 @@ func helpFunc(cmd *cobra.Command, args []string) {
   %s
   %s
   %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
 
 %s
   %s
@@ -84,15 +151,38 @@ func helpFunc(cmd *cobra.Command, args []string) {
 			bold(getColorizedLogo()+" phredsort sort - Sorts FASTQ based on computed quality metrics"),
 			bold(yellow("Description:")),
 			bold(yellow("Flags:")),
-			cyan("-i, --in")+" <string>      : Input FASTQ file (default: stdin)",
-			cyan("-o, --out")+" <string>     : Output FASTQ file (default: stdout)",
+			cyan("-i, --in")+" <string>      : Input FASTQ file (default: stdin), may be repeated or given as arguments",
+			cyan("--tag-source")+" <bool>    : Add the name of the input file to headers (file=<basename>)",
+			cyan("--keep-tags")+" <string>   : Tags of SAM/BAM input records to keep in headers (e.g., 'RG,BC', or 'all') (optional)",
+			cyan("--duplicates")+" <string>  : Check for sequence IDs occurring more than once in the input (ignore, warn, error) (default, 'ignore')",
+			cyan("-o, --out")+" <string>     : Output FASTQ file (default: stdout); a .sam or .bam file gets unaligned SAM/BAM with --header metrics as tags (e.g., XE:f)",
+			cyan("--out-format")+" <string> : Output sequence format (fasta, fastq); FASTA headers keep the --header annotations (default, fastq)",
+			cyan("--line-width")+" <int> : Line width of FASTA sequences (default, 0 = no wrapping)",
 			cyan("-s, --metric")+" <string>  : Quality metric (avgphred, maxee, meep, lqcount, lqpercent) (default, 'avgphred')",
 			cyan("-m, --minqual")+" <float>  : Minimum quality threshold for filtering (optional)",
 			cyan("-M, --maxqual")+" <float>  : Maximum quality threshold for filtering (optional)",
 			cyan("-p, --minphred")+" <int>   : Quality threshold for 'lqcount' and 'lqpercent' metrics (default, 15)",
 			cyan("-H, --header")+" <string>  : Comma-separated list of metrics to add to headers (e.g., 'avgphred,maxee,length')",
+			cyan("--header-sep")+" <string> : Separator of header annotations ('space' or 'semicolon') (default, 'space')",
+			cyan("--header-trailing")+" : Terminate header annotations with ';' (requires --header-sep semicolon)",
+			cyan("--header-alias")+" <string> : Comma-separated metric=key aliases for header annotations (e.g., 'maxee=ee')",
+			cyan("--header-precision")+" <int> : Number of decimal places of metric values in headers (default, 6)",
+			cyan("--header-digits")+" <int> : Number of significant digits of metric values in headers (overrides --header-precision)",
+			cyan("--on-existing")+" <string> : What to do with header keys that already exist (replace, keep, append, error) (default, 'replace')",
 			cyan("-a, --ascending")+" <bool> : Sort sequences in ascending order of quality (default, false)",
 			cyan("-c, --compress")+" <int>   : Memory compression level (0=disabled, 1-22; default, 1)",
+			cyan("--html")+" <string>        : Write a self-contained HTML QC report to this file (optional)",
+			cyan("--metrics-out")+" <string> : Write per-record metrics (--header metrics, or the sorting metric and length) to this table instead of annotating headers",
+			cyan("--metrics-format")+" <string> : Format of the --metrics-out table (tsv, jsonl, parquet; parquet if the file name ends with .parquet) (default, 'tsv')",
+			cyan("--group-by")+" <string> : Group records by a header key (e.g., 'umi') or a regular expression matched against the header (optional)",
+			cyan("--within")+" <string> : Sort records within groups (header key, e.g., 'sample', or a regular expression); groups are written one after another (optional)",
+			cyan("--per-group")+" <int> : Maximum number of best-quality records written per group (default, 0 = no limit)",
+			cyan("--group-order")+" <string> : Order of groups: 'global' (by quality, --group-by only), 'natural' or 'size' (default, 'global'; 'natural' with --within)",
+			cyan("--out-pattern")+" <string> : Write output to several files named after this pattern, with {bin} and/or {part} (e.g., 'tier_{bin}.fq.gz') (optional)",
+			cyan("--bins")+" <string> : Comma-separated metric breakpoints splitting the output into quality tiers (e.g., '0.5,1,2') (optional)",
+			cyan("--bin-labels")+" <string> : Comma-separated names of the tiers used for {bin} (e.g., 'gold,silver,bronze,rest') (default, 1, 2, ...)",
+			cyan("--split-records")+" <int> : Start a new output file (next {part}) every N records (optional)",
+			cyan("--split-bases")+" <int> : Start a new output file (next {part}) every N bases (optional)",
 			cyan("-v, --version")+"          : Show version information",
 			bold(yellow("Examples:")),
 			cyan("phredsort sort --metric avgphred --in input.fq.gz --out output.fq.gz"),
@@ -115,24 +205,486 @@ func helpFunc(cmd *cobra.Command, args []string) {
   %s
   %s
   %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
 
 %s
   %s
   %s
+  %s
 
 `,
 			bold(getColorizedLogo()+" phredsort nosort - Estimates FASTQ quality without sorting"),
 			bold(yellow("Description:")),
 			bold(yellow("Flags:")),
-			cyan("-i, --in")+" <string>      : Input FASTQ file (default: stdin)",
-			cyan("-o, --out")+" <string>     : Output FASTQ file (default: stdout)",
+			cyan("-i, --in")+" <string>      : Input FASTQ file (default: stdin), may be repeated or given as arguments",
+			cyan("--tag-source")+" <bool>    : Add the name of the input file to headers (file=<basename>)",
+			cyan("--keep-tags")+" <string>   : Tags of SAM/BAM input records to keep in headers (e.g., 'RG,BC', or 'all') (optional)",
+			cyan("--duplicates")+" <string>  : Check for sequence IDs occurring more than once in the input (ignore, warn, error) (default, 'ignore')",
+			cyan("-o, --out")+" <string>     : Output FASTQ file (default: stdout); a .sam or .bam file gets unaligned SAM/BAM with --header metrics as tags (e.g., XE:f)",
+			cyan("--out-format")+" <string> : Output sequence format (fasta, fastq); FASTA headers keep the --header annotations (default, fastq)",
+			cyan("--line-width")+" <int> : Line width of FASTA sequences (default, 0 = no wrapping)",
 			cyan("-s, --metric")+" <string>  : Quality metric (avgphred, maxee, meep, lqcount, lqpercent) (default, 'avgphred')",
 			cyan("-m, --minqual")+" <float>  : Minimum quality threshold for filtering (optional)",
 			cyan("-M, --maxqual")+" <float>  : Maximum quality threshold for filtering (optional)",
 			cyan("-p, --minphred")+" <int>   : Quality threshold for 'lqcount' and 'lqpercent' metrics (default, 15)",
+			cyan("-H, --header")+" <string>  : Comma-separated list of metrics to add to headers (e.g., 'avgphred,maxee,length')",
+			cyan("--header-sep")+" <string> : Separator of header annotations ('space' or 'semicolon') (default, 'space')",
+			cyan("--header-trailing")+" : Terminate header annotations with ';' (requires --header-sep semicolon)",
+			cyan("--header-alias")+" <string> : Comma-separated metric=key aliases for header annotations (e.g., 'maxee=ee')",
+			cyan("--header-precision")+" <int> : Number of decimal places of metric values in headers (default, 6)",
+			cyan("--header-digits")+" <int> : Number of significant digits of metric values in headers (overrides --header-precision)",
+			cyan("--on-existing")+" <string> : What to do with header keys that already exist (replace, keep, append, error) (default, 'replace')",
+			cyan("--html")+" <string>        : Write a self-contained HTML QC report to this file (optional)",
+			cyan("--metrics-out")+" <string> : Write per-record metrics (--header metrics, or the sorting metric and length) to this table instead of annotating headers",
+			cyan("--metrics-format")+" <string> : Format of the --metrics-out table (tsv, jsonl, parquet; parquet if the file name ends with .parquet) (default, 'tsv')",
+			cyan("--metrics-only")+" <bool> : Only write the --metrics-out table, without sequence output (default, false)",
+			cyan("--out-pattern")+" <string> : Write output to several files named after this pattern, with {bin} and/or {part} (e.g., 'tier_{bin}.fq.gz') (optional)",
+			cyan("--bins")+" <string> : Comma-separated metric breakpoints splitting the output into quality tiers (e.g., '0.5,1,2') (optional)",
+			cyan("--bin-labels")+" <string> : Comma-separated names of the tiers used for {bin} (e.g., 'gold,silver,bronze,rest') (default, 1, 2, ...)",
+			cyan("--split-records")+" <int> : Start a new output file (next {part}) every N records (optional)",
+			cyan("--split-bases")+" <int> : Start a new output file (next {part}) every N bases (optional)",
 			bold(yellow("Examples:")),
 			cyan("phredsort nosort --metric avgphred --in input.fq.gz --out output.fq.gz"),
 			cyan("cat input.fq | phredsort nosort --metric maxee --maxqual 1 > output.fq"),
+			cyan("phredsort nosort --in input.fq.gz --header maxee --metrics-out reads.parquet --metrics-only"),
+		)
+		return
+	case "stats":
+		fmt.Printf(`
+%s
+
+%s
+  Summarize per-read quality metrics (min, max, mean) of a FASTQ file.
+  With --profile, also report the per-position quality profile: mean,
+  median and quartiles of Phred scores, fraction of bases below --minphred,
+  and mean expected error at each position (optionally binned). In TSV, the
+  profile table follows the summary table after an empty line.
+
+%s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+
+%s
+  %s
+  %s
+  %s
+
+`,
+			bold(getColorizedLogo()+" phredsort stats - Summarizes FASTQ quality metrics"),
+			bold(yellow("Description:")),
+			bold(yellow("Flags:")),
+			cyan("-i, --in")+" <string>      : Input FASTQ file (default: stdin), may be repeated or given as arguments",
+			cyan("--duplicates")+" <string>  : Check for sequence IDs occurring more than once in the input (ignore, warn, error) (default, 'ignore')",
+			cyan("-o, --out")+" <string>     : Output file for statistics (default: stdout)",
+			cyan("-s, --metrics")+" <string> : Comma-separated list of per-read metrics (default, all metrics and 'length')",
+			cyan("-p, --minphred")+" <int>   : Quality threshold for 'lqcount', 'lqpercent' and low-quality fraction (default, 15)",
+			cyan("-f, --format")+" <string>  : Output format (tsv, json) (default, 'tsv')",
+			cyan("-P, --profile")+" <bool>   : Report per-position quality profile (default, false)",
+			cyan("-b, --bin")+" <int>        : Number of consecutive positions per profile bin (default, 1)",
+			cyan("--metrics-out")+" <string> : Write the metrics of each read to this table (optional)",
+			cyan("--metrics-format")+" <string> : Format of the --metrics-out table (tsv, jsonl, parquet; parquet if the file name ends with .parquet) (default, 'tsv')",
+			bold(yellow("Examples:")),
+			cyan("phredsort stats --in input.fq.gz"),
+			cyan("phredsort stats --in input.fq.gz --profile --bin 10 --format json > profile.json"),
+			cyan("phredsort stats --in input.fq.gz --metrics-out reads.parquet > summary.tsv"),
+		)
+		return
+	case "hist":
+		fmt.Printf(`
+%s
+
+%s
+  Draw a histogram of per-read quality metric values in the terminal.
+  Proposed --minqual/--maxqual thresholds are marked with cut lines, and the
+  fraction of reads and bases retained by these filters is reported.
+
+%s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+
+%s
+  %s
+  %s
+
+`,
+			bold(getColorizedLogo()+" phredsort hist - Draws quality metric distribution"),
+			bold(yellow("Description:")),
+			bold(yellow("Flags:")),
+			cyan("-i, --in")+" <string>      : Input FASTQ file (default: stdin), may be repeated or given as arguments",
+			cyan("--duplicates")+" <string>  : Check for sequence IDs occurring more than once in the input (ignore, warn, error) (default, 'ignore')",
+			cyan("-s, --metric")+" <string>  : Quality metric (avgphred, maxee, meep, lqcount, lqpercent) (default, 'avgphred')",
+			cyan("-m, --minqual")+" <float>  : Proposed minimum quality threshold (optional)",
+			cyan("-M, --maxqual")+" <float>  : Proposed maximum quality threshold (optional)",
+			cyan("-p, --minphred")+" <int>   : Quality threshold for 'lqcount' and 'lqpercent' metrics (default, 15)",
+			cyan("-b, --bins")+" <int>       : Number of histogram bins (default, 20)",
+			cyan("-w, --width")+" <int>      : Maximum bar width in characters (default, 50)",
+			cyan("--log-x")+" <bool>         : Logarithmic scale for metric values (default, false)",
+			cyan("--log-y")+" <bool>         : Logarithmic scale for read counts (default, false)",
+			bold(yellow("Examples:")),
+			cyan("phredsort hist --metric maxee --in input.fq.gz --maxqual 1"),
+			cyan("phredsort hist --metric maxee --in input.fq.gz --log-x --log-y"),
+		)
+		return
+	case "thresholds":
+		fmt.Printf(`
+%s
+
+%s
+  Report the quality metric cutoff needed to retain at least the requested
+  fraction of reads or bases. Cutoffs for 'avgphred' are meant for --minqual,
+  and cutoffs for the other metrics (lower is better) for --maxqual.
+
+%s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+
+%s
+  %s
+
+`,
+			bold(getColorizedLogo()+" phredsort thresholds - Recommends quality thresholds"),
+			bold(yellow("Description:")),
+			bold(yellow("Flags:")),
+			cyan("-i, --in")+" <string>          : Input FASTQ file (default: stdin), may be repeated or given as arguments",
+			cyan("--duplicates")+" <string>      : Check for sequence IDs occurring more than once in the input (ignore, warn, error) (default, 'ignore')",
+			cyan("-s, --metric")+" <string>      : Quality metric (avgphred, maxee, meep, lqcount, lqpercent) (default, 'avgphred')",
+			cyan("-p, --minphred")+" <int>       : Quality threshold for 'lqcount' and 'lqpercent' metrics (default, 15)",
+			cyan("-r, --keep-reads")+" <floats>  : Comma-separated fractions of reads to retain (e.g., '0.9,0.8')",
+			cyan("-b, --keep-bases")+" <floats>  : Comma-separated fractions of bases to retain (e.g., '0.9')",
+			bold(yellow("Examples:")),
+			cyan("phredsort thresholds --metric maxee --in input.fq.gz --keep-reads 0.9,0.8 --keep-bases 0.9"),
+		)
+		return
+	case "trunclen":
+		fmt.Printf(`
+%s
+
+%s
+  For every candidate truncation length, compute the fraction of reads whose
+  truncated prefix passes the maxEE cutoff, and recommend the length that
+  maximizes retained reads x length. For paired-end data, both mates must pass,
+  and truncated mates must overlap by at least --min-overlap bases
+  (if --amplicon-length is specified). R1 and R2 files must list the mates
+  in the same order (IDs are compared, ignoring /1 and /2 suffixes).
+
+%s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+
+%s
+  %s
+  %s
+
+`,
+			bold(getColorizedLogo()+" phredsort trunclen - Recommends truncation length"),
+			bold(yellow("Description:")),
+			bold(yellow("Flags:")),
+			cyan("-i, --in")+" <string>             : Input FASTQ file (R1 for paired-end data; default: stdin), may be repeated or given as arguments",
+			cyan("-I, --in2")+" <string>            : Input FASTQ file with R2 reads (enables paired-end mode; may be repeated, in the order of --in)",
+			cyan("-o, --out")+" <string>            : Output table (default: stdout)",
+			cyan("-e, --maxee")+" <float>           : Maximum expected error of the truncated read (default, 2)",
+			cyan("-l, --min-length")+" <int>        : Minimum truncation length to evaluate (default, 1)",
+			cyan("-A, --amplicon-length")+" <int>   : Expected amplicon length for the overlap constraint (paired-end only)",
+			cyan("-O, --min-overlap")+" <int>       : Minimum overlap of truncated mates (default, 12)",
+			bold(yellow("Examples:")),
+			cyan("phredsort trunclen --in R1.fq.gz --maxee 2"),
+			cyan("phredsort trunclen --in R1.fq.gz --in2 R2.fq.gz --maxee 2 --amplicon-length 450 --min-overlap 20"),
+		)
+		return
+	case "verify":
+		fmt.Printf(`
+%s
+
+%s
+  Recompute the quality metrics annotated in FASTQ headers from the base
+  qualities and report annotations that differ by more than the tolerance
+  (e.g., after trimming, which changes the qualities but not the header).
+  A value matches if it is within either the absolute or the relative tolerance.
+  Fails if any mismatch is found, unless --fix is used to rewrite stale annotations.
+
+%s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+
+%s
+  %s
+  %s
+
+`,
+			bold(getColorizedLogo()+" phredsort verify - Checks header quality annotations"),
+			bold(yellow("Description:")),
+			bold(yellow("Flags:")),
+			cyan("-i, --in")+" <string>           : Input FASTQ file (default: stdin), may be repeated or given as arguments",
+			cyan("--tag-source")+" <bool>         : Add the name of the input file to headers (file=<basename>)",
+			cyan("--keep-tags")+" <string>   : Tags of SAM/BAM input records to keep in headers (e.g., 'RG,BC', or 'all') (optional)",
+			cyan("--duplicates")+" <string>       : Check for sequence IDs occurring more than once in the input (ignore, warn, error) (default, 'ignore')",
+			cyan("-o, --out")+" <string>          : Output table of mismatched annotations (default: stdout)",
+			cyan("-H, --header")+" <string>       : Comma-separated list of header metrics to verify (default, all metrics and 'length')",
+			cyan("--header-alias")+" <string>     : Comma-separated metric=key aliases used in headers (e.g., 'maxee=ee')",
+			cyan("-p, --minphred")+" <int>        : Quality threshold for 'lqcount' and 'lqpercent' metrics (default, 15)",
+			cyan("-t, --tolerance")+" <float>     : Absolute tolerance of header values (default, 0.001)",
+			cyan("--rel-tolerance")+" <float>     : Relative tolerance of header values (default, 0.005)",
+			cyan("--fix")+" <string>              : Write all records to this file, with stale annotations rewritten",
+			cyan("--out-format")+" <string> : Sequence format of the --fix output (fasta, fastq) (default, fastq)",
+			cyan("--line-width")+" <int> : Line width of FASTA sequences (default, 0 = no wrapping)",
+			cyan("--header-precision")+" <int>    : Number of decimal places of rewritten values (default, 6)",
+			cyan("--header-digits")+" <int>       : Number of significant digits of rewritten values (overrides --header-precision)",
+			bold(yellow("Examples:")),
+			cyan("phredsort verify --in trimmed.fq.gz --header maxee"),
+			cyan("phredsort verify --in trimmed.fq.gz --fix fixed.fq.gz --out stale.tsv"),
+		)
+		return
+	case "strip":
+		fmt.Printf(`
+%s
+
+%s
+  Remove key=value annotations (by default, all metrics that can be added with
+  --header) from sequence headers, in both space- and semicolon-separated form
+  (e.g., ">seq1 maxee=0.1 length=250" -> ">seq1", ">seq1;size=3;ee=0.1;" -> ">seq1;size=3;").
+  The rest of the header and the order of records are left unchanged.
+
+%s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+
+%s
+  %s
+  %s
+
+`,
+			bold(getColorizedLogo()+" phredsort strip - Removes quality annotations from headers"),
+			bold(yellow("Description:")),
+			bold(yellow("Flags:")),
+			cyan("-i, --in")+" <string>    : Input FASTA/FASTQ file (default: stdin), may be repeated or given as arguments",
+			cyan("--tag-source")+" <bool>  : Add the name of the input file to headers (file=<basename>)",
+			cyan("--keep-tags")+" <string>   : Tags of SAM/BAM input records to keep in headers (e.g., 'RG,BC', or 'all') (optional)",
+			cyan("--duplicates")+" <string> : Check for sequence IDs occurring more than once in the input (ignore, warn, error) (default, 'ignore')",
+			cyan("-o, --out")+" <string>   : Output FASTA/FASTQ file (default: stdout)",
+			cyan("--out-format")+" <string> : Output sequence format (fasta, fastq) (default, same as input)",
+			cyan("--line-width")+" <int> : Line width of FASTA sequences (default, 0 = no wrapping)",
+			cyan("-k, --keys")+" <string>  : Comma-separated list of header keys to remove (default, 'avgphred,maxee,meep,lqcount,lqpercent,length')",
+			bold(yellow("Examples:")),
+			cyan("phredsort strip --in sorted.fq.gz --out clean.fq.gz"),
+			cyan("phredsort strip --in sorted.fa --keys maxee,ee > clean.fa"),
+		)
+		return
+	case "derep":
+		fmt.Printf(`
+%s
+
+%s
+  Collapse identical sequences (case-insensitive) into a single record.
+  The read with the best quality metric becomes the representative; its qualities
+  are kept (--quality best) or replaced by a per-position consensus of all reads
+  (min, max, or mean error probability). Representatives get a ";size=N" annotation
+  and are sorted by size, then by quality. The output is readable by headersort.
+
+%s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+
+%s
+  %s
+  %s
+
+`,
+			bold(getColorizedLogo()+" phredsort derep - Quality-aware dereplication"),
+			bold(yellow("Description:")),
+			bold(yellow("Flags:")),
+			cyan("-i, --in")+" <string>       : Input FASTQ file (default: stdin), may be repeated or given as arguments",
+			cyan("--tag-source")+" <bool>     : Add the name of the input file to headers (file=<basename>)",
+			cyan("--keep-tags")+" <string>   : Tags of SAM/BAM input records to keep in headers (e.g., 'RG,BC', or 'all') (optional)",
+			cyan("--duplicates")+" <string>   : Check for sequence IDs occurring more than once in the input (ignore, warn, error) (default, 'ignore')",
+			cyan("-o, --out")+" <string>      : Output FASTQ file (default: stdout)",
+			cyan("--out-format")+" <string> : Output sequence format (fasta, fastq); FASTA headers keep the size and --header annotations (default, fastq)",
+			cyan("--line-width")+" <int> : Line width of FASTA sequences (default, 0 = no wrapping)",
+			cyan("-s, --metric")+" <string>   : Quality metric used to choose the representative (avgphred, maxee, meep, lqcount, lqpercent) (default, 'avgphred')",
+			cyan("-p, --minphred")+" <int>    : Quality threshold for 'lqcount' and 'lqpercent' metrics (default, 15)",
+			cyan("-q, --quality")+" <string>  : Qualities of the representative (best, min, mean, max) (default, 'best')",
+			cyan("--minsize")+" <int>         : Minimum number of reads of a unique sequence to be written (default, 1)",
+			cyan("--sizein")+" <bool>         : Take abundances from 'size=' annotations of the input headers (default, false)",
+			cyan("-H, --header")+" <string>   : Comma-separated list of metrics to add to headers after 'size' (e.g., 'maxee,length')",
+			cyan("-c, --compress")+" <int>    : Memory compression level (0=disabled, 1-22; default, 1)",
+			bold(yellow("Examples:")),
+			cyan("phredsort derep --in filtered.fq.gz --out derep.fq.gz --metric maxee --header maxee"),
+			cyan("phredsort derep --in filtered.fq.gz --quality mean --minsize 2 | phredsort headersort --metric maxee"),
+		)
+		return
+	case "merge":
+		fmt.Printf(`
+%s
+
+%s
+  Merge FASTA/FASTQ files already sorted by a quality metric (or another header key)
+  into one sorted file, without sorting again. Records are compared like in headersort
+  (by the key value, then by sequence ID), and only one record per file is kept in
+  memory. The run is aborted if an input file turns out not to be sorted.
+
+%s
+  phredsort merge [flags] file1 file2 ...
+
+%s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+
+%s
+  %s
+  %s
+
+`,
+			bold(getColorizedLogo()+" phredsort merge - Merge sorted files"),
+			bold(yellow("Description:")),
+			bold(yellow("Usage:")),
+			bold(yellow("Flags:")),
+			cyan("-i, --in")+" <string>       : Input sequence file (may be repeated, or given as arguments)",
+			cyan("--tag-source")+" <bool>     : Add the name of the input file to headers (file=<basename>)",
+			cyan("--keep-tags")+" <string>   : Tags of SAM/BAM input records to keep in headers (e.g., 'RG,BC', or 'all') (optional)",
+			cyan("--duplicates")+" <string>   : Check for sequence IDs occurring more than once in the input (ignore, warn, error) (default, 'ignore')",
+			cyan("-o, --out")+" <string>      : Output sequence file (default: stdout)",
+			cyan("--out-format")+" <string> : Output sequence format (fasta, fastq) (default, same as input)",
+			cyan("--line-width")+" <int> : Line width of FASTA sequences (default, 0 = no wrapping)",
+			cyan("-s, --metric")+" <string>   : Quality metric the input files are sorted by (default, 'avgphred')",
+			cyan("-a, --ascending")+" <bool>  : Input files are sorted in ascending order (default, false)",
+			cyan("--header-alias")+" <string> : Comma-separated metric=key aliases used in headers (e.g., 'maxee=ee')",
+			cyan("-k, --key")+" <string>      : Header field the input files are sorted by, instead of a quality metric",
+			cyan("--key-type")+" <string>     : Type of --key values (float, int, natural, string) (default, 'float')",
+			bold(yellow("Examples:")),
+			cyan("phredsort merge --metric maxee --out merged.fq.gz lane1.fq.gz lane2.fq.gz lane3.fq.gz"),
+			cyan("phredsort merge --key size --key-type int derep_*.fa > merged.fa"),
+		)
+		return
+	case "check":
+		fmt.Printf(`
+%s
+
+%s
+  Stream a FASTA/FASTQ (or SAM/BAM) file and check that records are sorted by a quality
+  metric, either annotated in the headers (default) or recomputed from the base qualities
+  (--computed, FASTQ only). The command exits with an error at the first record that
+  is out of order, reporting its number. Records with equal values should be ordered
+  by ID in natural order (as in sort and headersort); records that are not are
+  reported, and fail the check with --strict-ties.
+
+%s
+  phredsort check [flags]
+
+%s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+
+%s
+  %s
+  %s
+
+`,
+			bold(getColorizedLogo()+" phredsort check - Check sort order"),
+			bold(yellow("Description:")),
+			bold(yellow("Usage:")),
+			bold(yellow("Flags:")),
+			cyan("-i, --in")+" <string>       : Input sequence file (default: stdin), may be repeated or given as arguments",
+			cyan("-s, --metric")+" <string>   : Quality metric (avgphred, maxee, meep, lqcount, lqpercent) (default, 'avgphred')",
+			cyan("-a, --ascending")+" <bool>  : Expect ascending order of quality (default, false)",
+			cyan("--computed")+" <bool>       : Recompute the metric from base qualities (FASTQ only)",
+			cyan("--header")+" <bool>         : Take the metric from header annotations (default)",
+			cyan("--header-alias")+" <string> : Comma-separated metric=key aliases used in headers (e.g., 'maxee=ee')",
+			cyan("-p, --minphred")+" <int>    : Quality threshold for 'lqcount' and 'lqpercent' (with --computed) (default, 15)",
+			cyan("--strict-ties")+" <bool>    : Fail if records with equal values are not in natural name order",
+			bold(yellow("Examples:")),
+			cyan("phredsort check --metric maxee -i sorted.fa.gz"),
+			cyan("phredsort check --metric avgphred --computed --strict-ties -i sorted.fq.gz"),
 		)
 		return
 	}
@@ -160,11 +712,43 @@ func helpFunc(cmd *cobra.Command, args []string) {
   %s
   %s
   %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
 
 %s
   %s
   %s
   %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
+  %s
 
 %s
   # Sort by average Phred score (file-based)
@@ -196,21 +780,53 @@ func helpFunc(cmd *cobra.Command, args []string) {
 		cyan("lqcount")+"   : number of bases below quality threshold (default, 15)",
 		cyan("lqpercent")+" : percentage of bases below quality threshold",
 		bold(yellow("Flags:")),
-		cyan("-i, --in")+" <string>      : Input FASTQ file (default: stdin)",
-		cyan("-o, --out")+" <string>     : Output FASTQ file (default: stdout)",
+		cyan("-i, --in")+" <string>      : Input FASTQ file (default: stdin), may be repeated or given as arguments",
+		cyan("--tag-source")+" <bool>    : Add the name of the input file to headers (file=<basename>)",
+		cyan("--keep-tags")+" <string>   : Tags of SAM/BAM input records to keep in headers (e.g., 'RG,BC', or 'all') (optional)",
+		cyan("--duplicates")+" <string>  : Check for sequence IDs occurring more than once in the input (ignore, warn, error) (default, 'ignore')",
+		cyan("-o, --out")+" <string>     : Output FASTQ file (default: stdout); a .sam or .bam file gets unaligned SAM/BAM with --header metrics as tags (e.g., XE:f)",
+		cyan("--out-format")+" <string> : Output sequence format (fasta, fastq); FASTA headers keep the --header annotations (default, fastq)",
+		cyan("--line-width")+" <int> : Line width of FASTA sequences (default, 0 = no wrapping)",
 		cyan("-s, --metric")+" <string>  : Quality metric (avgphred, maxee, meep, lqcount, lqpercent) (default, 'avgphred')",
 		cyan("-m, --minqual")+" <float>  : Minimum quality threshold for filtering (optional)",
 		cyan("-M, --maxqual")+" <float>  : Maximum quality threshold for filtering (optional)",
 		cyan("-p, --minphred")+" <int>   : Quality threshold for 'lqcount' and 'lqpercent' metrics (default, 15)",
 		cyan("-H, --header")+" <string>  : Comma-separated list of metrics to add to headers (e.g., 'avgphred,maxee,length')",
+		cyan("--header-sep")+" <string> : Separator of header annotations ('space' or 'semicolon') (default, 'space')",
+		cyan("--header-trailing")+" : Terminate header annotations with ';' (requires --header-sep semicolon)",
+		cyan("--header-alias")+" <string> : Comma-separated metric=key aliases for header annotations (e.g., 'maxee=ee')",
+		cyan("--header-precision")+" <int> : Number of decimal places of metric values in headers (default, 6)",
+		cyan("--header-digits")+" <int> : Number of significant digits of metric values in headers (overrides --header-precision)",
+		cyan("--on-existing")+" <string> : What to do with header keys that already exist (replace, keep, append, error) (default, 'replace')",
 		cyan("-a, --ascending")+" <bool> : Sort sequences in ascending order of quality (default, false)",
 		cyan("-c, --compress")+" <int>   : Memory compression level (0=disabled, 1-22; default, 1)",
+		cyan("--html")+" <string>        : Write a self-contained HTML QC report to this file (optional)",
+		cyan("--metrics-out")+" <string> : Write per-record metrics (--header metrics, or the sorting metric and length) to this table instead of annotating headers",
+		cyan("--metrics-format")+" <string> : Format of the --metrics-out table (tsv, jsonl, parquet; parquet if the file name ends with .parquet) (default, 'tsv')",
+		cyan("--group-by")+" <string> : Group records by a header key (e.g., 'umi') or a regular expression matched against the header (optional)",
+		cyan("--within")+" <string> : Sort records within groups (header key, e.g., 'sample', or a regular expression); groups are written one after another (optional)",
+		cyan("--per-group")+" <int> : Maximum number of best-quality records written per group (default, 0 = no limit)",
+		cyan("--group-order")+" <string> : Order of groups: 'global' (by quality, --group-by only), 'natural' or 'size' (default, 'global'; 'natural' with --within)",
+		cyan("--out-pattern")+" <string> : Write output to several files named after this pattern, with {bin} and/or {part} (e.g., 'tier_{bin}.fq.gz') (optional)",
+		cyan("--bins")+" <string> : Comma-separated metric breakpoints splitting the output into quality tiers (e.g., '0.5,1,2') (optional)",
+		cyan("--bin-labels")+" <string> : Comma-separated names of the tiers used for {bin} (e.g., 'gold,silver,bronze,rest') (default, 1, 2, ...)",
+		cyan("--split-records")+" <int> : Start a new output file (next {part}) every N records (optional)",
+		cyan("--split-bases")+" <int> : Start a new output file (next {part}) every N bases (optional)",
 		cyan("-h, --help")+"             : Show help message",
 		cyan("-v, --version")+"          : Show version information",
 		bold(yellow("Subcommands:")),
 		cyan("sort")+"       : Sort sequences by computing quality metrics from base qualities",
 		cyan("nosort")+"     : Estimate quality and optionally filter/annotate without sorting",
 		cyan("headersort")+" : Sort sequences using pre-computed quality scores in headers",
+		cyan("stats")+"      : Summarize quality metrics and per-position quality profile",
+		cyan("hist")+"       : Draw a histogram of quality metric distribution in the terminal",
+		cyan("thresholds")+" : Recommend quality thresholds for target fractions of retained reads or bases",
+		cyan("trunclen")+"   : Recommend a truncation length for a given maxEE cutoff",
+		cyan("verify")+"     : Check header quality annotations against recomputed metrics",
+		cyan("strip")+"      : Remove quality annotations from sequence headers",
+		cyan("derep")+"      : Dereplicate sequences, keeping the best-quality read as the representative",
+		cyan("merge")+"      : Merge files already sorted by a header key into one sorted file",
+		cyan("check")+"      : Check that sequences are sorted by a quality metric",
 		bold(yellow("Usage examples:")),
 		cyan("phredsort --metric avgphred --in input.fq.gz --out output.fq.gz"),
 		cyan("cat input.fq | phredsort --compress 0 > sorted.fq"),
@@ -0,0 +1,223 @@
+// Histograms of per-read metric distributions and their terminal rendering
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// Unicode block elements used for fractional bar widths (1/8 steps)
+// and sparkline heights
+var (
+	barBlocks       = []rune{' ', '▏', '▎', '▍', '▌', '▋', '▊', '▉', '█'}
+	sparklineBlocks = []rune{'▁', '▂', '▃', '▄', '▅', '▆', '▇', '█'}
+	green           = color.New(color.FgGreen).SprintFunc()
+	faint           = color.New(color.Faint).SprintFunc()
+)
+
+// MetricHistogram is a binned distribution of per-read metric values.
+// With a logarithmic x-axis, bin edges are evenly spaced in log10 space and
+// non-positive values (which can't be shown on a log axis) are counted in NonPositive.
+// Infinite or NaN values (e.g., maxEE of zero-length reads) are counted in Undefined
+type MetricHistogram struct {
+	Edges       []float64 // len(Counts)+1 bin edges (in linear space)
+	Counts      []uint64
+	LogX        bool
+	NonPositive uint64
+	Undefined   uint64
+}
+
+// NewMetricHistogram bins the observed metric values into nBins bins spanning
+// the range of finite values
+func NewMetricHistogram(observations []MetricObservation, nBins int, logX bool) *MetricHistogram {
+	if nBins < 1 {
+		nBins = 1
+	}
+	h := &MetricHistogram{
+		Counts: make([]uint64, nBins),
+		LogX:   logX,
+	}
+
+	// Find the range of values that can be binned
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, obs := range observations {
+		v := obs.Value
+		if math.IsInf(v, 0) || math.IsNaN(v) || (logX && v <= 0) {
+			continue
+		}
+		if logX {
+			v = math.Log10(v)
+		}
+		lo = math.Min(lo, v)
+		hi = math.Max(hi, v)
+	}
+	if math.IsInf(lo, 1) {
+		lo, hi = 0, 1
+	}
+	if hi == lo {
+		hi = lo + 1
+	}
+
+	width := (hi - lo) / float64(nBins)
+	h.Edges = make([]float64, nBins+1)
+	for i := range h.Edges {
+		e := lo + float64(i)*width
+		if logX {
+			e = math.Pow(10, e)
+		}
+		h.Edges[i] = e
+	}
+
+	for _, obs := range observations {
+		v := obs.Value
+		switch {
+		case math.IsInf(v, 0) || math.IsNaN(v):
+			h.Undefined++
+			continue
+		case logX && v <= 0:
+			h.NonPositive++
+			continue
+		}
+		if logX {
+			v = math.Log10(v)
+		}
+		bin := int((v - lo) / width)
+		if bin >= nBins {
+			bin = nBins - 1
+		}
+		if bin < 0 {
+			bin = 0
+		}
+		h.Counts[bin]++
+	}
+
+	return h
+}
+
+// MaxCount returns the largest bin count
+func (h *MetricHistogram) MaxCount() uint64 {
+	var peak uint64
+	for _, c := range h.Counts {
+		if c > peak {
+			peak = c
+		}
+	}
+	return peak
+}
+
+// Sparkline renders bin counts as a single line of block characters
+func (h *MetricHistogram) Sparkline() string {
+	peak := h.MaxCount()
+	var sb strings.Builder
+	for _, c := range h.Counts {
+		if peak == 0 || c == 0 {
+			sb.WriteRune(' ')
+			continue
+		}
+		level := int(float64(c) / float64(peak) * float64(len(sparklineBlocks)-1))
+		sb.WriteRune(sparklineBlocks[level])
+	}
+	return sb.String()
+}
+
+// renderBar draws a horizontal bar of `fraction` (0..1) of the given width,
+// using 1/8-character block elements for sub-character precision
+func renderBar(fraction float64, width int) string {
+	if fraction < 0 {
+		fraction = 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	eighths := int(math.Round(fraction * float64(width*8)))
+	full := eighths / 8
+	rem := eighths % 8
+
+	var sb strings.Builder
+	sb.WriteString(strings.Repeat(string(barBlocks[8]), full))
+	if rem > 0 {
+		sb.WriteRune(barBlocks[rem])
+		full++
+	}
+	sb.WriteString(strings.Repeat(" ", width-full))
+	return sb.String()
+}
+
+// Render draws the histogram as horizontal bars, one row per bin.
+// Bins outside the [minQual, maxQual] range are dimmed and cut lines are drawn
+// between rows where a threshold falls. With logY, bar lengths are proportional
+// to log10(count + 1)
+func (h *MetricHistogram) Render(width int, logY bool, minQual, maxQual float64) string {
+	if width < 1 {
+		width = 1
+	}
+	peak := max(h.MaxCount(), h.NonPositive, h.Undefined)
+	scale := func(c uint64) float64 {
+		if peak == 0 {
+			return 0
+		}
+		if logY {
+			return math.Log10(float64(c)+1) / math.Log10(float64(peak)+1)
+		}
+		return float64(c) / float64(peak)
+	}
+
+	var sb strings.Builder
+	row := func(label string, count uint64, retained bool) {
+		line := fmt.Sprintf("%-25s %s %d", label, renderBar(scale(count), width), count)
+		if retained {
+			sb.WriteString(green(line))
+		} else {
+			sb.WriteString(faint(line))
+		}
+		sb.WriteByte('\n')
+	}
+	cut := func(name string, value float64) {
+		sb.WriteString(red(fmt.Sprintf("%s %s=%g\n", strings.Repeat("─", 25), name, value)))
+	}
+
+	hasMin := minQual > -math.MaxFloat64
+	hasMax := maxQual < math.MaxFloat64
+	minDrawn, maxDrawn := false, false
+
+	if h.NonPositive > 0 {
+		row("(-inf, 0]", h.NonPositive, minQual <= 0 && 0 <= maxQual)
+	}
+	for i, c := range h.Counts {
+		lo, hi := h.Edges[i], h.Edges[i+1]
+		if hasMin && !minDrawn && minQual < hi {
+			cut("minqual", minQual)
+			minDrawn = true
+		}
+		if hasMax && !maxDrawn && maxQual < lo {
+			cut("maxqual", maxQual)
+			maxDrawn = true
+		}
+		retained := hi > minQual && lo <= maxQual
+		row(fmt.Sprintf("[%.4g, %.4g%s", lo, hi, closingBracket(i, len(h.Counts))), c, retained)
+	}
+	if hasMin && !minDrawn {
+		cut("minqual", minQual)
+	}
+	if hasMax && !maxDrawn {
+		cut("maxqual", maxQual)
+	}
+	if h.Undefined > 0 {
+		row("undefined (inf)", h.Undefined, math.Inf(1) <= maxQual)
+	}
+
+	return sb.String()
+}
+
+// closingBracket returns the closing bracket of a bin interval label
+// (the last bin is closed on the right)
+func closingBracket(i, n int) string {
+	if i == n-1 {
+		return "]"
+	}
+	return ")"
+}
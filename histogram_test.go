@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func TestNewMetricHistogramLinear(t *testing.T) {
+	observations := []MetricObservation{
+		{Value: 0, Length: 10},
+		{Value: 1, Length: 10},
+		{Value: 2, Length: 10},
+		{Value: 4, Length: 10},
+		{Value: math.Inf(1), Length: 0},
+	}
+
+	h := NewMetricHistogram(observations, 4, false)
+	if want := []uint64{1, 1, 1, 1}; !reflect.DeepEqual(h.Counts, want) {
+		t.Errorf("Counts = %v, want %v", h.Counts, want)
+	}
+	if want := []float64{0, 1, 2, 3, 4}; !reflect.DeepEqual(h.Edges, want) {
+		t.Errorf("Edges = %v, want %v", h.Edges, want)
+	}
+	if h.Undefined != 1 {
+		t.Errorf("Undefined = %d, want 1", h.Undefined)
+	}
+}
+
+func TestNewMetricHistogramLogX(t *testing.T) {
+	observations := []MetricObservation{
+		{Value: 0}, {Value: 0.01}, {Value: 0.1}, {Value: 1}, {Value: 1},
+	}
+
+	h := NewMetricHistogram(observations, 2, true)
+	if h.NonPositive != 1 {
+		t.Errorf("NonPositive = %d, want 1", h.NonPositive)
+	}
+	if want := []uint64{1, 3}; !reflect.DeepEqual(h.Counts, want) {
+		t.Errorf("Counts = %v, want %v", h.Counts, want)
+	}
+	if math.Abs(h.Edges[1]-0.1) > 1e-12 {
+		t.Errorf("middle edge = %v, want 0.1", h.Edges[1])
+	}
+}
+
+func TestRenderNonPositiveRetention(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = false
+	defer func() { color.NoColor = noColor }()
+
+	h := NewMetricHistogram([]MetricObservation{{Value: 0}, {Value: 1}}, 1, true)
+	for _, tt := range []struct {
+		minQual, maxQual float64
+		retained         bool
+	}{
+		{-math.MaxFloat64, math.MaxFloat64, true},
+		{0.5, math.MaxFloat64, false},
+		{-math.MaxFloat64, -1, false},
+	} {
+		var row string
+		for _, line := range strings.Split(h.Render(10, false, tt.minQual, tt.maxQual), "\n") {
+			if strings.Contains(line, "(-inf, 0]") {
+				row = line
+			}
+		}
+		greenPrefix := strings.TrimSuffix(green("x"), "x\x1b[0m")
+		if retained := strings.HasPrefix(row, greenPrefix); retained != tt.retained {
+			t.Errorf("Render(minqual=%g, maxqual=%g): (-inf, 0] retained = %v, want %v", tt.minQual, tt.maxQual, retained, tt.retained)
+		}
+	}
+}
+
+func TestRenderBar(t *testing.T) {
+	tests := []struct {
+		fraction float64
+		width    int
+		want     string
+	}{
+		{0, 4, "    "},
+		{1, 4, "████"},
+		{0.5, 4, "██  "},
+		{0.5625, 4, "██▎ "},
+		{2, 2, "██"},
+	}
+	for _, tt := range tests {
+		if got := renderBar(tt.fraction, tt.width); got != tt.want {
+			t.Errorf("renderBar(%v, %d) = %q, want %q", tt.fraction, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestComputeRetention(t *testing.T) {
+	observations := []MetricObservation{
+		{Value: 0.5, Length: 100},
+		{Value: 1.5, Length: 50},
+		{Value: math.Inf(1), Length: 0},
+		{Value: 0.9, Length: 50},
+	}
+
+	r := computeRetention(observations, -math.MaxFloat64, 1)
+	if r.Reads != 2 || r.TotalReads != 4 || r.Bases != 150 || r.TotalBases != 200 {
+		t.Fatalf("retention = %+v, want 2/4 reads and 150/200 bases", r)
+	}
+	if r.ReadFraction() != 0.5 || r.BaseFraction() != 0.75 {
+		t.Fatalf("fractions = %v/%v, want 0.5/0.75", r.ReadFraction(), r.BaseFraction())
+	}
+	if (Retention{}).ReadFraction() != 0 {
+		t.Fatalf("empty retention fraction should be 0")
+	}
+}
+
+func TestRunHist(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("read1", "ACGT", "IIII"),
+		createTestRecord("read2", "ACGT", "++++"),
+		createTestRecord("read3", "AC", "55"),
+	})
+
+	var buf bytes.Buffer
+	if err := runHist(&buf, testInput(inputPath), MaxEE, DEFAULT_MIN_PHRED, -math.MaxFloat64, 0.3, 5, 10, false, true); err != nil {
+		t.Fatalf("runHist() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"Distribution of maxee (3 reads)", "maxqual=0.3", "Reads retained: 2 / 3", "Bases retained: 6 / 10"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("runHist() output missing %q, got:\n%s", want, out)
+		}
+	}
+}
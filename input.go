@@ -0,0 +1,406 @@
+// Reading of several input files (repeated --in, positional arguments, globs) as one logical input
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+// DuplicatePolicy defines what happens when a sequence ID occurs more than once in the input
+type DuplicatePolicy int
+
+const (
+	DuplicatesIgnore DuplicatePolicy = iota // Don't check sequence IDs
+	DuplicatesWarn                          // Report the number of duplicate IDs at the end of the input
+	DuplicatesError                         // Fail at the first duplicate ID
+)
+
+// String returns the string representation of a DuplicatePolicy
+func (p DuplicatePolicy) String() string {
+	switch p {
+	case DuplicatesIgnore:
+		return "ignore"
+	case DuplicatesWarn:
+		return "warn"
+	case DuplicatesError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// parseDuplicatePolicy parses the value of the --duplicates flag
+func parseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	switch s {
+	case "ignore":
+		return DuplicatesIgnore, nil
+	case "warn":
+		return DuplicatesWarn, nil
+	case "error":
+		return DuplicatesError, nil
+	default:
+		return DuplicatesIgnore, fmt.Errorf("invalid --duplicates policy: %s (must be 'ignore', 'warn' or 'error')", s)
+	}
+}
+
+// Input is one or more sequence files read one after another as a single input
+type Input struct {
+	Files      []string        // Input files ("-" for stdin)
+	TagSource  bool            // Add file=<basename> to the header of each record
+	Duplicates DuplicatePolicy // Check that sequence IDs are unique across all files
+	Format     HeaderFormat    // Syntax of the file= annotation (see HeaderFormat.Annotate)
+	KeepTags   TagFilter       // Tags of SAM/BAM records appended to headers
+}
+
+// parseInput collects the input files of a command from the --in flag (which may be
+// repeated) and positional arguments. Glob patterns are expanded (for patterns the
+// shell has not expanded, e.g. quoted ones), and stdin is used if no file is given
+func parseInput(cmd *cobra.Command, inFiles, args []string, tagSource bool, duplicates string) (Input, error) {
+	policy, err := parseDuplicatePolicy(duplicates)
+	if err != nil {
+		return Input{}, err
+	}
+
+	// The default of --in ("-") is replaced by positional arguments
+	patterns := args
+	if len(args) == 0 || cmd.Flags().Changed("in") {
+		patterns = append(append([]string{}, inFiles...), args...)
+	}
+
+	files, err := expandInputFiles(patterns)
+	if err != nil {
+		return Input{}, err
+	}
+	return Input{Files: files, TagSource: tagSource, Duplicates: policy, Format: defaultHeaderFormat}, nil
+}
+
+// expandInputFiles expands glob patterns (in the order given, with matches of each
+// pattern sorted by name) and checks that no file is given twice
+func expandInputFiles(patterns []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, p := range patterns {
+		matches := []string{p}
+		if p != "-" && strings.ContainsAny(p, "*?[") {
+			var err error
+			matches, err = filepath.Glob(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid input pattern %s: %v", p, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no input files match %s", p)
+			}
+		}
+		for _, f := range matches {
+			if seen[f] {
+				if f == "-" {
+					return nil, fmt.Errorf("stdin ('-') can be used as input only once")
+				}
+				return nil, fmt.Errorf("input file %s is given more than once", f)
+			}
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	return files, nil
+}
+
+// sourceTag returns the value of the file= annotation of an input file
+func sourceTag(file string) string {
+	if file == "-" {
+		return "stdin"
+	}
+	return filepath.Base(file)
+}
+
+// duplicateIDs keeps track of the sequence IDs seen so far in an input
+type duplicateIDs struct {
+	policy DuplicatePolicy
+	files  []string
+	seen   map[string]int // ID -> index of the file it was first seen in
+	count  int
+	first  string // Description of the first duplicate
+}
+
+func newDuplicateIDs(policy DuplicatePolicy, files []string) *duplicateIDs {
+	if policy == DuplicatesIgnore {
+		return nil
+	}
+	return &duplicateIDs{policy: policy, files: files, seen: make(map[string]int)}
+}
+
+// uniqueID returns the sequence ID of a header (its first word, without
+// semicolon-separated annotations such as ";size=10")
+func uniqueID(name []byte) string {
+	if i := bytes.IndexAny(name, " \t"); i >= 0 {
+		name = name[:i]
+	}
+	if i := bytes.IndexByte(name, ';'); i >= 0 {
+		name = name[:i]
+	}
+	return string(name)
+}
+
+// Add records the ID of a record read from the file with the given index.
+// Returns an error for a duplicate ID if the policy is DuplicatesError
+func (d *duplicateIDs) Add(name []byte, file int) error {
+	if d == nil {
+		return nil
+	}
+	id := uniqueID(name)
+	first, exists := d.seen[id]
+	if !exists {
+		d.seen[id] = file
+		return nil
+	}
+
+	d.count++
+	if d.first == "" {
+		d.first = fmt.Sprintf("%s in %s (first seen in %s)", id, d.files[file], d.files[first])
+	}
+	if d.policy == DuplicatesError {
+		return fmt.Errorf("duplicate sequence ID %s", d.first)
+	}
+	return nil
+}
+
+// Warn prints the number of duplicate IDs found (with DuplicatesWarn)
+func (d *duplicateIDs) Warn(w io.Writer) {
+	if d == nil || d.count == 0 || d.policy != DuplicatesWarn {
+		return
+	}
+	fmt.Fprintln(w, yellow(fmt.Sprintf("Warning: %d duplicate sequence IDs in the input; first: %s", d.count, d.first)))
+}
+
+// recordSource reads the records of one input file
+type recordSource interface {
+	Read() (*fastx.Record, error)
+	Fastq() bool // Whether the records have qualities (set after the first record is read)
+	Close()
+}
+
+// fastxSource is a FASTA/FASTQ file
+type fastxSource struct {
+	*fastx.Reader
+	fh *xopen.Reader
+}
+
+func (s fastxSource) Fastq() bool { return s.IsFastq }
+
+func (s fastxSource) Close() {
+	s.Reader.Close()
+	s.fh.Close()
+}
+
+// emptySource is an empty file
+type emptySource struct{}
+
+func (emptySource) Read() (*fastx.Record, error) { return nil, io.EOF }
+func (emptySource) Fastq() bool                  { return false }
+func (emptySource) Close()                       {}
+
+// openRecordSource opens an input file, detecting whether it is FASTA/FASTQ,
+// SAM or BAM (also when compressed). Returns the source and the SAM header of the file
+func openRecordSource(file string, keep TagFilter) (recordSource, []byte, error) {
+	fh, err := xopen.Ropen(file)
+	if err == xopen.ErrNoContent {
+		return emptySource{}, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if format := detectInputFormat(fh.Reader); format != formatFastx {
+		reader, err := newUnalignedReader(fh, format == formatBAM, keep)
+		if err != nil {
+			fh.Close()
+			return nil, nil, fmt.Errorf("%s: %v", file, err)
+		}
+		return reader, reader.Header(), nil
+	}
+
+	reader, err := fastx.NewReaderFromIO(seq.DNAredundant, fh, fastx.DefaultIDRegexp)
+	if err != nil {
+		fh.Close()
+		return nil, nil, err
+	}
+	return fastxSource{reader, fh}, nil, nil
+}
+
+// InputReader reads the records of all files of an Input as a single stream,
+// with the same interface as fastx.Reader. All files must be of the same format
+// (FASTA, or FASTQ and SAM/BAM with qualities)
+type InputReader struct {
+	IsFastq bool // Format of the input (set after the first record is read)
+
+	in      Input
+	file    int // Index of the current file
+	reader  recordSource
+	header  []byte // SAM header of the first file
+	started bool   // Whether a record has been read
+	dups    *duplicateIDs
+
+	stop chan struct{} // Closed to stop the ChunkChan goroutine
+	done chan struct{} // Closed when the ChunkChan goroutine has exited
+}
+
+// NewInputReader opens the first file of an Input, after checking that all
+// the other files exist (so that a typo doesn't fail the run halfway through)
+func NewInputReader(in Input) (*InputReader, error) {
+	if len(in.Files) == 0 {
+		in.Files = []string{"-"}
+	}
+	for _, f := range in.Files[1:] {
+		if _, err := os.Stat(f); err != nil && f != "-" {
+			return nil, err
+		}
+	}
+
+	reader, header, err := openRecordSource(in.Files[0], in.KeepTags)
+	if err != nil {
+		return nil, err
+	}
+	return &InputReader{in: in, reader: reader, header: header, dups: newDuplicateIDs(in.Duplicates, in.Files)}, nil
+}
+
+// SAMHeader returns the SAM header of the first file (nil for FASTA/FASTQ input)
+func (r *InputReader) SAMHeader() []byte {
+	return r.header
+}
+
+// File returns the name of the file the last record was read from
+func (r *InputReader) File() string {
+	return r.in.Files[r.file]
+}
+
+// Read returns the next record; the record is reused by subsequent calls
+func (r *InputReader) Read() (*fastx.Record, error) {
+	for {
+		record, err := r.reader.Read()
+		if err == io.EOF {
+			if r.file+1 >= len(r.in.Files) {
+				r.dups.Warn(os.Stderr)
+				r.dups = nil // Warn only once
+				return nil, io.EOF
+			}
+			r.reader.Close()
+			r.file++
+			// Don't leave a closed reader behind if the next file can't be opened
+			reader, _, err := openRecordSource(r.in.Files[r.file], r.in.KeepTags)
+			if err != nil {
+				r.reader = nil
+				return nil, err
+			}
+			r.reader = reader
+			continue
+		}
+		if err != nil {
+			if len(r.in.Files) > 1 {
+				return nil, fmt.Errorf("%s: %v", r.File(), err)
+			}
+			return nil, err
+		}
+
+		if !r.started {
+			r.started = true
+			r.IsFastq = r.reader.Fastq()
+		} else if r.reader.Fastq() != r.IsFastq {
+			return nil, fmt.Errorf("input files must all be FASTA or all FASTQ: %s differs from the preceding files", r.File())
+		}
+		if !r.IsFastq {
+			// Pooled readers may keep qualities of a previously read FASTQ file
+			record.Seq.Qual = nil
+		}
+
+		if err := r.dups.Add(record.Name, r.file); err != nil {
+			return nil, err
+		}
+		if r.in.TagSource {
+			// Copy the header, since it may share its buffer with the sequence
+			name := append([]byte(nil), record.Name...)
+			if record.Name, err = r.in.Format.Annotate(name, []HeaderAnnotation{{"file", sourceTag(r.File())}}); err != nil {
+				return nil, err
+			}
+		}
+		return record, nil
+	}
+}
+
+// ChunkChan reads records asynchronously (like fastx.Reader.ChunkChan) and
+// sends copies of them in chunks of chunkSize records. The consumer may stop
+// receiving at any point; Close then stops the reading goroutine
+func (r *InputReader) ChunkChan(bufferSize, chunkSize int) chan fastx.RecordChunk {
+	ch := make(chan fastx.RecordChunk, bufferSize)
+	r.stop, r.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(r.done)
+		defer close(ch)
+
+		// send returns false if the reader was closed
+		send := func(chunk fastx.RecordChunk) bool {
+			select {
+			case ch <- chunk:
+				return true
+			case <-r.stop:
+				return false
+			}
+		}
+
+		var id uint64
+		chunk := make([]*fastx.Record, 0, chunkSize)
+		for {
+			select {
+			case <-r.stop:
+				return
+			default:
+			}
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				send(fastx.RecordChunk{ID: id, Data: chunk, Err: err})
+				return
+			}
+			chunk = append(chunk, record.Clone())
+			if len(chunk) == chunkSize {
+				if !send(fastx.RecordChunk{ID: id, Data: chunk}) {
+					return
+				}
+				id++
+				chunk = make([]*fastx.Record, 0, chunkSize)
+			}
+		}
+		if len(chunk) > 0 {
+			send(fastx.RecordChunk{ID: id, Data: chunk})
+		}
+	}()
+	return ch
+}
+
+// Close closes the current file, after stopping the ChunkChan goroutine
+// (if any), so that the reader isn't released while it is still in use
+func (r *InputReader) Close() {
+	if r.stop != nil {
+		close(r.stop)
+		<-r.done
+		r.stop = nil
+	}
+	if r.reader != nil {
+		r.reader.Close()
+		r.reader = nil
+	}
+}
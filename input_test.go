@@ -0,0 +1,267 @@
+package main
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/spf13/cobra"
+)
+
+// testInput returns an Input reading the given files one after another
+func testInput(files ...string) Input {
+	return Input{Files: files}
+}
+
+// readInputNames reads all record names of an Input
+func readInputNames(t *testing.T, in Input) ([]string, error) {
+	t.Helper()
+
+	reader, err := NewInputReader(in)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var names []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return names, err
+		}
+		names = append(names, string(record.Name))
+	}
+}
+
+func TestParseInput(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"lane1.fq", "lane2.fq", "lane10.fq", "other.fa"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+
+	tests := []struct {
+		name    string
+		flags   []string // Values of --in
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{name: "Default is stdin", want: []string{"-"}},
+		{name: "Positional arguments replace stdin", args: []string{path("lane1.fq"), path("other.fa")}, want: []string{path("lane1.fq"), path("other.fa")}},
+		{name: "Repeated --in and arguments", flags: []string{path("other.fa")}, args: []string{path("lane2.fq")}, want: []string{path("other.fa"), path("lane2.fq")}},
+		{name: "Glob", args: []string{path("lane*.fq")}, want: []string{path("lane1.fq"), path("lane10.fq"), path("lane2.fq")}},
+		{name: "Glob without matches", args: []string{path("*.fastq")}, wantErr: "no input files match"},
+		{name: "File given twice", args: []string{path("lane1.fq"), path("lane?.fq")}, wantErr: "given more than once"},
+		{name: "Stdin given twice", flags: []string{"-", "-"}, wantErr: "only once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inFiles []string
+			cmd := &cobra.Command{}
+			cmd.Flags().StringArrayVarP(&inFiles, "in", "i", []string{"-"}, "")
+			for _, f := range tt.flags {
+				if err := cmd.Flags().Set("in", f); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			in, err := parseInput(cmd, inFiles, tt.args, true, "warn")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseInput() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseInput() error = %v", err)
+			}
+			if !reflect.DeepEqual(in.Files, tt.want) || !in.TagSource || in.Duplicates != DuplicatesWarn {
+				t.Errorf("parseInput() = %+v, want files %v", in, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseInput(&cobra.Command{}, nil, nil, false, "skip"); err == nil {
+		t.Error("parseInput() expected an error for an invalid --duplicates policy")
+	}
+}
+
+func TestInputReader(t *testing.T) {
+	tmpDir := t.TempDir()
+	lane1 := filepath.Join(tmpDir, "lane1.fq")
+	lane2 := filepath.Join(tmpDir, "lane2.fq")
+	empty := filepath.Join(tmpDir, "empty.fq")
+	fasta := filepath.Join(tmpDir, "seqs.fa")
+	writeFastqRecords(t, lane1, []*fastx.Record{
+		createTestRecord("r1", "ACGT", "IIII"),
+		createTestRecord("r2;size=3", "ACGT", "IIII"),
+	})
+	writeFastqRecords(t, lane2, []*fastx.Record{
+		createTestRecord("r3 sample=A", "ACGT", "IIII"),
+		createTestRecord("r2;size=5", "ACGT", "IIII"),
+	})
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fasta, []byte(">s1\nACGT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		in      Input
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "Files are read one after another",
+			in:   testInput(lane1, empty, lane2),
+			want: []string{"r1", "r2;size=3", "r3 sample=A", "r2;size=5"},
+		},
+		{
+			name: "Source tags",
+			in:   Input{Files: []string{lane1, lane2}, TagSource: true},
+			want: []string{"r1 file=lane1.fq", "r2;size=3 file=lane1.fq", "r3 sample=A file=lane2.fq", "r2;size=5 file=lane2.fq"},
+		},
+		{
+			name: "Source tags in semicolon format",
+			in:   Input{Files: []string{lane1}, TagSource: true, Format: HeaderFormat{Semicolon: true, Trailing: true}},
+			want: []string{"r1;file=lane1.fq;", "r2;size=3;file=lane1.fq;"},
+		},
+		{
+			name: "Duplicate IDs are reported as warnings",
+			in:   Input{Files: []string{lane1, lane2}, Duplicates: DuplicatesWarn},
+			want: []string{"r1", "r2;size=3", "r3 sample=A", "r2;size=5"},
+		},
+		{
+			name:    "Duplicate IDs across files",
+			in:      Input{Files: []string{lane1, lane2}, Duplicates: DuplicatesError},
+			wantErr: "duplicate sequence ID r2 in " + lane2 + " (first seen in " + lane1 + ")",
+		},
+		{
+			name:    "Mixed formats",
+			in:      testInput(lane1, fasta),
+			wantErr: "must all be FASTA or all FASTQ",
+		},
+		{
+			name:    "Missing file",
+			in:      testInput(lane1, filepath.Join(tmpDir, "missing.fq")),
+			wantErr: "missing.fq",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readInputNames(t, tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Read() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortRecordsMultipleInputs(t *testing.T) {
+	tmpDir := t.TempDir()
+	lane1 := filepath.Join(tmpDir, "lane1.fq")
+	lane2 := filepath.Join(tmpDir, "lane2.fq")
+	writeFastqRecords(t, lane1, []*fastx.Record{
+		createTestRecord("a1", "ACGT", "5555"), // Q20
+		createTestRecord("a2", "ACGT", "IIII"), // Q40
+	})
+	writeFastqRecords(t, lane2, []*fastx.Record{
+		createTestRecord("b1", "ACGT", "????"), // Q30
+		createTestRecord("b2", "ACGT", "++++"), // Q10
+	})
+
+	for _, compLevel := range []int{0, 1} {
+		outputPath := filepath.Join(tmpDir, "sorted.fq")
+		in := Input{Files: []string{lane1, lane2}, TagSource: true, Format: defaultHeaderFormat}
+		sortRecords(in, outputPath, false, AvgPhred, compLevel, nil, defaultHeaderFormat, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{})
+
+		got, err := readInputNames(t, testInput(outputPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"a2 file=lane1.fq", "b1 file=lane2.fq", "a1 file=lane1.fq", "b2 file=lane2.fq"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("compLevel %d: sortRecords() = %v, want %v", compLevel, got, want)
+		}
+	}
+}
+
+func TestRunCheckMultipleFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	part1 := filepath.Join(tmpDir, "part_001.fa")
+	part2 := filepath.Join(tmpDir, "part_002.fa")
+	if err := os.WriteFile(part1, []byte(">s1 maxee=0.1\nA\n>s2 maxee=0.5\nA\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(part2, []byte(">s3 maxee=0.2\nA\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first record of a file is compared with the last one of the preceding file
+	summary, err := runCheck(testInput(part1, part2), metricSortKey(MaxEE, nil), false, false, DEFAULT_MIN_PHRED, false)
+	if err != nil {
+		t.Fatalf("runCheck() error = %v", err)
+	}
+	want := part2 + ": record 1: s3 (maxee=0.2) should precede s2 (maxee=0.5)"
+	if summary.Violation != want {
+		t.Errorf("violation = %q, want %q", summary.Violation, want)
+	}
+}
+
+func TestInputReaderCloseStopsChunkChan(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "seqs.fa")
+	var sb strings.Builder
+	sb.WriteString(">s0\nACGT\n") // Missing the sort key
+	for i := 1; i < 50000; i++ {
+		sb.WriteString(">s" + strconv.Itoa(i) + " maxee=0.1\nACGT\n")
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing the reader while chunks are still being read
+	reader, err := NewInputReader(testInput(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := reader.ChunkChan(1, 10)
+	if chunk := <-ch; chunk.Err != nil || len(chunk.Data) != 10 {
+		t.Fatalf("first chunk = %d records, %v", len(chunk.Data), chunk.Err)
+	}
+	reader.Close()
+	for range ch { // The channel is closed once the goroutine has stopped
+	}
+
+	// headersort returns on the first record, with the remaining records unread
+	outPath := filepath.Join(tmpDir, "out.fa")
+	err = runPresort(testInput(path), outPath, metricSortKey(MaxEE, nil), false, 0, -math.MaxFloat64, math.MaxFloat64, MissingError, "", DEFAULT_MIN_PHRED, OutputOptions{})
+	if err == nil || !strings.Contains(err.Error(), "s0") {
+		t.Errorf("runPresort() error = %v, want missing key of s0", err)
+	}
+}
@@ -3,8 +3,10 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 
 	"github.com/shenwei356/bio/seqio/fastx"
@@ -58,62 +60,388 @@ func parseHeaderMetrics(metrics string) ([]HeaderMetric, error) {
 	return result, nil
 }
 
+// HeaderFormat describes the syntax of the annotations that writeRecord appends
+// to sequence headers (e.g., " maxee=0.120000" or VSEARCH-style ";ee=0.12;")
+type HeaderFormat struct {
+	Semicolon bool              // Separate annotations with ";" instead of a space
+	Trailing  bool              // Terminate the annotations with ";" (requires Semicolon)
+	Aliases   map[string]string // Keys written instead of metric names (e.g., "maxee" -> "ee")
+	Precision int               // Number of digits after the decimal point (used when Digits == 0)
+	Digits    int               // Number of significant digits (0 = fixed-point with Precision)
+	Existing  ExistingPolicy    // What to do when the header already has an annotation with the same key
+}
+
+// ExistingPolicy defines how annotations already present in a header are treated
+type ExistingPolicy int
+
+const (
+	ExistingReplace ExistingPolicy = iota // Replace the existing value in place
+	ExistingKeep                          // Keep the existing value, don't add a new one
+	ExistingAppend                        // Append a new annotation (duplicate keys)
+	ExistingError                         // Fail with an error
+)
+
+// String returns the string representation of an ExistingPolicy
+func (p ExistingPolicy) String() string {
+	switch p {
+	case ExistingReplace:
+		return "replace"
+	case ExistingKeep:
+		return "keep"
+	case ExistingAppend:
+		return "append"
+	case ExistingError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// parseExistingPolicy parses the value of the --on-existing flag
+func parseExistingPolicy(s string) (ExistingPolicy, error) {
+	switch s {
+	case "replace":
+		return ExistingReplace, nil
+	case "keep":
+		return ExistingKeep, nil
+	case "append":
+		return ExistingAppend, nil
+	case "error":
+		return ExistingError, nil
+	default:
+		return ExistingReplace, fmt.Errorf("invalid --on-existing policy: %s (must be 'replace', 'keep', 'append' or 'error')", s)
+	}
+}
+
+// HeaderAnnotation is a single key=value annotation to be added to a header
+type HeaderAnnotation struct {
+	Key   string
+	Value string
+}
+
+// Default header format (space-separated, six decimal places)
+var defaultHeaderFormat = HeaderFormat{Precision: 6}
+
+// parseHeaderFormat builds a HeaderFormat from command-line options
+//
+// Parameters:
+//   - sep: Annotation separator ("space" or "semicolon")
+//   - trailing: Whether to terminate annotations with ";"
+//   - aliases: Comma-separated list of metric=key pairs (e.g., "maxee=ee")
+//   - precision: Number of digits after the decimal point
+//   - digits: Number of significant digits (0 = use precision)
+//   - onExisting: Policy for keys already present in headers ("replace", "keep", "append" or "error")
+func parseHeaderFormat(sep string, trailing bool, aliases string, precision, digits int, onExisting string) (HeaderFormat, error) {
+	format := HeaderFormat{Trailing: trailing, Precision: precision, Digits: digits}
+
+	existing, err := parseExistingPolicy(onExisting)
+	if err != nil {
+		return format, err
+	}
+	format.Existing = existing
+
+	switch sep {
+	case "space":
+	case "semicolon":
+		format.Semicolon = true
+	default:
+		return format, fmt.Errorf("invalid header separator: %s (must be 'space' or 'semicolon')", sep)
+	}
+	if trailing && !format.Semicolon {
+		return format, fmt.Errorf("trailing semicolon requires the semicolon header separator")
+	}
+	if precision < 0 || precision > 17 {
+		return format, fmt.Errorf("header precision must be between 0 and 17")
+	}
+	if digits < 0 || digits > 17 {
+		return format, fmt.Errorf("header significant digits must be between 0 and 17")
+	}
+
+	parsed, err := parseHeaderAliases(aliases)
+	if err != nil {
+		return format, err
+	}
+	format.Aliases = parsed
+
+	return format, nil
+}
+
+// parseHeaderAliases parses a comma-separated list of metric=key pairs
+// (e.g., "maxee=ee,avgphred=qual") into a map from metric name to header key
+func parseHeaderAliases(aliases string) (map[string]string, error) {
+	if aliases == "" {
+		return nil, nil
+	}
+
+	result := make(map[string]string)
+	used := make(map[string]string)
+	for _, p := range strings.Split(aliases, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		name, key, ok := strings.Cut(p, "=")
+		name, key = strings.TrimSpace(name), strings.TrimSpace(key)
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("invalid header alias: %s (expected metric=key)", p)
+		}
+		if _, err := parseHeaderMetrics(name); err != nil {
+			return nil, fmt.Errorf("invalid header alias: unknown metric %s", name)
+		}
+		if !isHeaderKey(key) {
+			return nil, fmt.Errorf("invalid header alias key: %s (only letters, digits and '_' are allowed)", key)
+		}
+		if other, exists := used[key]; exists && other != name {
+			return nil, fmt.Errorf("header alias key %s is used for both %s and %s", key, other, name)
+		}
+
+		result[name] = key
+		used[key] = name
+	}
+
+	return result, nil
+}
+
+// Key returns the header key used for a metric
+func (f HeaderFormat) Key(name string) string {
+	if key, ok := f.Aliases[name]; ok {
+		return key
+	}
+	return name
+}
+
+// FormatValue formats a metric value with the configured precision
+func (f HeaderFormat) FormatValue(v float64) string {
+	if f.Digits > 0 {
+		return strconv.FormatFloat(v, 'g', f.Digits, 64)
+	}
+	return strconv.FormatFloat(v, 'f', f.Precision, 64)
+}
+
+// headerFieldSpan locates the n-th "key=value" annotation with the given key.
+// Annotations follow whitespace or ";" (so the sequence ID itself is never matched)
+// and extend up to the next whitespace or ";". Returns the offsets of the
+// separator preceding the annotation and of the end of its value
+func headerFieldSpan(name []byte, key string, n int) (start, valueStart, end int, found bool) {
+	for i := 1; i+len(key) < len(name); i++ {
+		if !isHeaderSeparator(name[i-1]) || name[i+len(key)] != '=' || string(name[i:i+len(key)]) != key {
+			continue
+		}
+		if n > 0 {
+			n--
+			continue
+		}
+		end = i + len(key) + 1
+		for end < len(name) && !isHeaderSeparator(name[end]) {
+			end++
+		}
+		return i - 1, i + len(key) + 1, end, true
+	}
+	return 0, 0, 0, false
+}
+
+func isHeaderSeparator(c byte) bool {
+	return c == ' ' || c == '\t' || c == ';'
+}
+
+// Annotate adds key=value annotations to a sequence header. Keys that are already
+// present in the header (in either space- or semicolon-separated form) are handled
+// according to the Existing policy; with ExistingReplace, the first occurrence is
+// updated in place and any duplicates are removed
+//
+// Returns an error (naming the record) if a key exists and the policy is ExistingError
+func (f HeaderFormat) Annotate(name []byte, annotations []HeaderAnnotation) ([]byte, error) {
+	var additions []string
+	for _, a := range annotations {
+		if f.Existing == ExistingAppend {
+			additions = append(additions, a.Key+"="+a.Value)
+			continue
+		}
+
+		_, valueStart, end, found := headerFieldSpan(name, a.Key, 0)
+		if !found {
+			additions = append(additions, a.Key+"="+a.Value)
+			continue
+		}
+
+		switch f.Existing {
+		case ExistingKeep:
+			continue
+		case ExistingError:
+			id, _, _ := strings.Cut(string(name), " ")
+			return name, fmt.Errorf("record %s already has a '%s' annotation (see --on-existing)", id, a.Key)
+		}
+
+		// Drop any further occurrences of the key, then update the first one
+		for {
+			start, _, dupEnd, dup := headerFieldSpan(name, a.Key, 1)
+			if !dup {
+				break
+			}
+			name = append(name[:start], name[dupEnd:]...)
+		}
+
+		updated := make([]byte, 0, len(name)+len(a.Value))
+		updated = append(updated, name[:valueStart]...)
+		updated = append(updated, a.Value...)
+		updated = append(updated, name[end:]...)
+		name = updated
+	}
+
+	if len(additions) == 0 {
+		return name, nil
+	}
+	if !f.Semicolon {
+		return append(name, " "+strings.Join(additions, " ")...), nil
+	}
+
+	// Avoid doubled separators after existing VSEARCH-style annotations (e.g., "seq1;size=10;")
+	if len(name) == 0 || name[len(name)-1] != ';' {
+		name = append(name, ';')
+	}
+	name = append(name, strings.Join(additions, ";")...)
+	if f.Trailing {
+		name = append(name, ';')
+	}
+	return name, nil
+}
+
+// StripAnnotations removes all key=value annotations with the given keys from
+// a header, in both space- and semicolon-separated form. Each annotation is removed
+// together with the separator that precedes it, so the remaining annotations keep
+// their original separators (also in headers mixing both forms). The whitespace that
+// ends the sequence ID is kept (the separator following the annotation is removed
+// instead), so the ID is never modified. A trailing ";" that no longer follows
+// an annotation is dropped
+func StripAnnotations(name []byte, keys []string) []byte {
+	stripped := false
+	for _, key := range keys {
+		for {
+			start, _, end, found := headerFieldSpan(name, key, 0)
+			if !found {
+				break
+			}
+			// E.g., "seq1 maxee=1;size=2" -> "seq1 size=2" (not "seq1;size=2")
+			if start == bytes.IndexAny(name, " \t") && end < len(name) {
+				start++
+				end++
+			}
+			name = append(name[:start], name[end:]...)
+			stripped = true
+		}
+	}
+
+	// E.g., "seq1;ee=0.5;" -> "seq1;" -> "seq1" (but "seq1;size=10;" is kept)
+	if stripped && len(name) > 0 && name[len(name)-1] == ';' {
+		last := name[:len(name)-1]
+		if i := bytes.LastIndexAny(last, " \t;"); i >= 0 {
+			last = last[i+1:]
+		}
+		if bytes.IndexByte(last, '=') < 0 {
+			name = name[:len(name)-1]
+		}
+	}
+	return name
+}
+
+// headerMetricValue calculates a quality metric (given by its header name) from
+// the base qualities of a record
+func headerMetricValue(record *fastx.Record, name string, minPhred int) float64 {
+	switch name {
+	case "avgphred":
+		return calculateAvgPhred(record.Seq.Qual)
+	case "maxee":
+		return calculateMaxEE(record.Seq.Qual)
+	case "meep":
+		return calculateMeep(record.Seq.Qual)
+	case "lqcount":
+		return countLowQualityBases(record.Seq.Qual, minPhred)
+	case "lqpercent":
+		return calculateLQPercent(record.Seq.Qual, minPhred)
+	}
+	return 0
+}
+
+// OutputOptions are the optional outputs of the sorting modes and the sequence
+// format of the output. The zero value writes the sequences only, in the input format
+type OutputOptions struct {
+	Report     *ReportCollector // Statistics for the HTML report (nil = disabled)
+	MetricsOut *MetricsWriter   // Sidecar table of metrics, written instead of header annotations (nil = disabled)
+	Groups     *Grouping        // Grouping of records, with a per-group limit (nil = disabled)
+	Split      *OutputSplitter  // Splitting of the output into several files (nil = write to the output file)
+	Format     OutputFormat     // Sequence format of the output (FASTA or FASTQ, line width)
+}
+
 // writeRecord writes a FASTQ/FASTA record to the output writer, applying quality
 // filters and optionally appending header annotations. Returns true if the record
-// was written (passed filters), false if it was filtered out
+// was written (passed filters), false if it was filtered out. Returns an error if
+// the header can't be annotated (see HeaderFormat.Existing)
 //
 // The function:
 //   - Filters records based on minQualFilter and maxQualFilter thresholds
 //   - Optionally appends quality metrics and sequence length to the header
-//   - Writes the record in FASTQ/FASTA format
+//     (or writes them to a sidecar table, leaving the header unchanged)
+//   - Writes the record in FASTQ/FASTA format (or as SAM/BAM, with the metrics as tags);
+//     FASTA headers keep the annotations when quality scores are dropped
 //
 // Parameters:
-//   - outfh: Output writer (must be *xopen.Writer)
+//   - outfh: Output writer (*xopen.Writer, or *SAMWriter to store the metrics as typed tags; nil = no output)
 //   - record: The FASTQ/FASTA record to write
 //   - quality: The calculated quality value for the record
 //   - headerMetrics: List of metrics to append to the header (nil/empty = no annotation)
+//   - format: Syntax of the header annotations (separator, key aliases, precision)
 //   - metric: The quality metric type used (for context, not recalculated)
 //   - minPhred: Minimum Phred threshold for lqcount/lqpercent calculations
 //   - minQualFilter: Minimum quality threshold for filtering (records below this are skipped)
 //   - maxQualFilter: Maximum quality threshold for filtering (records above this are skipped)
-func writeRecord(outfh io.Writer, record *fastx.Record, quality float64, headerMetrics []HeaderMetric, metric QualityMetric, minPhred int, minQualFilter float64, maxQualFilter float64) bool {
+//   - opts: Optional sidecar table of metrics (opts.MetricsOut, nil = annotate headers
+//     with headerMetrics) and the sequence format of the output (opts.Format)
+func writeRecord(outfh io.Writer, record *fastx.Record, quality float64, headerMetrics []HeaderMetric, format HeaderFormat, metric QualityMetric, minPhred int, minQualFilter float64, maxQualFilter float64, opts OutputOptions) (bool, error) {
 	// Skip records that don't meet quality thresholds
 	if quality < minQualFilter || quality > maxQualFilter {
-		return false
+		return false, opts.MetricsOut.WriteFiltered(record, minPhred)
 	}
 
-	if len(headerMetrics) > 0 {
-		var additions []string
+	sam, isSAM := outfh.(*SAMWriter)
+	var tags []string // Metrics as SAM tags (e.g., "XE:f:0.120000")
+
+	if opts.MetricsOut != nil {
+		// Metrics go to the sidecar table, the record is written unmodified
+		if err := opts.MetricsOut.WriteRecord(record, minPhred); err != nil {
+			return false, err
+		}
+	} else if len(headerMetrics) > 0 {
+		var annotations []HeaderAnnotation
 
 		for _, hm := range headerMetrics {
 			if hm.IsLength {
-				additions = append(additions, fmt.Sprintf("length=%d", len(record.Seq.Seq)))
+				value := strconv.Itoa(len(record.Seq.Seq))
+				annotations = append(annotations, HeaderAnnotation{format.Key(hm.Name), value})
+				tags = append(tags, format.metricTag(hm.Name)+":i:"+value)
 			} else {
-				// Calculate the requested metric
-				var metricValue float64
-				switch hm.Name {
-				case "avgphred":
-					metricValue = calculateAvgPhred(record.Seq.Qual)
-				case "maxee":
-					metricValue = calculateMaxEE(record.Seq.Qual)
-				case "meep":
-					metricValue = calculateMeep(record.Seq.Qual)
-				case "lqcount":
-					metricValue = countLowQualityBases(record.Seq.Qual, minPhred)
-				case "lqpercent":
-					metricValue = calculateLQPercent(record.Seq.Qual, minPhred)
-				}
-				additions = append(additions, fmt.Sprintf("%s=%.6f", hm.Name, metricValue))
+				value := format.FormatValue(headerMetricValue(record, hm.Name, minPhred))
+				annotations = append(annotations, HeaderAnnotation{format.Key(hm.Name), value})
+				tags = append(tags, format.metricTag(hm.Name)+":f:"+value)
 			}
 		}
 
-		if len(additions) > 0 {
-			record.Name = append(record.Name, " "+strings.Join(additions, " ")...)
+		if !isSAM {
+			name, err := format.Annotate(record.Name, annotations)
+			if err != nil {
+				return false, err
+			}
+			record.Name = name
 		}
 	}
 
-	writer := outfh.(*xopen.Writer)
-	record.FormatToWriter(writer, 0)
-	return true
+	if isSAM {
+		return true, sam.WriteRecord(record, tags)
+	}
+	if outfh == nil { // Only the metrics table is written
+		return true, nil
+	}
+	// The sorting modes only accept FASTQ input (see computedQualityFastqError)
+	return true, opts.Format.WriteRecord(outfh.(*xopen.Writer), record, true)
 }
 
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"math"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -194,7 +197,10 @@ func TestWriteRecord(t *testing.T) {
 			defer writer.Close()
 
 			// Test writeRecord
-			got := writeRecord(writer, tt.record, tt.quality, tt.headerMetrics, AvgPhred, DEFAULT_MIN_PHRED, tt.minQualFilter, tt.maxQualFilter)
+			got, err := writeRecord(writer, tt.record, tt.quality, tt.headerMetrics, defaultHeaderFormat, AvgPhred, DEFAULT_MIN_PHRED, tt.minQualFilter, tt.maxQualFilter, OutputOptions{})
+			if err != nil {
+				t.Fatalf("writeRecord() error = %v", err)
+			}
 
 			if got != tt.wantWrite {
 				t.Errorf("writeRecord() = %v, want %v", got, tt.wantWrite)
@@ -224,3 +230,224 @@ func TestWriteRecord(t *testing.T) {
 	}
 }
 
+func TestParseHeaderFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		sep        string
+		trailing   bool
+		aliases    string
+		precision  int
+		digits     int
+		onExisting string
+		want       HeaderFormat
+		wantErr    bool
+	}{
+		{
+			name:      "Default",
+			sep:       "space",
+			precision: 6,
+			want:      HeaderFormat{Precision: 6},
+		},
+		{
+			name:      "VSEARCH style",
+			sep:       "semicolon",
+			trailing:  true,
+			aliases:   "maxee=ee, length=len",
+			precision: 2,
+			want: HeaderFormat{
+				Semicolon: true,
+				Trailing:  true,
+				Aliases:   map[string]string{"maxee": "ee", "length": "len"},
+				Precision: 2,
+			},
+		},
+		{name: "Invalid separator", sep: "tab", wantErr: true},
+		{name: "Trailing without semicolon", sep: "space", trailing: true, wantErr: true},
+		{name: "Negative precision", sep: "space", precision: -1, wantErr: true},
+		{name: "Too many digits", sep: "space", digits: 18, wantErr: true},
+		{name: "Unknown alias metric", sep: "space", aliases: "foo=bar", wantErr: true},
+		{name: "Malformed alias", sep: "space", aliases: "maxee", wantErr: true},
+		{name: "Invalid alias key", sep: "space", aliases: "maxee=e e", wantErr: true},
+		{name: "Duplicate alias key", sep: "space", aliases: "maxee=q,meep=q", wantErr: true},
+		{name: "Invalid existing policy", sep: "space", onExisting: "overwrite", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			onExisting := tt.onExisting
+			if onExisting == "" {
+				onExisting = "replace"
+			}
+			got, err := parseHeaderFormat(tt.sep, tt.trailing, tt.aliases, tt.precision, tt.digits, onExisting)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHeaderFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHeaderFormat() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Test header annotation syntax and round-tripping through the headersort parser
+func TestWriteRecordHeaderFormat(t *testing.T) {
+	vsearch := HeaderFormat{Semicolon: true, Trailing: true, Aliases: map[string]string{"maxee": "ee"}, Precision: 2}
+	tests := []struct {
+		name       string
+		record     *fastx.Record
+		format     HeaderFormat
+		wantHeader string
+	}{
+		{
+			name:       "Semicolon with trailing and alias",
+			record:     createTestRecord("seq1", "ACGT", "IIII"),
+			format:     vsearch,
+			wantHeader: "seq1;ee=0.00;length=4;",
+		},
+		{
+			name:       "Existing VSEARCH annotations",
+			record:     createTestRecord("seq1;size=10;", "ACGT", "$$$$"),
+			format:     vsearch,
+			wantHeader: "seq1;size=10;ee=2.00;length=4;",
+		},
+		{
+			name:       "Semicolon without trailing",
+			record:     createTestRecord("seq1", "ACGT", "$$$$"),
+			format:     HeaderFormat{Semicolon: true, Precision: 1},
+			wantHeader: "seq1;maxee=2.0;length=4",
+		},
+		{
+			name:       "Significant digits",
+			record:     createTestRecord("seq1", "A", "S"),
+			format:     HeaderFormat{Digits: 3},
+			wantHeader: "seq1 maxee=1e-05 length=1",
+		},
+		{
+			name:       "Infinite value",
+			record:     createTestRecord("seq1", "", ""),
+			format:     defaultHeaderFormat,
+			wantHeader: "seq1 maxee=+Inf length=0",
+		},
+	}
+
+	headerMetrics := []HeaderMetric{{Name: "maxee"}, {Name: "length", IsLength: true}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outPath := filepath.Join(t.TempDir(), "out.fastq")
+			writer, err := xopen.Wopen(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := writeRecord(writer, tt.record, 0, headerMetrics, tt.format, AvgPhred, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			writer.Close()
+
+			content, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotHeader := strings.TrimLeft(strings.SplitN(string(content), "\n", 2)[0], "@>")
+			if gotHeader != tt.wantHeader {
+				t.Fatalf("Header = %q, want %q", gotHeader, tt.wantHeader)
+			}
+
+			_, gotQual, _, hasQual, _, err := parseHeaderInfo(gotHeader, tt.format.Key("maxee"))
+			if err != nil {
+				t.Fatalf("parseHeaderInfo() error = %v", err)
+			}
+			wantQual, _ := strconv.ParseFloat(tt.format.FormatValue(calculateMaxEE(tt.record.Seq.Qual)), 64)
+			if !hasQual || gotQual != wantQual {
+				t.Errorf("parseHeaderInfo() quality = %v (found %v), want %v", gotQual, hasQual, wantQual)
+			}
+		})
+	}
+}
+
+// Test key-aware annotation of headers that already contain the same keys
+func TestHeaderFormatAnnotateExisting(t *testing.T) {
+	annotations := []HeaderAnnotation{{"maxee", "0.5"}, {"length", "4"}}
+	semicolon := HeaderFormat{Semicolon: true, Trailing: true}
+	tests := []struct {
+		name    string
+		header  string
+		format  HeaderFormat
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "Replace space-separated",
+			header: "seq1 maxee=2.000000 size=3",
+			format: HeaderFormat{Existing: ExistingReplace},
+			want:   "seq1 maxee=0.5 size=3 length=4",
+		},
+		{
+			name:   "Replace semicolon-separated",
+			header: "seq1;size=3;maxee=1e-05;",
+			format: semicolon,
+			want:   "seq1;size=3;maxee=0.5;length=4;",
+		},
+		{
+			name:   "Replace removes duplicates",
+			header: "seq1 maxee=2 length=4 maxee=3",
+			format: HeaderFormat{},
+			want:   "seq1 maxee=0.5 length=4",
+		},
+		{
+			name:   "Replace ignores keys with a common prefix and the sequence ID",
+			header: "maxee=1 maxee2=1 xmaxee=1",
+			format: HeaderFormat{},
+			want:   "maxee=1 maxee2=1 xmaxee=1 maxee=0.5 length=4",
+		},
+		{
+			name:   "Keep",
+			header: "seq1;maxee=2;",
+			format: HeaderFormat{Semicolon: true, Trailing: true, Existing: ExistingKeep},
+			want:   "seq1;maxee=2;length=4;",
+		},
+		{
+			name:   "Append",
+			header: "seq1 maxee=2",
+			format: HeaderFormat{Existing: ExistingAppend},
+			want:   "seq1 maxee=2 maxee=0.5 length=4",
+		},
+		{
+			name:    "Error",
+			header:  "seq1 maxee=2",
+			format:  HeaderFormat{Existing: ExistingError},
+			wantErr: true,
+		},
+		{
+			name:   "Error without existing keys",
+			header: "seq1",
+			format: HeaderFormat{Existing: ExistingError},
+			want:   "seq1 maxee=0.5 length=4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.format.Annotate([]byte(tt.header), annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Annotate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "seq1") {
+					t.Errorf("Annotate() error = %q, want record ID", err.Error())
+				}
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("Annotate() = %q, want %q", got, tt.want)
+			}
+
+			// Annotating again with the replace policy must not change the header
+			if tt.format.Existing == ExistingReplace {
+				again, _ := tt.format.Annotate(got, annotations)
+				if string(again) != tt.want {
+					t.Errorf("Annotate() is not idempotent: %q -> %q", got, again)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+// Sidecar table of per-record metrics (--metrics-out), written instead of header annotations
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+// MetricsWriter writes one row per emitted record (sequence ID followed by
+// metric values) to a tab-separated or JSON Lines file. Rows are written
+// in output order, so the table can be joined to the records without sorting.
+// Parquet tables (see NewRecordMetricsWriter) also list the records removed
+// by quality filters
+type MetricsWriter struct {
+	fh      *xopen.Writer
+	jsonl   bool
+	parquet *ParquetWriter
+	columns []string
+	metrics []HeaderMetric // Metrics computed from base qualities (see WriteRecord)
+	values  []any
+	floats  []float64
+}
+
+// metricsTableFormat returns the format of a metrics table: a ".parquet" file
+// name selects Parquet (unless another format than the default is given)
+func metricsTableFormat(path, format string) (string, error) {
+	if !strings.HasSuffix(strings.ToLower(path), ".parquet") || format == "parquet" {
+		return format, nil
+	}
+	if format != "tsv" {
+		return format, fmt.Errorf("metrics table format %s doesn't match the file name %s", format, path)
+	}
+	return "parquet", nil
+}
+
+// NewMetricsWriter creates a metrics table with the given value columns.
+// The format is either "tsv" (with a header line) or "jsonl" (one object per line).
+// Compression is inferred from the file extension (e.g., "metrics.tsv.gz")
+func NewMetricsWriter(path, format string, columns []string) (*MetricsWriter, error) {
+	format, err := metricsTableFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+	var jsonl bool
+	switch format {
+	case "tsv":
+	case "jsonl":
+		jsonl = true
+	case "parquet":
+		return nil, fmt.Errorf("Parquet metrics tables are only available for metrics computed from base qualities (sort, nosort, stats)")
+	default:
+		return nil, fmt.Errorf("invalid metrics table format: %s (must be 'tsv', 'jsonl' or 'parquet')", format)
+	}
+
+	fh, err := xopen.Wopen(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating metrics file: %v", err)
+	}
+
+	w := &MetricsWriter{fh: fh, jsonl: jsonl, columns: columns}
+	if !jsonl {
+		fmt.Fprintf(fh, "id\t%s\n", strings.Join(columns, "\t"))
+	}
+	return w, nil
+}
+
+// NewRecordMetricsWriter creates a metrics table for metrics computed from base
+// qualities (quality metrics and sequence length), with column names taken from
+// the header keys of format (see HeaderFormat.Key). Parquet tables always have
+// id and length columns, followed by the quality metrics and a passed column
+func NewRecordMetricsWriter(path, format string, metrics []HeaderMetric, headerFormat HeaderFormat) (*MetricsWriter, error) {
+	format, err := metricsTableFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+	if format == "parquet" {
+		return newParquetMetricsWriter(path, metrics, headerFormat)
+	}
+
+	columns := make([]string, len(metrics))
+	for i, hm := range metrics {
+		columns[i] = headerFormat.Key(hm.Name)
+	}
+	w, err := NewMetricsWriter(path, format, columns)
+	if err != nil {
+		return nil, err
+	}
+	w.metrics = metrics
+	return w, nil
+}
+
+// newParquetMetricsWriter creates a Parquet table of metrics computed from base qualities
+func newParquetMetricsWriter(path string, metrics []HeaderMetric, headerFormat HeaderFormat) (*MetricsWriter, error) {
+	var qualityMetrics []HeaderMetric
+	var columns []string
+	for _, hm := range metrics {
+		if !hm.IsLength {
+			qualityMetrics = append(qualityMetrics, hm)
+			columns = append(columns, headerFormat.Key(hm.Name))
+		}
+	}
+
+	fh, err := xopen.Wopen(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating metrics file: %v", err)
+	}
+	parquet, err := NewParquetWriter(fh, "id", headerFormat.Key("length"), columns)
+	if err != nil {
+		fh.Close()
+		return nil, fmt.Errorf("error writing metrics file: %v", err)
+	}
+	return &MetricsWriter{fh: fh, parquet: parquet, columns: columns, metrics: qualityMetrics}, nil
+}
+
+// sidecarMetrics returns the metrics written to a sidecar table: the metrics
+// requested with --header, or the sorting metric and sequence length by default
+func sidecarMetrics(headerMetrics []HeaderMetric, metric QualityMetric) []HeaderMetric {
+	if len(headerMetrics) > 0 {
+		return headerMetrics
+	}
+	return []HeaderMetric{{Name: metric.String()}, {Name: "length", IsLength: true}}
+}
+
+// recordID returns the sequence ID (the first word of the header)
+func recordID(record *fastx.Record) string {
+	id, _, _ := strings.Cut(string(record.Name), " ")
+	return id
+}
+
+// WriteRecord computes the metrics of the table for a record and writes them as a row
+func (w *MetricsWriter) WriteRecord(record *fastx.Record, minPhred int) error {
+	if w.parquet != nil {
+		return w.writeParquetRow(record, minPhred, true)
+	}
+
+	w.values = w.values[:0]
+	for _, hm := range w.metrics {
+		if hm.IsLength {
+			w.values = append(w.values, len(record.Seq.Seq))
+		} else {
+			w.values = append(w.values, headerMetricValue(record, hm.Name, minPhred))
+		}
+	}
+	return w.WriteRow(recordID(record), w.values...)
+}
+
+// WriteFiltered writes a row for a record removed by quality filters; such
+// records are only listed in Parquet tables (with passed = false)
+func (w *MetricsWriter) WriteFiltered(record *fastx.Record, minPhred int) error {
+	if w == nil || w.parquet == nil {
+		return nil
+	}
+	return w.writeParquetRow(record, minPhred, false)
+}
+
+func (w *MetricsWriter) writeParquetRow(record *fastx.Record, minPhred int, passed bool) error {
+	w.floats = w.floats[:0]
+	for _, hm := range w.metrics {
+		w.floats = append(w.floats, headerMetricValue(record, hm.Name, minPhred))
+	}
+	if err := w.parquet.WriteRow(recordID(record), len(record.Seq.Seq), w.floats, passed); err != nil {
+		return fmt.Errorf("error writing metrics file: %v", err)
+	}
+	return nil
+}
+
+// WriteRow writes a row with the given values, which may be float64, int, int64,
+// string, or nil for missing values ("NA" in TSV, null in JSON).
+// Infinite and NaN values are written as "+Inf"/"NaN" in TSV and null in JSON
+func (w *MetricsWriter) WriteRow(id string, values ...any) error {
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("error writing metrics of record %s: %d values for %d columns", id, len(values), len(w.columns))
+	}
+
+	var b strings.Builder
+	if w.jsonl {
+		b.WriteString(`{"id":`)
+		b.WriteString(formatJSONValue(id))
+		for i, v := range values {
+			b.WriteByte(',')
+			b.WriteString(formatJSONValue(w.columns[i]))
+			b.WriteByte(':')
+			b.WriteString(formatJSONValue(v))
+		}
+		b.WriteString("}\n")
+	} else {
+		b.WriteString(id)
+		for _, v := range values {
+			b.WriteByte('\t')
+			b.WriteString(formatTSVValue(v))
+		}
+		b.WriteByte('\n')
+	}
+
+	if _, err := w.fh.WriteString(b.String()); err != nil {
+		return fmt.Errorf("error writing metrics file: %v", err)
+	}
+	return nil
+}
+
+// Close flushes and closes the metrics file
+func (w *MetricsWriter) Close() error {
+	if w.parquet != nil {
+		if err := w.parquet.Close(); err != nil {
+			w.fh.Close()
+			return fmt.Errorf("error writing metrics file: %v", err)
+		}
+	}
+	if err := w.fh.Close(); err != nil {
+		return fmt.Errorf("error closing metrics file: %v", err)
+	}
+	return nil
+}
+
+func formatTSVValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NA"
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func formatJSONValue(v any) string {
+	if f, ok := v.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+		return "null"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+	return string(data)
+}
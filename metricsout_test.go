@@ -0,0 +1,161 @@
+package main
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+func TestMetricsWriterFormats(t *testing.T) {
+	tmpDir := t.TempDir()
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"tsv", "id\tmaxee\tlength\tsample\nseq1\t0.5\t4\tA\nseq2\t+Inf\t0\tNA\n"},
+		{"jsonl", "{\"id\":\"seq1\",\"maxee\":0.5,\"length\":4,\"sample\":\"A\"}\n{\"id\":\"seq2\",\"maxee\":null,\"length\":0,\"sample\":null}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			path := filepath.Join(tmpDir, "metrics."+tt.format)
+			w, err := NewMetricsWriter(path, tt.format, []string{"maxee", "length", "sample"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.WriteRow("seq1", 0.5, 4, "A"); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.WriteRow("seq2", math.Inf(1), 0, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.WriteRow("seq3", 1.0); err == nil {
+				t.Error("WriteRow() accepted a row with missing columns")
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("metrics table = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewMetricsWriter(filepath.Join(tmpDir, "metrics.csv"), "csv", []string{"maxee"}); err == nil {
+		t.Error("NewMetricsWriter() accepted an invalid format")
+	}
+}
+
+func TestMetricsOutLeavesRecordsUnmodified(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("seq1 sample=A", "ACGT", "$$$$"),
+		createTestRecord("seq2", "ACGTAC", "IIIIII"),
+		createTestRecord("seq3", "AC", "5!"),
+	})
+	headerMetrics, _ := parseHeaderMetrics("maxee,length")
+
+	for _, compLevel := range []int{-1, 0, 1} {
+		outputPath := filepath.Join(tmpDir, "output.fastq")
+		metricsPath := filepath.Join(tmpDir, "metrics.tsv.gz")
+		metricsOut, err := NewRecordMetricsWriter(metricsPath, "tsv", headerMetrics, defaultHeaderFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wantIDs := []string{"seq2", "seq1", "seq3"}
+		if compLevel < 0 {
+			// nosort keeps the input order
+			wantIDs = []string{"seq1", "seq2", "seq3"}
+			err = runNoSort(testInput(inputPath), outputPath, AvgPhred, headerMetrics, defaultHeaderFormat, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{MetricsOut: metricsOut})
+		} else {
+			sortRecords(testInput(inputPath), outputPath, false, AvgPhred, compLevel, headerMetrics, defaultHeaderFormat, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{MetricsOut: metricsOut})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := metricsOut.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(output), "maxee=") || !strings.Contains(string(output), "@seq1 sample=A\n") {
+			t.Errorf("compLevel %d: headers were modified:\n%s", compLevel, output)
+		}
+
+		rows := readMetricsTable(t, metricsPath)
+		if len(rows) != 4 || rows[0] != "id\tmaxee\tlength" {
+			t.Fatalf("compLevel %d: unexpected metrics table %q", compLevel, rows)
+		}
+		for i, id := range wantIDs {
+			if !strings.HasPrefix(rows[i+1], id+"\t") {
+				t.Errorf("compLevel %d: row %d = %q, want ID %s", compLevel, i+1, rows[i+1], id)
+			}
+		}
+	}
+}
+
+func TestRunPresortMetricsOut(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("seq1;size=3;", "ACGT", "IIII"),
+		createTestRecord("seq2;size=10;", "AC", "II"),
+		createTestRecord("seq3 other=1", "ACGTAC", "IIIIII"),
+	})
+
+	metricsPath := filepath.Join(tmpDir, "metrics.jsonl")
+	key := HeaderSortKey{Name: "size", Type: KeyInt}
+	metricsOut, err := NewMetricsWriter(metricsPath, "jsonl", []string{key.Name, "length"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runPresort(testInput(inputPath), filepath.Join(tmpDir, "output.fastq"), key, false, 0, -math.MaxFloat64, math.MaxFloat64, MissingLast, "", DEFAULT_MIN_PHRED, OutputOptions{MetricsOut: metricsOut})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := metricsOut.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`{"id":"seq2;size=10;","size":10,"length":2}`,
+		`{"id":"seq1;size=3;","size":3,"length":4}`,
+		`{"id":"seq3","size":null,"length":6}`,
+	}
+	rows := readMetricsTable(t, metricsPath)
+	if strings.Join(rows, "\n") != strings.Join(want, "\n") {
+		t.Errorf("metrics table = %q, want %q", rows, want)
+	}
+}
+
+func readMetricsTable(t *testing.T, path string) []string {
+	t.Helper()
+
+	fh, err := xopen.Ropen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	data, err := io.ReadAll(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
@@ -0,0 +1,149 @@
+// External table of per-record values (--metrics-from), used by headersort instead of header annotations
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+)
+
+// MetricsTable holds the values of a single column of a per-record table
+// (e.g., produced with --metrics-out or by another tool), keyed by sequence ID
+type MetricsTable struct {
+	Path   string
+	Column string
+	values map[string]string
+}
+
+// Lookup returns the values of a record as a ParsedHeader, so that table values
+// are handled exactly like header annotations (see HeaderSortKey.Value).
+// Records absent from the table (or with an empty or "NA" value) have no fields
+func (t *MetricsTable) Lookup(id string) ParsedHeader {
+	if v, ok := t.values[id]; ok {
+		return ParsedHeader{ID: id, Fields: []HeaderField{{Key: t.Column, Value: v}}}
+	}
+	return ParsedHeader{ID: id}
+}
+
+// Len returns the number of records with a value in the table
+func (t *MetricsTable) Len() int { return len(t.values) }
+
+// ReadMetricsTable loads the ID column and the value column of a table.
+// Both tab-separated tables (with a header line) and JSON Lines (one object per
+// record) are supported; JSON Lines are recognized by a line starting with '{'.
+// Empty, "NA" and null values are treated as missing.
+//
+// Returns an error if the columns are not present (or are the same column),
+// a row is malformed, or an ID occurs more than once (also in rows without a value)
+func ReadMetricsTable(path, idColumn, column string) (*MetricsTable, error) {
+	if column == idColumn {
+		return nil, fmt.Errorf("metrics table %s: the value column can't be the ID column ('%s')", path, column)
+	}
+	fh, err := xopen.Ropen(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening metrics table: %v", err)
+	}
+	defer fh.Close()
+
+	table := &MetricsTable{Path: path, Column: column, values: make(map[string]string)}
+	seen := make(map[string]struct{}) // IDs of all rows, including those without a value
+	add := func(lineNum int, id, value string) error {
+		if _, dup := seen[id]; dup {
+			return fmt.Errorf("metrics table %s, line %d: duplicate ID %s", path, lineNum, id)
+		}
+		seen[id] = struct{}{}
+		if value != "" && value != "NA" {
+			table.values[id] = value
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var jsonl bool
+	idIdx, colIdx := -1, -1
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := bytes.TrimRight(scanner.Bytes(), "\r")
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		// The first line decides the format: a JSON object or a TSV header
+		if idIdx < 0 && !jsonl {
+			if line[0] == '{' {
+				jsonl = true
+			} else {
+				for i, name := range strings.Split(string(line), "\t") {
+					switch name {
+					case idColumn:
+						idIdx = i
+					case column:
+						colIdx = i
+					}
+				}
+				if idIdx < 0 || colIdx < 0 {
+					return nil, fmt.Errorf("metrics table %s: columns '%s' and '%s' are required", path, idColumn, column)
+				}
+				continue
+			}
+		}
+
+		if jsonl {
+			id, value, err := parseMetricsJSONLine(line, idColumn, column)
+			if err != nil {
+				return nil, fmt.Errorf("metrics table %s, line %d: %v", path, lineNum, err)
+			}
+			if err := add(lineNum, id, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		fields := strings.Split(string(line), "\t")
+		if len(fields) <= idIdx || len(fields) <= colIdx {
+			return nil, fmt.Errorf("metrics table %s, line %d: expected at least %d columns", path, lineNum, max(idIdx, colIdx)+1)
+		}
+		if err := add(lineNum, fields[idIdx], fields[colIdx]); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading metrics table: %v", err)
+	}
+
+	return table, nil
+}
+
+// parseMetricsJSONLine extracts the ID and the value of a column from a JSON object.
+// Numbers are kept as written, a null or absent value is returned as ""
+func parseMetricsJSONLine(line []byte, idColumn, column string) (id, value string, err error) {
+	var obj map[string]any
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return "", "", fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	id, ok := obj[idColumn].(string)
+	if !ok {
+		return "", "", fmt.Errorf("'%s' must be a string", idColumn)
+	}
+	switch v := obj[column].(type) {
+	case nil:
+	case string:
+		value = v
+	case json.Number:
+		value = v.String()
+	default:
+		value = fmt.Sprint(v)
+	}
+	return id, value, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func TestReadMetricsTable(t *testing.T) {
+	tmpDir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:    "TSV with missing values",
+			content: "id\tmaxee\tconf\nseq1\t0.5\t0.99\nseq2\tNA\t0.5\n\nseq3\t\t0.1\n",
+			want:    map[string]string{"seq1": "0.99", "seq2": "0.5", "seq3": "0.1"},
+		},
+		{
+			name:    "JSON Lines",
+			content: "{\"id\":\"seq1\",\"conf\":0.99}\n{\"id\":\"seq2\",\"conf\":null}\n{\"id\":\"seq3\",\"conf\":\"12345678901234567890\"}\n{\"id\":\"seq4\"}\n",
+			want:    map[string]string{"seq1": "0.99", "seq3": "12345678901234567890"},
+		},
+		{
+			name:    "Missing column",
+			content: "id\tmaxee\nseq1\t0.5\n",
+			wantErr: "columns 'id' and 'conf' are required",
+		},
+		{
+			name:    "Duplicate ID",
+			content: "id\tconf\nseq1\t0.5\nseq1\t0.7\n",
+			wantErr: "line 3: duplicate ID seq1",
+		},
+		{
+			name:    "Duplicate ID after a missing value",
+			content: "id\tconf\nseq1\tNA\nseq1\t0.7\n",
+			wantErr: "line 3: duplicate ID seq1",
+		},
+		{
+			name:    "Duplicate ID without values",
+			content: "{\"id\":\"seq1\"}\n{\"id\":\"seq1\",\"conf\":null}\n",
+			wantErr: "line 2: duplicate ID seq1",
+		},
+		{
+			name:    "Short row",
+			content: "id\tmaxee\tconf\nseq1\t0.5\n",
+			wantErr: "line 2: expected at least 3 columns",
+		},
+		{
+			name:    "Invalid JSON",
+			content: "{\"id\":\"seq1\",\"conf\":0.99}\n{\"id\":1}\n",
+			wantErr: "line 2: 'id' must be a string",
+		},
+	}
+
+	if _, err := ReadMetricsTable(filepath.Join(tmpDir, "missing.tsv"), "id", "id"); err == nil || !strings.Contains(err.Error(), "can't be the ID column") {
+		t.Errorf("ReadMetricsTable() with the ID as value column: error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, "table.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			table, err := ReadMetricsTable(path, "id", "conf")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadMetricsTable() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadMetricsTable() error = %v", err)
+			}
+			if !reflect.DeepEqual(table.values, tt.want) {
+				t.Errorf("ReadMetricsTable() = %v, want %v", table.values, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunPresortMetricsFrom(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("seq1 maxee=9", "ACGT", "IIII"), // header values are ignored
+		createTestRecord("seq2", "ACGT", "IIII"),
+		createTestRecord("seq3", "ACGT", "IIII"),
+		createTestRecord("seq4", "ACGT", "$$$$"),
+	})
+
+	// Table written by an earlier run with --metrics-out
+	tablePath := filepath.Join(tmpDir, "metrics.tsv.gz")
+	metricsOut, err := NewMetricsWriter(tablePath, "tsv", []string{"maxee", "conf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]any{{"seq1", 0.5, 0.2}, {"seq2", 0.1, 0.9}, {"seq3", 2.0, nil}} {
+		if err := metricsOut.WriteRow(row[0].(string), row[1:]...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := metricsOut.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     HeaderSortKey
+		maxQual float64
+		missing MissingPolicy
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "Quality metric column (lower is better) with filter",
+			key:     metricSortKey(MaxEE, nil),
+			maxQual: 1,
+			missing: MissingLast,
+			want:    []string{"seq2", "seq1", "seq4"},
+		},
+		{
+			name:    "Arbitrary column, records without a value skipped",
+			key:     HeaderSortKey{Name: "conf", Type: KeyFloat},
+			maxQual: math.MaxFloat64,
+			missing: MissingSkip,
+			want:    []string{"seq2", "seq1"},
+		},
+		{
+			name:    "Missing values computed from qualities",
+			key:     metricSortKey(MaxEE, nil),
+			maxQual: math.MaxFloat64,
+			missing: MissingCompute,
+			want:    []string{"seq2", "seq1", "seq3", "seq4"},
+		},
+		{
+			name:    "Missing value is an error by default",
+			key:     HeaderSortKey{Name: "conf", Type: KeyFloat},
+			maxQual: math.MaxFloat64,
+			missing: MissingError,
+			wantErr: "record seq3 has no 'conf' value in metrics table",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.key.Table, err = ReadMetricsTable(tablePath, "id", tt.key.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			outputPath := filepath.Join(tmpDir, "output.fastq")
+			err := runPresort(testInput(inputPath), outputPath, tt.key, false, 1, -math.MaxFloat64, tt.maxQual, tt.missing, "", DEFAULT_MIN_PHRED, OutputOptions{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("runPresort() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runPresort() error = %v", err)
+			}
+			if got := readFastxIDs(t, outputPath); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("runPresort() order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Sequence format of FASTA/FASTQ output (--out-format, --line-width)
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+// OutputFormat selects how records are written. By default records are written
+// in the format they were read in
+type OutputFormat struct {
+	Fasta     bool // Write FASTA, dropping quality scores
+	Fastq     bool // Write FASTQ (FASTA input is an error)
+	LineWidth int  // Line width of FASTA sequences (0 = no wrapping)
+}
+
+// parseOutputFormat validates the --out-format and --line-width flags
+// (an empty format keeps the input format)
+func parseOutputFormat(format string, lineWidth int) (OutputFormat, error) {
+	if lineWidth < 0 {
+		return OutputFormat{}, fmt.Errorf("line width must be a non-negative integer")
+	}
+	f := OutputFormat{LineWidth: lineWidth}
+	switch format {
+	case "":
+	case "fasta":
+		f.Fasta = true
+	case "fastq":
+		f.Fastq = true
+	default:
+		return f, fmt.Errorf("invalid output format: %s (must be 'fasta' or 'fastq')", format)
+	}
+	return f, nil
+}
+
+// checkSAM returns an error if an explicit sequence format is combined with
+// SAM/BAM output (selected by the file extension, see samOutputFormat)
+func (f OutputFormat) checkSAM(path string) error {
+	if _, sam := samOutputFormat(path); sam && (f.Fasta || f.Fastq) {
+		return fmt.Errorf("--out-format can't be used with SAM/BAM output (%s)", path)
+	}
+	return nil
+}
+
+// WriteRecord writes a record as FASTA or FASTQ, where fastq is the format of the
+// input (reads of length zero have no quality scores, but are still FASTQ records).
+// FASTQ records are never wrapped, as many tools expect four lines per record
+func (f OutputFormat) WriteRecord(w *xopen.Writer, record *fastx.Record, fastq bool) error {
+	if f.Fastq && !fastq {
+		// Name, not ID, as records restored from a RecordStore have no ID
+		return fmt.Errorf("FASTQ output requires FASTQ input (record %s has no quality scores)", recordID(record))
+	}
+	if fastq && !f.Fasta {
+		w.WriteByte('@')
+		w.Write(record.Name)
+		w.WriteByte('\n')
+		w.Write(record.Seq.Seq)
+		w.WriteString("\n+\n")
+		w.Write(record.Seq.Qual)
+		w.WriteByte('\n')
+		return nil
+	}
+
+	w.WriteByte('>')
+	w.Write(record.Name)
+	w.WriteByte('\n')
+	seq := record.Seq.Seq
+	for f.LineWidth > 0 && len(seq) > f.LineWidth {
+		w.Write(seq[:f.LineWidth])
+		w.WriteByte('\n')
+		seq = seq[f.LineWidth:]
+	}
+	w.Write(seq)
+	w.WriteByte('\n')
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	tests := []struct {
+		format    string
+		lineWidth int
+		want      OutputFormat
+		wantErr   bool
+	}{
+		{"", 0, OutputFormat{}, false},
+		{"fasta", 60, OutputFormat{Fasta: true, LineWidth: 60}, false},
+		{"fastq", 0, OutputFormat{Fastq: true}, false},
+		{"fa", 0, OutputFormat{}, true},
+		{"fasta", -1, OutputFormat{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseOutputFormat(tt.format, tt.lineWidth)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("parseOutputFormat(%q, %d) = %+v, %v", tt.format, tt.lineWidth, got, err)
+		}
+	}
+
+	if err := (OutputFormat{Fasta: true}).checkSAM("out.bam"); err == nil {
+		t.Error("checkSAM() accepted FASTA output to a BAM file")
+	}
+	if err := (OutputFormat{}).checkSAM("out.bam"); err != nil {
+		t.Errorf("checkSAM() error = %v", err)
+	}
+}
+
+func TestOutputFormatWriteRecord(t *testing.T) {
+	fastq := createTestRecord("r1 maxee=0.1", "ACGTACGTAC", "IIIIIIIIII")
+	fasta := &fastx.Record{ID: []byte("r2"), Name: []byte("r2"), Seq: createTestRecord("r2", "ACGT", "IIII").Seq}
+	fasta.Seq.Qual = nil
+	empty := createTestRecord("r3", "", "")
+
+	tests := []struct {
+		name    string
+		format  OutputFormat
+		record  *fastx.Record
+		fastq   bool // Input format
+		want    string
+		wantErr bool
+	}{
+		{"Input format", OutputFormat{LineWidth: 4}, fastq, true, "@r1 maxee=0.1\nACGTACGTAC\n+\nIIIIIIIIII\n", false},
+		{"FASTA", OutputFormat{Fasta: true}, fastq, true, ">r1 maxee=0.1\nACGTACGTAC\n", false},
+		{"Wrapped FASTA", OutputFormat{Fasta: true, LineWidth: 4}, fastq, true, ">r1 maxee=0.1\nACGT\nACGT\nAC\n", false},
+		{"Full line", OutputFormat{LineWidth: 4}, fasta, false, ">r2\nACGT\n", false},
+		{"Empty FASTQ read", OutputFormat{}, empty, true, "@r3\n\n+\n\n", false},
+		{"Empty read as FASTQ", OutputFormat{Fastq: true}, empty, true, "@r3\n\n+\n\n", false},
+		{"FASTQ from FASTA", OutputFormat{Fastq: true}, fasta, false, "", true},
+	}
+
+	tmpDir := t.TempDir()
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, "out"+string(rune('a'+i)))
+			w, err := xopen.Wopen(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tt.format.WriteRecord(w, tt.record, tt.fastq)
+			w.Close()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WriteRecord() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("WriteRecord() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortFastaOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	input := filepath.Join(tmpDir, "reads.fq")
+	writeFastqRecords(t, input, []*fastx.Record{
+		createTestRecord("r1", "ACGTA", "55555"), // Q20
+		createTestRecord("r2", "ACGT", "IIII"),   // Q40
+	})
+
+	// Quality annotations are computed before the qualities are dropped
+	outPath := filepath.Join(tmpDir, "sorted.fa")
+	headerMetrics := []HeaderMetric{{Name: "maxee"}, {Name: "length", IsLength: true}}
+	format := HeaderFormat{Semicolon: true, Trailing: true, Precision: 2, Aliases: map[string]string{"maxee": "ee"}}
+	sortRecords(testInput(input), outPath, false, AvgPhred, 1, headerMetrics, format, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{Format: OutputFormat{Fasta: true, LineWidth: 3}})
+
+	got, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ">r2;ee=0.00;length=4;\nACG\nT\n>r1;ee=0.05;length=5;\nACG\nTA\n"
+	if string(got) != want {
+		t.Errorf("sorted FASTA = %q, want %q", got, want)
+	}
+}
+
+func TestEmptyFastqReadOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	fastqPath := filepath.Join(tmpDir, "reads.fq")
+	fastaPath := filepath.Join(tmpDir, "reads.fa")
+	fastq := "@r1\nAC\n+\nII\n@r2\n\n+\n\n@r3\nG\n+\nI\n"
+	if err := os.WriteFile(fastqPath, []byte(fastq), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fastaPath, []byte(">r1\nAC\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reads of length zero stay FASTQ records (and can be read back)
+	for _, format := range []OutputFormat{{}, {Fastq: true}} {
+		outPath := filepath.Join(tmpDir, "out.fq")
+		if err := runStrip(testInput(fastqPath), outPath, nil, format); err != nil {
+			t.Fatalf("runStrip(%+v) error = %v", format, err)
+		}
+		got, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != fastq {
+			t.Errorf("runStrip(%+v) = %q, want %q", format, got, fastq)
+		}
+	}
+
+	err := runStrip(testInput(fastaPath), filepath.Join(tmpDir, "out.fa"), nil, OutputFormat{Fastq: true})
+	if err == nil || !strings.Contains(err.Error(), "record r1 has") {
+		t.Errorf("runStrip() error = %v, want a FASTQ error naming r1", err)
+	}
+
+	// Records restored from a RecordStore have a name, but no ID
+	store, err := newRecordStore(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := store.Append(&fastx.Record{ID: []byte("r2"), Name: []byte("r2 maxee=0.1"), Seq: &seq.Seq{Seq: []byte("AC")}}); err != nil {
+		t.Fatal(err)
+	}
+	record, err := store.Get(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := xopen.Wopen(filepath.Join(tmpDir, "out2.fq"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := (OutputFormat{Fastq: true}).WriteRecord(w, record, false); err == nil || !strings.Contains(err.Error(), "record r2 has") {
+		t.Errorf("WriteRecord() error = %v, want a FASTQ error naming r2", err)
+	}
+}
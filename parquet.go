@@ -0,0 +1,388 @@
+// Parquet output of per-record metrics (--metrics-out reads.parquet)
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Number of rows per Parquet row group; each column of a row group is written
+// as one ZSTD-compressed page, so memory usage does not grow with the input size
+const parquetRowGroupSize = 1 << 17
+
+var parquetMagic = []byte("PAR1")
+
+// Parquet physical types and other enum values (see parquet.thrift)
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0 // Repetition type
+	parquetUTF8     = 0 // Converted type
+	parquetPlain    = 0 // Encoding
+	parquetRLE      = 3 // Encoding
+	parquetZSTD     = 6 // Compression codec
+	parquetDataPage = 0 // Page type
+)
+
+// parquetColumn holds the PLAIN-encoded values of a column in the current row group
+type parquetColumn struct {
+	name     string
+	typ      int32
+	data     []byte
+	count    int     // Values in data
+	min, max float64 // Statistics of the row group (numeric columns)
+	nan      bool    // Whether a NaN value was seen (no statistics are written then)
+}
+
+// add updates the statistics of a numeric column
+func (c *parquetColumn) add(v float64) {
+	if math.IsNaN(v) {
+		c.nan = true
+		return
+	}
+	if c.count == 0 || v < c.min {
+		c.min = v
+	}
+	if c.count == 0 || v > c.max {
+		c.max = v
+	}
+}
+
+// parquetColumnChunk is the location of a column chunk in the file
+type parquetColumnChunk struct {
+	column           *parquetColumn
+	offset           int64
+	uncompressedSize int64
+	compressedSize   int64
+	min, max         []byte // Encoded statistics (nil = no statistics)
+}
+
+type parquetRowGroup struct {
+	chunks []parquetColumnChunk
+	rows   int64
+	size   int64
+}
+
+// ParquetWriter writes a table of per-record metrics as a Parquet file with a
+// string "id" column, an int64 "length" column, one double column per metric
+// and a boolean "passed" column (all required, i.e. without nulls)
+type ParquetWriter struct {
+	w         io.Writer
+	offset    int64
+	columns   []*parquetColumn // id, length, metrics..., passed
+	rows      int              // Rows in the current row group
+	rowGroups []parquetRowGroup
+	numRows   int64
+	enc       *zstd.Encoder
+	page      []byte
+}
+
+// NewParquetWriter starts a Parquet file with the given metric columns
+// (between the length and passed columns)
+func NewParquetWriter(w io.Writer, idColumn, lengthColumn string, metricColumns []string) (*ParquetWriter, error) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	p := &ParquetWriter{w: w, enc: enc}
+	p.columns = append(p.columns, &parquetColumn{name: idColumn, typ: parquetByteArray})
+	p.columns = append(p.columns, &parquetColumn{name: lengthColumn, typ: parquetInt64})
+	for _, name := range metricColumns {
+		p.columns = append(p.columns, &parquetColumn{name: name, typ: parquetDouble})
+	}
+	p.columns = append(p.columns, &parquetColumn{name: "passed", typ: parquetBoolean})
+	return p, p.write(parquetMagic)
+}
+
+func (p *ParquetWriter) write(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+// WriteRow adds a row; values are the metrics in the order of the metric columns
+func (p *ParquetWriter) WriteRow(id string, length int, values []float64, passed bool) error {
+	if len(values) != len(p.columns)-3 {
+		return fmt.Errorf("error writing metrics of record %s: %d values for %d columns", id, len(values), len(p.columns)-3)
+	}
+
+	c := p.columns[0]
+	c.data = binary.LittleEndian.AppendUint32(c.data, uint32(len(id)))
+	c.data = append(c.data, id...)
+	c.count++
+
+	c = p.columns[1]
+	c.add(float64(length))
+	c.data = binary.LittleEndian.AppendUint64(c.data, uint64(length))
+	c.count++
+
+	for i, v := range values {
+		c = p.columns[2+i]
+		c.add(v)
+		c.data = binary.LittleEndian.AppendUint64(c.data, math.Float64bits(v))
+		c.count++
+	}
+
+	// Booleans are bit-packed, least significant bit first
+	c = p.columns[len(p.columns)-1]
+	if c.count%8 == 0 {
+		c.data = append(c.data, 0)
+	}
+	if passed {
+		c.data[len(c.data)-1] |= 1 << (c.count % 8)
+	}
+	c.count++
+
+	p.rows++
+	if p.rows == parquetRowGroupSize {
+		return p.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group
+func (p *ParquetWriter) flush() error {
+	if p.rows == 0 {
+		return nil
+	}
+	group := parquetRowGroup{rows: int64(p.rows)}
+	for _, c := range p.columns {
+		p.page = p.enc.EncodeAll(c.data, p.page[:0])
+
+		h := newThriftEncoder()
+		h.I32(1, parquetDataPage)
+		h.I32(2, int32(len(c.data)))
+		h.I32(3, int32(len(p.page)))
+		h.Struct(5) // DataPageHeader
+		h.I32(1, int32(p.rows))
+		h.I32(2, parquetPlain)
+		h.I32(3, parquetRLE)
+		h.I32(4, parquetRLE)
+		h.End()
+		header := h.Bytes()
+
+		chunk := parquetColumnChunk{
+			column:           c,
+			offset:           p.offset,
+			uncompressedSize: int64(len(header) + len(c.data)),
+			compressedSize:   int64(len(header) + len(p.page)),
+		}
+		switch {
+		case c.nan:
+		case c.typ == parquetInt64:
+			chunk.min = binary.LittleEndian.AppendUint64(nil, uint64(int64(c.min)))
+			chunk.max = binary.LittleEndian.AppendUint64(nil, uint64(int64(c.max)))
+		case c.typ == parquetDouble:
+			// ±Inf are valid bounds; zero bounds are written as -0.0 (min) and +0.0 (max),
+			// as the row group may contain zeros of both signs
+			min, max := c.min, c.max
+			if min == 0 {
+				min = math.Copysign(0, -1)
+			}
+			if max == 0 {
+				max = 0 // +0.0
+			}
+			chunk.min = binary.LittleEndian.AppendUint64(nil, math.Float64bits(min))
+			chunk.max = binary.LittleEndian.AppendUint64(nil, math.Float64bits(max))
+		}
+		if err := p.write(header); err != nil {
+			return err
+		}
+		if err := p.write(p.page); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+		group.size += chunk.uncompressedSize
+
+		c.data, c.count, c.nan = c.data[:0], 0, false
+	}
+	p.rowGroups = append(p.rowGroups, group)
+	p.numRows += int64(p.rows)
+	p.rows = 0
+	return nil
+}
+
+// Close writes the remaining rows and the file metadata. The underlying
+// writer is not closed
+func (p *ParquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	defer p.enc.Close()
+
+	m := newThriftEncoder()
+	m.I32(1, 1) // Version
+	m.List(2, thriftStruct, len(p.columns)+1)
+	m.ListStruct() // Root of the schema
+	m.Binary(4, []byte("schema"))
+	m.I32(5, int32(len(p.columns)))
+	m.End()
+	for _, c := range p.columns {
+		m.ListStruct()
+		m.I32(1, c.typ)
+		m.I32(3, parquetRequired)
+		m.Binary(4, []byte(c.name))
+		if c.typ == parquetByteArray {
+			m.I32(6, parquetUTF8)
+			m.Struct(10) // LogicalType: STRING
+			m.Struct(1)
+			m.End()
+			m.End()
+		}
+		m.End()
+	}
+	m.I64(3, p.numRows)
+
+	m.List(4, thriftStruct, len(p.rowGroups))
+	for _, g := range p.rowGroups {
+		m.ListStruct()
+		m.List(1, thriftStruct, len(g.chunks))
+		for _, chunk := range g.chunks {
+			m.ListStruct()
+			m.I64(2, chunk.offset)
+			m.Struct(3) // ColumnMetaData
+			m.I32(1, chunk.column.typ)
+			m.List(2, thriftI32, 2) // Values and (empty) levels of the page
+			m.ListI32(parquetPlain)
+			m.ListI32(parquetRLE)
+			m.List(3, thriftBinary, 1)
+			m.ListBinary([]byte(chunk.column.name))
+			m.I32(4, parquetZSTD)
+			m.I64(5, g.rows)
+			m.I64(6, chunk.uncompressedSize)
+			m.I64(7, chunk.compressedSize)
+			m.I64(9, chunk.offset)
+			if chunk.min != nil {
+				m.Struct(12) // Statistics
+				m.I64(3, 0)  // Null count
+				m.Binary(5, chunk.max)
+				m.Binary(6, chunk.min)
+				m.End()
+			}
+			m.End()
+			m.End()
+		}
+		m.I64(2, g.size)
+		m.I64(3, g.rows)
+		m.End()
+	}
+	m.Binary(6, []byte("phredsort version "+VERSION))
+
+	// Column orders are required for readers to use min_value and max_value
+	m.List(7, thriftStruct, len(p.columns))
+	for range p.columns {
+		m.ListStruct()
+		m.Struct(1) // TYPE_ORDER
+		m.End()
+		m.End()
+	}
+
+	footer := m.Bytes()
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	footer = append(footer, parquetMagic...)
+	return p.write(footer)
+}
+
+// Thrift compact protocol types (used for Parquet metadata)
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftEncoder writes a struct in the Thrift compact protocol
+type thriftEncoder struct {
+	buf  []byte
+	last []int16 // ID of the last field of each open struct
+}
+
+func newThriftEncoder() *thriftEncoder {
+	return &thriftEncoder{last: []int16{0}}
+}
+
+// Bytes ends the top-level struct and returns it (all nested structs must
+// have been ended)
+func (e *thriftEncoder) Bytes() []byte {
+	if len(e.last) != 1 {
+		panic(fmt.Sprintf("thrift: %d unbalanced structs", len(e.last)-1))
+	}
+	return append(e.buf, 0)
+}
+
+func (e *thriftEncoder) varint(v int64) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(v<<1^v>>63))
+}
+
+func (e *thriftEncoder) field(id int16, typ byte) {
+	last := &e.last[len(e.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		e.buf = append(e.buf, byte(delta)<<4|typ)
+	} else {
+		e.buf = append(e.buf, typ)
+		e.varint(int64(id))
+	}
+	*last = id
+}
+
+func (e *thriftEncoder) I32(id int16, v int32) {
+	e.field(id, thriftI32)
+	e.varint(int64(v))
+}
+
+func (e *thriftEncoder) I64(id int16, v int64) {
+	e.field(id, thriftI64)
+	e.varint(v)
+}
+
+func (e *thriftEncoder) Binary(id int16, b []byte) {
+	e.field(id, thriftBinary)
+	e.ListBinary(b)
+}
+
+// Struct starts a struct field (ended with End)
+func (e *thriftEncoder) Struct(id int16) {
+	e.field(id, thriftStruct)
+	e.last = append(e.last, 0)
+}
+
+// List starts a list field of n elements, which are written with
+// ListI32, ListBinary or ListStruct
+func (e *thriftEncoder) List(id int16, elemType byte, n int) {
+	e.field(id, thriftList)
+	if n < 15 {
+		e.buf = append(e.buf, byte(n)<<4|elemType)
+	} else {
+		e.buf = append(e.buf, 0xf0|elemType)
+		e.buf = binary.AppendUvarint(e.buf, uint64(n))
+	}
+}
+
+func (e *thriftEncoder) ListI32(v int32) {
+	e.varint(int64(v))
+}
+
+func (e *thriftEncoder) ListBinary(b []byte) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// ListStruct starts a struct element of a list (ended with End)
+func (e *thriftEncoder) ListStruct() {
+	e.last = append(e.last, 0)
+}
+
+// End ends a struct
+func (e *thriftEncoder) End() {
+	e.buf = append(e.buf, 0)
+	e.last = e.last[:len(e.last)-1]
+}
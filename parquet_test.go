@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+// thriftDecoder reads structs written in the Thrift compact protocol
+// (only the types used by ParquetWriter). I32 and I64 values are returned
+// as int32 and int64, so that fields of the wrong type fail type assertions
+type thriftDecoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *thriftDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf[d.pos:])
+	d.pos += n
+	return v
+}
+
+func (d *thriftDecoder) varint() int64 {
+	v := d.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (d *thriftDecoder) value(typ byte) any {
+	switch typ {
+	case thriftI32:
+		return int32(d.varint())
+	case thriftI64:
+		return d.varint()
+	case thriftBinary:
+		n := int(d.uvarint())
+		d.pos += n
+		return d.buf[d.pos-n : d.pos]
+	case thriftList:
+		header := d.buf[d.pos]
+		d.pos++
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(d.uvarint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = d.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return d.Struct()
+	}
+	panic(fmt.Sprintf("unsupported thrift type %d", typ))
+}
+
+// Struct reads a struct as a map of field IDs to values
+func (d *thriftDecoder) Struct() map[int16]any {
+	fields := map[int16]any{}
+	var last int16
+	for {
+		header := d.buf[d.pos]
+		d.pos++
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(d.varint())
+		}
+		fields[id] = d.value(header & 0x0f)
+		last = id
+	}
+}
+
+// requireFields fails if a Thrift struct lacks any of the given (required) fields
+func requireFields(t *testing.T, what string, s map[int16]any, ids ...int16) {
+	t.Helper()
+	for _, id := range ids {
+		if _, ok := s[id]; !ok {
+			t.Fatalf("%s: missing required field %d", what, id)
+		}
+	}
+}
+
+// readParquet reads a file written by ParquetWriter, returning the file
+// metadata and the values of each column (in all row groups). The metadata is
+// checked against parquet.thrift (required fields and their types), and column
+// chunks must be laid out back to back between the magic number and the footer
+func readParquet(t *testing.T, data []byte) (map[int16]any, map[string][]any) {
+	t.Helper()
+	if !bytes.HasPrefix(data, parquetMagic) || !bytes.HasSuffix(data, parquetMagic) {
+		t.Fatal("missing Parquet magic number")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - size
+	footer := &thriftDecoder{buf: data[footerStart : len(data)-8]}
+	meta := footer.Struct()
+	if footer.pos != size {
+		t.Fatalf("file metadata of %d bytes, footer length %d", footer.pos, size)
+	}
+	requireFields(t, "FileMetaData", meta, 1, 2, 3, 4)
+
+	schema := meta[2].([]any)
+	root := schema[0].(map[int16]any)
+	requireFields(t, "root SchemaElement", root, 4, 5)
+	if n := int(root[5].(int32)); n != len(schema)-1 {
+		t.Fatalf("root num_children = %d, want %d", n, len(schema)-1)
+	}
+	for _, e := range schema[1:] {
+		requireFields(t, "SchemaElement", e.(map[int16]any), 1, 3, 4)
+	}
+	if orders := meta[7].([]any); len(orders) != len(schema)-1 {
+		t.Fatalf("%d column orders, want %d", len(orders), len(schema)-1)
+	}
+
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+
+	columns := map[string][]any{}
+	next := int64(len(parquetMagic)) // Offset of the next column chunk
+	var numRows int64
+	for _, g := range meta[4].([]any) {
+		group := g.(map[int16]any)
+		requireFields(t, "RowGroup", group, 1, 2, 3)
+		n := int(group[3].(int64))
+		numRows += int64(n)
+
+		var groupSize int64
+		for _, c := range group[1].([]any) {
+			chunk := c.(map[int16]any)
+			requireFields(t, "ColumnChunk", chunk, 2, 3)
+			cm := chunk[3].(map[int16]any)
+			requireFields(t, "ColumnMetaData", cm, 1, 2, 3, 4, 5, 6, 7, 9)
+			name := string(cm[3].([]any)[0].([]byte))
+			offset := cm[9].(int64)
+			if offset != next || chunk[2].(int64) != offset {
+				t.Fatalf("column %s: chunk at offset %d (file_offset %d), want %d", name, offset, chunk[2], next)
+			}
+			if cm[4].(int32) != parquetZSTD || cm[5].(int64) != int64(n) {
+				t.Fatalf("column %s: codec %d, %d values, want ZSTD and %d", name, cm[4], cm[5], n)
+			}
+
+			d := &thriftDecoder{buf: data[offset:]}
+			header := d.Struct()
+			requireFields(t, "PageHeader", header, 1, 2, 3, 5)
+			requireFields(t, "DataPageHeader", header[5].(map[int16]any), 1, 2, 3, 4)
+			if header[1].(int32) != parquetDataPage || header[5].(map[int16]any)[1].(int32) != int32(n) {
+				t.Fatalf("column %s: page type %d with %d values, want a data page of %d", name, header[1], header[5].(map[int16]any)[1], n)
+			}
+			end := offset + int64(d.pos) + int64(header[3].(int32))
+			if end-offset != cm[7].(int64) || int64(d.pos)+int64(header[2].(int32)) != cm[6].(int64) {
+				t.Fatalf("column %s: chunk sizes %d/%d don't match the page", name, cm[7], cm[6])
+			}
+			next = end
+			groupSize += cm[6].(int64)
+
+			page, err := dec.DecodeAll(data[offset+int64(d.pos):end], nil)
+			if err != nil {
+				t.Fatalf("column %s: %v", name, err)
+			}
+			if len(page) != int(header[2].(int32)) {
+				t.Fatalf("column %s: page size %d, header %d", name, len(page), header[2])
+			}
+
+			pos := 0
+			for i := 0; i < n; i++ {
+				switch cm[1].(int32) {
+				case parquetByteArray:
+					l := int(binary.LittleEndian.Uint32(page[pos:]))
+					columns[name] = append(columns[name], string(page[pos+4:pos+4+l]))
+					pos += 4 + l
+				case parquetInt64:
+					columns[name] = append(columns[name], int64(binary.LittleEndian.Uint64(page[pos:])))
+					pos += 8
+				case parquetDouble:
+					columns[name] = append(columns[name], math.Float64frombits(binary.LittleEndian.Uint64(page[pos:])))
+					pos += 8
+				case parquetBoolean:
+					columns[name] = append(columns[name], page[i/8]>>(i%8)&1 == 1)
+					pos = (i + 8) / 8
+				}
+			}
+			if pos != len(page) {
+				t.Fatalf("column %s: %d values use %d of %d page bytes", name, n, pos, len(page))
+			}
+		}
+		if groupSize != group[2].(int64) {
+			t.Fatalf("row group total_byte_size = %d, want %d", group[2], groupSize)
+		}
+	}
+	if next != int64(footerStart) {
+		t.Fatalf("column chunks end at %d, footer starts at %d", next, footerStart)
+	}
+	if numRows != meta[3].(int64) {
+		t.Fatalf("num_rows = %d, row groups have %d", meta[3], numRows)
+	}
+	return meta, columns
+}
+
+func TestParquetWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewParquetWriter(&buf, "id", "length", []string{"maxee", "avgphred"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two row groups, the second one with a single row
+	rows := parquetRowGroupSize + 1
+	for i := 0; i < rows; i++ {
+		if err := w.WriteRow(fmt.Sprintf("r%d", i), i%300, []float64{float64(i) / 10, 30}, i%3 != 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteRow("bad", 1, []float64{0.1}, true); err == nil {
+		t.Error("WriteRow() accepted a row with missing values")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, columns := readParquet(t, buf.Bytes())
+	if meta[3].(int64) != int64(rows) {
+		t.Errorf("num_rows = %v, want %d", meta[3], rows)
+	}
+	if n := len(meta[4].([]any)); n != 2 {
+		t.Errorf("row groups = %d, want 2", n)
+	}
+
+	var schema []string
+	for _, e := range meta[2].([]any) {
+		schema = append(schema, string(e.(map[int16]any)[4].([]byte)))
+	}
+	if want := []string{"schema", "id", "length", "maxee", "avgphred", "passed"}; !reflect.DeepEqual(schema, want) {
+		t.Errorf("schema = %q, want %q", schema, want)
+	}
+
+	for _, i := range []int{0, 1, 299, 300, rows - 1} {
+		got := []any{columns["id"][i], columns["length"][i], columns["maxee"][i], columns["avgphred"][i], columns["passed"][i]}
+		want := []any{fmt.Sprintf("r%d", i), int64(i % 300), float64(i) / 10, 30.0, i%3 != 0}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("row %d = %v, want %v", i, got, want)
+		}
+	}
+
+	// Encodings and statistics of the length column in the first row group
+	group := meta[4].([]any)[0].(map[int16]any)
+	length := group[1].([]any)[1].(map[int16]any)[3].(map[int16]any)
+	if !reflect.DeepEqual(length[2], []any{int32(parquetPlain), int32(parquetRLE)}) {
+		t.Errorf("encodings = %v, want PLAIN and RLE", length[2])
+	}
+	stats := length[12].(map[int16]any)
+	if min, max := binary.LittleEndian.Uint64(stats[6].([]byte)), binary.LittleEndian.Uint64(stats[5].([]byte)); min != 0 || max != 299 {
+		t.Errorf("length statistics = [%d, %d], want [0, 299]", min, max)
+	}
+}
+
+func TestParquetStatistics(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewParquetWriter(&buf, "id", "length", []string{"maxee", "neg", "zero", "nan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// maxee of an empty read is +Inf
+	rows := [][]float64{
+		{0.5, math.Inf(-1), 0, 1},
+		{math.Inf(1), 1, 1, math.NaN()},
+		{0.1, 2, 0, 2},
+	}
+	for i, values := range rows {
+		if err := w.WriteRow(fmt.Sprintf("r%d", i), i*2, values, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, columns := readParquet(t, buf.Bytes())
+	if !math.IsInf(columns["maxee"][1].(float64), 1) || !math.IsNaN(columns["nan"][1].(float64)) {
+		t.Errorf("values = %v, %v; want +Inf and NaN", columns["maxee"], columns["nan"])
+	}
+
+	chunks := meta[4].([]any)[0].(map[int16]any)[1].([]any)
+	stats := func(i int) (min, max float64, ok bool) {
+		s, ok := chunks[i].(map[int16]any)[3].(map[int16]any)[12].(map[int16]any)
+		if !ok {
+			return 0, 0, false
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(s[6].([]byte))),
+			math.Float64frombits(binary.LittleEndian.Uint64(s[5].([]byte))), true
+	}
+	tests := []struct {
+		column   int
+		min, max float64
+	}{
+		{2, 0.1, math.Inf(1)},
+		{3, math.Inf(-1), 2},
+		{4, math.Copysign(0, -1), 1}, // Zero minimum is written as -0.0
+	}
+	for _, tt := range tests {
+		min, max, ok := stats(tt.column)
+		if !ok || min != tt.min || max != tt.max || math.Signbit(min) != math.Signbit(tt.min) {
+			t.Errorf("column %d statistics = [%v, %v] (%v), want [%v, %v]", tt.column, min, max, ok, tt.min, tt.max)
+		}
+	}
+	if _, _, ok := stats(5); ok {
+		t.Error("statistics written for a column with NaN values")
+	}
+	if length := chunks[1].(map[int16]any)[3].(map[int16]any)[12].(map[int16]any); binary.LittleEndian.Uint64(length[6].([]byte)) != 0 || binary.LittleEndian.Uint64(length[5].([]byte)) != 4 {
+		t.Errorf("length statistics = %v", length)
+	}
+}
+
+func TestParquetMetricsOut(t *testing.T) {
+	tmpDir := t.TempDir()
+	input := filepath.Join(tmpDir, "reads.fq")
+	writeFastqRecords(t, input, []*fastx.Record{
+		createTestRecord("r1 sample=A", "ACGT", "IIII"), // Q40
+		createTestRecord("r2", "ACGTA", "#####"),        // Q2
+		createTestRecord("r3", "AC", "55"),              // Q20
+	})
+
+	path := filepath.Join(tmpDir, "reads.parquet")
+	metricsOut, err := NewRecordMetricsWriter(path, "tsv", []HeaderMetric{{Name: "maxee"}, {Name: "length", IsLength: true}, {Name: "lqcount"}}, HeaderFormat{Aliases: map[string]string{"maxee": "ee"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Metrics only (no sequence output), with r2 removed by the quality filter
+	if err := runNoSort(testInput(input), "", AvgPhred, nil, defaultHeaderFormat, DEFAULT_MIN_PHRED, 10, math.MaxFloat64, OutputOptions{MetricsOut: metricsOut}); err != nil {
+		t.Fatalf("runNoSort() error = %v", err)
+	}
+	if err := metricsOut.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, columns := readParquet(t, data)
+	want := map[string][]any{
+		"id":      {"r1", "r2", "r3"},
+		"length":  {int64(4), int64(5), int64(2)},
+		"ee":      {0.0004, 5 * math.Pow(10, -0.2), 0.02},
+		"lqcount": {0.0, 5.0, 0.0},
+		"passed":  {true, false, true},
+	}
+	for name, values := range want {
+		for i, v := range values {
+			got := columns[name][i]
+			if f, ok := v.(float64); ok {
+				if math.Abs(got.(float64)-f) > 1e-9 {
+					t.Errorf("%s[%d] = %v, want %v", name, i, got, f)
+				}
+			} else if got != v {
+				t.Errorf("%s[%d] = %v, want %v", name, i, got, v)
+			}
+		}
+	}
+}
+
+func TestMetricsTableFormat(t *testing.T) {
+	tests := []struct {
+		path, format, want string
+		wantErr            bool
+	}{
+		{"reads.tsv", "tsv", "tsv", false},
+		{"reads.parquet", "tsv", "parquet", false},
+		{"reads.PARQUET", "parquet", "parquet", false},
+		{"reads.jsonl", "parquet", "parquet", false},
+		{"reads.parquet", "jsonl", "", true},
+	}
+	for _, tt := range tests {
+		got, err := metricsTableFormat(tt.path, tt.format)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("metricsTableFormat(%s, %s) = %s, %v", tt.path, tt.format, got, err)
+		}
+	}
+
+	if _, err := NewMetricsWriter(filepath.Join(t.TempDir(), "keys.parquet"), "tsv", []string{"maxee"}); err == nil {
+		t.Error("NewMetricsWriter() accepted a Parquet table")
+	}
+}
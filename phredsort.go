@@ -237,15 +237,38 @@ func getColorizedLogo() string {
 // Variable declarations (at package level)
 var (
 	// Command-line flags for the default sorting command
-	inFile        string
+	inFiles       []string
+	tagSource     bool
+	keepTags      string
+	duplicates    string
 	outFile       string
+	seqFormat     string
+	lineWidth     int
 	metric        string
 	minPhred      int
 	minQualFilter float64
 	maxQualFilter float64
 	headerMetrics string
+	headerSep     string
+	headerTrail   bool
+	headerAliases string
+	headerPrec    int
+	headerDigits  int
+	onExisting    string
 	ascending     bool
 	compLevel     int
+	htmlReport    string
+	metricsFile   string
+	metricsFormat string
+	groupBy       string
+	within        string
+	perGroup      int
+	groupOrder    string
+	outPattern    string
+	bins          string
+	binLabels     string
+	splitRecords  int
+	splitBases    int
 	version       bool
 )
 
@@ -255,13 +278,15 @@ func main() {
 		Use:   "phredsort",
 		Short: bold("Sorts FASTQ files by quality metrics"),
 		// When no subcommand is specified, run the default sorting behavior
-		Run: runDefaultCommand,
+		Args: cobra.ArbitraryArgs,
+		Run:  runDefaultCommand,
 	}
 
 	// The default command = quality estimation and sorting
 	defaultCmd := &cobra.Command{
 		Use:   "sort",
 		Short: "Sort sequences by calculating quality metrics",
+		Args:  cobra.ArbitraryArgs,
 		Run:   runDefaultCommand,
 	}
 
@@ -272,33 +297,88 @@ func main() {
 	//  phredsort sort -i in.fq -o out.fq ...
 
 	rootFlags := rootCmd.Flags()
-	rootFlags.StringVarP(&inFile, "in", "i", "-", "Input FASTQ file (default: stdin)")
-	rootFlags.StringVarP(&outFile, "out", "o", "-", "Output FASTQ file (default: stdout)")
+	rootFlags.StringArrayVarP(&inFiles, "in", "i", []string{"-"}, "Input FASTQ file; may be repeated, or files may be given as arguments (default: stdin)")
+	rootFlags.BoolVar(&tagSource, "tag-source", false, "Add the name of the input file to headers (file=<basename>)")
+	rootFlags.StringVar(&keepTags, "keep-tags", "", "SAM/BAM input: comma-separated tags to keep in headers (e.g., 'RG,BC'; 'all' for all tags)")
+	rootFlags.StringVar(&duplicates, "duplicates", "ignore", "Check for sequence IDs occurring more than once in the input (ignore, warn, error)")
+	rootFlags.StringVarP(&outFile, "out", "o", "-", "Output FASTQ file (default: stdout); .sam or .bam for unaligned SAM/BAM")
+	rootFlags.StringVar(&seqFormat, "out-format", "", "Output sequence format (fasta, fastq; default: fastq)")
+	rootFlags.IntVar(&lineWidth, "line-width", 0, "Line width of FASTA sequences (0 = no wrapping)")
 	rootFlags.StringVarP(&metric, "metric", "s", "avgphred", "Quality metric (avgphred, maxee, meep, lqcount, lqpercent)")
 	rootFlags.IntVarP(&minPhred, "minphred", "p", DEFAULT_MIN_PHRED, "Quality threshold for 'lqcount' and 'lqpercent' metrics")
 	rootFlags.Float64VarP(&minQualFilter, "minqual", "m", -math.MaxFloat64, "Minimum quality threshold for filtering")
 	rootFlags.Float64VarP(&maxQualFilter, "maxqual", "M", math.MaxFloat64, "Maximum quality threshold for filtering")
 	rootFlags.StringVarP(&headerMetrics, "header", "H", "", "Comma-separated list of metrics to add to headers (e.g., 'avgphred,maxee,length')")
+	rootFlags.StringVar(&headerSep, "header-sep", "space", "Separator of header annotations ('space' or 'semicolon')")
+	rootFlags.BoolVar(&headerTrail, "header-trailing", false, "Terminate header annotations with ';' (requires --header-sep semicolon)")
+	rootFlags.StringVar(&headerAliases, "header-alias", "", "Comma-separated metric=key aliases for header annotations (e.g., 'maxee=ee')")
+	rootFlags.IntVar(&headerPrec, "header-precision", 6, "Number of decimal places of metric values in headers")
+	rootFlags.IntVar(&headerDigits, "header-digits", 0, "Number of significant digits of metric values in headers (overrides --header-precision)")
+	rootFlags.StringVar(&onExisting, "on-existing", "replace", "What to do with header keys that already exist (replace, keep, append, error)")
 	rootFlags.BoolVarP(&ascending, "ascending", "a", false, "Sort sequences in ascending order of quality (default: descending)")
 	rootFlags.IntVarP(&compLevel, "compress", "c", 1, "Memory compression level for stdin-based mode (0=disabled, 1-22; default: 1)")
+	rootFlags.StringVar(&htmlReport, "html", "", "Write a self-contained HTML QC report to this file")
+	rootFlags.StringVar(&metricsFile, "metrics-out", "", "Write per-record metrics to this table instead of annotating headers")
+	rootFlags.StringVar(&metricsFormat, "metrics-format", "tsv", "Format of the --metrics-out table (tsv, jsonl, parquet)")
+	rootFlags.StringVar(&groupBy, "group-by", "", "Group records by a header key (e.g., 'umi') or a regular expression matched against the header")
+	rootFlags.StringVar(&within, "within", "", "Sort records within groups (header key or regular expression, e.g., 'sample'); groups are written one after another")
+	rootFlags.IntVar(&perGroup, "per-group", 0, "Maximum number of best-quality records written per group (0 = no limit)")
+	rootFlags.StringVar(&groupOrder, "group-order", "global", "Order of groups: 'global' (by quality, --group-by only), 'natural' or 'size' (default: 'global', or 'natural' with --within)")
+	rootFlags.StringVar(&outPattern, "out-pattern", "", "Write output to several files named after this pattern (e.g., 'tier_{bin}.fq.gz', 'part_{part}.fq.gz')")
+	rootFlags.StringVar(&bins, "bins", "", "Comma-separated metric breakpoints splitting the output into quality tiers (e.g., '0.5,1,2')")
+	rootFlags.StringVar(&binLabels, "bin-labels", "", "Comma-separated names of the --bins tiers used for {bin} (e.g., 'gold,silver,bronze,rest')")
+	rootFlags.IntVar(&splitRecords, "split-records", 0, "Start a new output file every N records")
+	rootFlags.IntVar(&splitBases, "split-bases", 0, "Start a new output file every N bases")
 	rootFlags.BoolVarP(&version, "version", "v", false, "Show version information")
 
 	sortFlags := defaultCmd.Flags()
-	sortFlags.StringVarP(&inFile, "in", "i", "-", "Input FASTQ file (default: stdin)")
-	sortFlags.StringVarP(&outFile, "out", "o", "-", "Output FASTQ file (default: stdout)")
+	sortFlags.StringArrayVarP(&inFiles, "in", "i", []string{"-"}, "Input FASTQ file; may be repeated, or files may be given as arguments (default: stdin)")
+	sortFlags.BoolVar(&tagSource, "tag-source", false, "Add the name of the input file to headers (file=<basename>)")
+	sortFlags.StringVar(&keepTags, "keep-tags", "", "SAM/BAM input: comma-separated tags to keep in headers (e.g., 'RG,BC'; 'all' for all tags)")
+	sortFlags.StringVar(&duplicates, "duplicates", "ignore", "Check for sequence IDs occurring more than once in the input (ignore, warn, error)")
+	sortFlags.StringVarP(&outFile, "out", "o", "-", "Output FASTQ file (default: stdout); .sam or .bam for unaligned SAM/BAM")
+	sortFlags.StringVar(&seqFormat, "out-format", "", "Output sequence format (fasta, fastq; default: fastq)")
+	sortFlags.IntVar(&lineWidth, "line-width", 0, "Line width of FASTA sequences (0 = no wrapping)")
 	sortFlags.StringVarP(&metric, "metric", "s", "avgphred", "Quality metric (avgphred, maxee, meep, lqcount, lqpercent)")
 	sortFlags.IntVarP(&minPhred, "minphred", "p", DEFAULT_MIN_PHRED, "Quality threshold for 'lqcount' and 'lqpercent' metrics")
 	sortFlags.Float64VarP(&minQualFilter, "minqual", "m", -math.MaxFloat64, "Minimum quality threshold for filtering")
 	sortFlags.Float64VarP(&maxQualFilter, "maxqual", "M", math.MaxFloat64, "Maximum quality threshold for filtering")
 	sortFlags.StringVarP(&headerMetrics, "header", "H", "", "Comma-separated list of metrics to add to headers (e.g., 'avgphred,maxee,length')")
+	sortFlags.StringVar(&headerSep, "header-sep", "space", "Separator of header annotations ('space' or 'semicolon')")
+	sortFlags.BoolVar(&headerTrail, "header-trailing", false, "Terminate header annotations with ';' (requires --header-sep semicolon)")
+	sortFlags.StringVar(&headerAliases, "header-alias", "", "Comma-separated metric=key aliases for header annotations (e.g., 'maxee=ee')")
+	sortFlags.IntVar(&headerPrec, "header-precision", 6, "Number of decimal places of metric values in headers")
+	sortFlags.IntVar(&headerDigits, "header-digits", 0, "Number of significant digits of metric values in headers (overrides --header-precision)")
+	sortFlags.StringVar(&onExisting, "on-existing", "replace", "What to do with header keys that already exist (replace, keep, append, error)")
 	sortFlags.BoolVarP(&ascending, "ascending", "a", false, "Sort sequences in ascending order of quality (default: descending)")
 	sortFlags.IntVarP(&compLevel, "compress", "c", 1, "Memory compression level for stdin-based mode (0=disabled, 1-22; default: 1)")
+	sortFlags.StringVar(&htmlReport, "html", "", "Write a self-contained HTML QC report to this file")
+	sortFlags.StringVar(&metricsFile, "metrics-out", "", "Write per-record metrics to this table instead of annotating headers")
+	sortFlags.StringVar(&metricsFormat, "metrics-format", "tsv", "Format of the --metrics-out table (tsv, jsonl, parquet)")
+	sortFlags.StringVar(&groupBy, "group-by", "", "Group records by a header key (e.g., 'umi') or a regular expression matched against the header")
+	sortFlags.StringVar(&within, "within", "", "Sort records within groups (header key or regular expression, e.g., 'sample'); groups are written one after another")
+	sortFlags.IntVar(&perGroup, "per-group", 0, "Maximum number of best-quality records written per group (0 = no limit)")
+	sortFlags.StringVar(&groupOrder, "group-order", "global", "Order of groups: 'global' (by quality, --group-by only), 'natural' or 'size' (default: 'global', or 'natural' with --within)")
+	sortFlags.StringVar(&outPattern, "out-pattern", "", "Write output to several files named after this pattern (e.g., 'tier_{bin}.fq.gz', 'part_{part}.fq.gz')")
+	sortFlags.StringVar(&bins, "bins", "", "Comma-separated metric breakpoints splitting the output into quality tiers (e.g., '0.5,1,2')")
+	sortFlags.StringVar(&binLabels, "bin-labels", "", "Comma-separated names of the --bins tiers used for {bin} (e.g., 'gold,silver,bronze,rest')")
+	sortFlags.IntVar(&splitRecords, "split-records", 0, "Start a new output file every N records")
+	sortFlags.IntVar(&splitBases, "split-bases", 0, "Start a new output file every N bases")
 	sortFlags.BoolVarP(&version, "version", "v", false, "Show version information")
 
 	// Add commands
 	rootCmd.AddCommand(defaultCmd)          // sort using quality estimation
 	rootCmd.AddCommand(NoSortCommand())     // estimate quality without sorting
 	rootCmd.AddCommand(HeaderSortCommand()) // sort using pre-computed quality scores
+	rootCmd.AddCommand(StatsCommand())      // summarize quality metrics and per-position profile
+	rootCmd.AddCommand(HistCommand())       // draw metric distribution in the terminal
+	rootCmd.AddCommand(ThresholdsCommand()) // recommend thresholds for retention targets
+	rootCmd.AddCommand(TruncLenCommand())   // recommend truncation length for a maxEE cutoff
+	rootCmd.AddCommand(VerifyCommand())     // check header annotations against recomputed metrics
+	rootCmd.AddCommand(StripCommand())      // remove quality annotations from headers
+	rootCmd.AddCommand(DerepCommand())      // dereplicate sequences keeping the best-quality reads
+	rootCmd.AddCommand(MergeCommand())      // merge files sorted by a header key
+	rootCmd.AddCommand(CheckCommand())      // check that a file is sorted by a quality metric
 
 	// Set help function
 	rootCmd.SetHelpFunc(helpFunc)
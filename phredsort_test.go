@@ -136,15 +136,17 @@ func TestSortRecords_File(t *testing.T) {
 
 			// Run sortRecords (unified sorting function)
 			sortRecords(
-				inFile.Name(),
+				testInput(inFile.Name()),
 				outFile.Name(),
 				tt.ascending,
 				tt.metric,
 				tt.compLevel,
 				tt.headerMetrics,
+				defaultHeaderFormat,
 				tt.minPhred,
 				tt.minQual,
 				tt.maxQual,
+				OutputOptions{},
 			)
 
 			// Read and verify output
@@ -335,15 +337,17 @@ func TestSortRecords_Stdin(t *testing.T) {
 
 			// Run sortRecords with stdin ("-")
 			sortRecords(
-				"-",
+				testInput("-"),
 				tmpOutFile.Name(),
 				tt.ascending,
 				tt.metric,
 				tt.compLevel,
 				tt.headerMetrics,
+				defaultHeaderFormat,
 				tt.minPhred,
 				tt.minQual,
 				tt.maxQual,
+				OutputOptions{},
 			)
 
 			// Read and verify output
@@ -487,13 +491,15 @@ func TestRunNoSort(t *testing.T) {
 			}
 
 			err := runNoSort(
-				inPath,
+				testInput(inPath),
 				outPath,
 				tt.metric,
 				headerMetrics,
+				defaultHeaderFormat,
 				tt.minPhred,
 				tt.minQual,
 				tt.maxQual,
+				OutputOptions{},
 			)
 			if err != nil {
 				t.Fatalf("runNoSort() error: %v", err)
@@ -579,13 +585,21 @@ func TestRunDefaultCommand_Stdin(t *testing.T) {
 	defer os.Remove(tmpOutFile.Name())
 
 	// Set global flags used by runDefaultCommand
-	inFile = "-"
+	inFiles = []string{"-"}
+	tagSource = false
+	keepTags = ""
+	duplicates = "ignore"
 	outFile = tmpOutFile.Name()
+	seqFormat = ""
+	lineWidth = 0
 	metric = "avgphred"
 	minPhred = DEFAULT_MIN_PHRED
 	minQualFilter = -math.MaxFloat64
 	maxQualFilter = math.MaxFloat64
 	headerMetrics = ""
+	headerSep = "space"
+	headerPrec = 6
+	onExisting = "replace"
 	ascending = false
 	compLevel = 0
 	version = false
@@ -677,7 +691,7 @@ func TestSortRecords_ReadError(t *testing.T) {
 			}
 		}()
 
-		sortRecords("-", outPath, false, AvgPhred, 0, nil, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64)
+		sortRecords(testInput("-"), outPath, false, AvgPhred, 0, nil, defaultHeaderFormat, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{})
 	}()
 
 	// Read captured stderr
@@ -1062,7 +1076,7 @@ func TestRunPresort(t *testing.T) {
 			inPath := createInput("input.fasta", tt.content)
 			outPath := filepath.Join(tmpDir, "output.fasta")
 
-			err := runPresort(inPath, outPath, tt.metric, tt.ascending, tt.minQual, tt.maxQual)
+			err := runPresort(testInput(inPath), outPath, metricSortKey(tt.metric, nil), tt.ascending, 0, tt.minQual, tt.maxQual, MissingError, "", DEFAULT_MIN_PHRED, OutputOptions{})
 			if tt.wantErr {
 				if err == nil {
 					t.Fatalf("runPresort() expected error, got nil")
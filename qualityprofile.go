@@ -0,0 +1,157 @@
+// Per-position (per-cycle) quality profile, similar to the FastQC
+// "Per base sequence quality" module
+
+package main
+
+import (
+	"math"
+)
+
+// Highest Phred score that can be encoded with the Phred+33 offset
+const maxPhredScore = 93
+
+// QualityProfile accumulates per-position Phred score histograms.
+// Positions can be binned (e.g., for long reads), in which case all bases
+// within a bin of `binWidth` consecutive positions share the same histogram
+type QualityProfile struct {
+	counts   [][maxPhredScore + 1]uint64 // Phred score counts per bin
+	errSums  []float64                   // Sum of error probabilities per bin
+	binWidth int
+	minPhred int
+	maxLen   int // Length of the longest read (the end of the last bin)
+}
+
+// PositionStats holds the quality summary for a single position (or bin of positions).
+// Start and End are 1-based inclusive positions
+type PositionStats struct {
+	Start           int     `json:"start"`
+	End             int     `json:"end"`
+	Bases           uint64  `json:"bases"`
+	Mean            float64 `json:"mean"`
+	Q1              float64 `json:"q1"`
+	Median          float64 `json:"median"`
+	Q3              float64 `json:"q3"`
+	LowQualFraction float64 `json:"lq_fraction"`
+	MeanEE          float64 `json:"mean_ee"`
+}
+
+// NewQualityProfile creates an empty profile.
+// binWidth <= 1 disables binning (one row per position)
+func NewQualityProfile(binWidth int, minPhred int) *QualityProfile {
+	if binWidth < 1 {
+		binWidth = 1
+	}
+	return &QualityProfile{
+		binWidth: binWidth,
+		minPhred: minPhred,
+	}
+}
+
+// Add accumulates the quality scores of a single read
+func (p *QualityProfile) Add(qual []byte) {
+	if len(qual) == 0 {
+		return
+	}
+
+	p.maxLen = max(p.maxLen, len(qual))
+	nBins := (len(qual)-1)/p.binWidth + 1
+	for len(p.counts) < nBins {
+		p.counts = append(p.counts, [maxPhredScore + 1]uint64{})
+		p.errSums = append(p.errSums, 0)
+	}
+
+	for i, q := range qual {
+		bin := i / p.binWidth
+		p.counts[bin][phredScore(q)]++
+		p.errSums[bin] += errorProbs[q]
+	}
+}
+
+// Len returns the number of rows (positions or bins) in the profile
+func (p *QualityProfile) Len() int {
+	return len(p.counts)
+}
+
+// Positions summarizes the accumulated histograms, one row per position or bin
+//
+// Mean EE is the average expected number of errors contributed by a single
+// base at this position (i.e., the mean error probability)
+func (p *QualityProfile) Positions() []PositionStats {
+	result := make([]PositionStats, 0, len(p.counts))
+
+	for bin, hist := range p.counts {
+		var total uint64
+		var sum float64
+		var lowQual uint64
+		for score, n := range hist {
+			total += n
+			sum += float64(score) * float64(n)
+			if score < p.minPhred {
+				lowQual += n
+			}
+		}
+
+		ps := PositionStats{
+			Start: bin*p.binWidth + 1,
+			End:   min((bin+1)*p.binWidth, p.maxLen),
+			Bases: total,
+		}
+		if total > 0 {
+			ps.Mean = sum / float64(total)
+			ps.Q1 = histogramQuantile(hist[:], total, 0.25)
+			ps.Median = histogramQuantile(hist[:], total, 0.5)
+			ps.Q3 = histogramQuantile(hist[:], total, 0.75)
+			ps.LowQualFraction = float64(lowQual) / float64(total)
+			ps.MeanEE = p.errSums[bin] / float64(total)
+		}
+		result = append(result, ps)
+	}
+
+	return result
+}
+
+// phredScore converts an ASCII-encoded quality character to a Phred score,
+// clamping out-of-range characters to the valid [0, maxPhredScore] range
+func phredScore(q byte) int {
+	score := int(q) - PHRED_OFFSET
+	if score < 0 {
+		return 0
+	}
+	if score > maxPhredScore {
+		return maxPhredScore
+	}
+	return score
+}
+
+// histogramQuantile returns the q-th quantile (0..1) of values summarized by
+// a histogram, where hist[v] is the number of observations equal to v.
+// Uses linear interpolation between closest ranks (same as R's default, type 7)
+func histogramQuantile(hist []uint64, total uint64, q float64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	h := float64(total-1) * q
+	lo := uint64(math.Floor(h))
+	frac := h - float64(lo)
+
+	vLo := histogramValueAtRank(hist, lo)
+	if frac == 0 || lo+1 >= total {
+		return float64(vLo)
+	}
+	vHi := histogramValueAtRank(hist, lo+1)
+	return float64(vLo) + frac*float64(vHi-vLo)
+}
+
+// histogramValueAtRank returns the value of the observation at the given
+// 0-based rank in the sorted sequence of observations
+func histogramValueAtRank(hist []uint64, rank uint64) int {
+	var seen uint64
+	for v, n := range hist {
+		seen += n
+		if rank < seen {
+			return v
+		}
+	}
+	return len(hist) - 1
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	// Observations: 10, 20, 20, 30
+	hist := make([]uint64, 31)
+	hist[10] = 1
+	hist[20] = 2
+	hist[30] = 1
+
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0, 10},
+		{0.25, 17.5},
+		{0.5, 20},
+		{0.75, 22.5},
+		{1, 30},
+	}
+	for _, tt := range tests {
+		if got := histogramQuantile(hist, 4, tt.q); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("histogramQuantile(q=%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+	if got := histogramQuantile(hist, 0, 0.5); got != 0 {
+		t.Errorf("histogramQuantile() on empty histogram = %v, want 0", got)
+	}
+}
+
+func TestQualityProfilePositions(t *testing.T) {
+	qp := NewQualityProfile(1, 20)
+	qp.Add([]byte("I5")) // Phred 40, 20
+	qp.Add([]byte("+"))  // Phred 10
+	qp.Add(nil)          // ignored
+
+	positions := qp.Positions()
+	if len(positions) != 2 {
+		t.Fatalf("len(Positions()) = %d, want 2", len(positions))
+	}
+
+	first := positions[0]
+	if first.Start != 1 || first.End != 1 || first.Bases != 2 {
+		t.Errorf("position 1 = %+v, want start=1 end=1 bases=2", first)
+	}
+	if math.Abs(first.Mean-25) > 1e-9 || math.Abs(first.Median-25) > 1e-9 {
+		t.Errorf("position 1 mean/median = %v/%v, want 25/25", first.Mean, first.Median)
+	}
+	if math.Abs(first.LowQualFraction-0.5) > 1e-9 {
+		t.Errorf("position 1 lq_fraction = %v, want 0.5", first.LowQualFraction)
+	}
+	wantEE := (errorProbs['I'] + errorProbs['+']) / 2
+	if math.Abs(first.MeanEE-wantEE) > 1e-12 {
+		t.Errorf("position 1 mean_ee = %v, want %v", first.MeanEE, wantEE)
+	}
+
+	second := positions[1]
+	if second.Bases != 1 || second.Median != 20 || second.LowQualFraction != 0 {
+		t.Errorf("position 2 = %+v, want bases=1 median=20 lq_fraction=0", second)
+	}
+}
+
+func TestQualityProfileBinning(t *testing.T) {
+	qp := NewQualityProfile(3, DEFAULT_MIN_PHRED)
+	qp.Add([]byte("IIIII")) // 2 bins: positions 1-3 and 4-5 (the last bin ends at the longest read)
+
+	positions := qp.Positions()
+	if len(positions) != 2 {
+		t.Fatalf("len(Positions()) = %d, want 2", len(positions))
+	}
+	if positions[0].Start != 1 || positions[0].End != 3 || positions[0].Bases != 3 {
+		t.Errorf("bin 1 = %+v, want start=1 end=3 bases=3", positions[0])
+	}
+	if positions[1].Start != 4 || positions[1].End != 5 || positions[1].Bases != 2 {
+		t.Errorf("bin 2 = %+v, want start=4 end=5 bases=2", positions[1])
+	}
+}
+
+func TestPhredScoreClamping(t *testing.T) {
+	if got := phredScore(' '); got != 0 {
+		t.Errorf("phredScore(' ') = %d, want 0", got)
+	}
+	if got := phredScore(255); got != maxPhredScore {
+		t.Errorf("phredScore(255) = %d, want %d", got, maxPhredScore)
+	}
+}
@@ -0,0 +1,189 @@
+// In-memory storage of sequence records (optionally ZSTD-compressed) for sorting
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+// RecordStore keeps records until they are written in sorted order.
+// Records are referenced by the index returned by Append
+type RecordStore interface {
+	Append(record *fastx.Record) (int, error)
+	// Get returns a stored record. The record may be reused by the next call to Get
+	Get(idx int) (*fastx.Record, error)
+	Len() int
+	Close()
+}
+
+// newRecordStore returns an uncompressed store for compLevel 0,
+// and a ZSTD-compressed store with the given level otherwise
+func newRecordStore(compLevel int) (RecordStore, error) {
+	if compLevel == 0 {
+		return &plainRecordStore{records: make([]*fastx.Record, 0, 10000)}, nil
+	}
+	return newCompressedRecordStore(compLevel)
+}
+
+// plainRecordStore keeps records as they are (records must not be reused by the caller)
+type plainRecordStore struct {
+	records []*fastx.Record
+}
+
+func (s *plainRecordStore) Append(record *fastx.Record) (int, error) {
+	s.records = append(s.records, record)
+	return len(s.records) - 1, nil
+}
+
+func (s *plainRecordStore) Get(idx int) (*fastx.Record, error) { return s.records[idx], nil }
+func (s *plainRecordStore) Len() int                           { return len(s.records) }
+func (s *plainRecordStore) Close()                             {}
+
+// compressedRecordStore keeps ZSTD-compressed records in a ChunkedStorage.
+// Each record is serialized with an explicit layout (see encodeRecordLayout),
+// so that records without qualities (FASTA) and records with qualities (FASTQ)
+// are restored exactly
+type compressedRecordStore struct {
+	storage *ChunkedStorage
+	codec   *recordCodec
+}
+
+func newCompressedRecordStore(compLevel int) (*compressedRecordStore, error) {
+	codec, err := newRecordCodec(compLevel)
+	if err != nil {
+		return nil, err
+	}
+	return &compressedRecordStore{storage: NewChunkedStorage(10000, 0), codec: codec}, nil
+}
+
+func (s *compressedRecordStore) Append(record *fastx.Record) (int, error) {
+	return s.storage.Append(s.codec.Encode(record)), nil
+}
+
+func (s *compressedRecordStore) Get(idx int) (*fastx.Record, error) {
+	return s.codec.Decode(s.storage.Get(idx))
+}
+
+func (s *compressedRecordStore) Len() int { return s.storage.Len() }
+
+func (s *compressedRecordStore) Close() { s.codec.Close() }
+
+// recordCodec serializes single records (see encodeRecordLayout), ZSTD-compressed
+// when compLevel > 0. It is used directly where stored records are replaced
+// (e.g., representatives in derep), since a RecordStore only grows
+type recordCodec struct {
+	encoder   *zstd.Encoder // nil = no compression
+	decoder   *zstd.Decoder
+	layoutBuf *[]byte
+	encBuf    *[]byte
+	decBuf    *[]byte
+	record    fastx.Record
+}
+
+func newRecordCodec(compLevel int) (*recordCodec, error) {
+	c := &recordCodec{
+		layoutBuf: getSmallBuffer(),
+		encBuf:    getSmallBuffer(),
+		decBuf:    getDecompBuffer(),
+		record:    fastx.Record{Seq: &seq.Seq{}},
+	}
+	if compLevel == 0 {
+		return c, nil
+	}
+
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(compLevel)))
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("error creating ZSTD encoder: %v", err)
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		encoder.Close()
+		c.Close()
+		return nil, fmt.Errorf("error creating ZSTD decoder: %v", err)
+	}
+	c.encoder, c.decoder = encoder, decoder
+	return c, nil
+}
+
+// Encode serializes a record. The result is reused by the next call to Encode
+func (c *recordCodec) Encode(record *fastx.Record) []byte {
+	*c.layoutBuf = encodeRecordLayout((*c.layoutBuf)[:0], record)
+	if c.encoder == nil {
+		return *c.layoutBuf
+	}
+
+	encCap := zstdEncodeCapacity(len(*c.layoutBuf))
+	if cap(*c.encBuf) < encCap {
+		*c.encBuf = make([]byte, 0, encCap)
+	}
+	*c.encBuf = c.encoder.EncodeAll(*c.layoutBuf, (*c.encBuf)[:0])
+	return *c.encBuf
+}
+
+// Decode restores a record serialized by Encode. The record may be reused by the
+// next call to Decode, and (without compression) points into data
+func (c *recordCodec) Decode(data []byte) (*fastx.Record, error) {
+	if c.decoder != nil {
+		decompressed, err := c.decoder.DecodeAll(data, (*c.decBuf)[:0])
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing record: %v", err)
+		}
+		*c.decBuf = decompressed
+		data = decompressed
+	}
+
+	if err := decodeRecordLayout(data, &c.record); err != nil {
+		return nil, err
+	}
+	return &c.record, nil
+}
+
+func (c *recordCodec) Close() {
+	if c.encoder != nil {
+		c.encoder.Close()
+		c.decoder.Close()
+	}
+	putSmallBuffer(c.layoutBuf)
+	putSmallBuffer(c.encBuf)
+	putDecompBuffer(c.decBuf)
+}
+
+// encodeRecordLayout appends the serialized record to dst. The layout is
+// uvarint(len(name)) name uvarint(len(seq)) seq uvarint(len(qual)) qual,
+// where qual is empty for FASTA records
+func encodeRecordLayout(dst []byte, record *fastx.Record) []byte {
+	for _, field := range [][]byte{record.Name, record.Seq.Seq, record.Seq.Qual} {
+		dst = binary.AppendUvarint(dst, uint64(len(field)))
+		dst = append(dst, field...)
+	}
+	return dst
+}
+
+// decodeRecordLayout restores a record serialized by encodeRecordLayout.
+// The record fields point into data (no copies are made)
+func decodeRecordLayout(data []byte, record *fastx.Record) error {
+	var fields [3][]byte
+	for i := range fields {
+		n, size := binary.Uvarint(data)
+		if size <= 0 || n > uint64(len(data)-size) {
+			return fmt.Errorf("error decoding stored record: corrupted data")
+		}
+		data = data[size:]
+		fields[i] = data[:n:n]
+		data = data[n:]
+	}
+	if len(data) != 0 {
+		return fmt.Errorf("error decoding stored record: trailing data")
+	}
+
+	record.Name = fields[0]
+	record.Seq.Seq = fields[1]
+	record.Seq.Qual = fields[2]
+	return nil
+}
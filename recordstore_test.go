@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func TestRecordLayoutRoundTrip(t *testing.T) {
+	records := []*fastx.Record{
+		{Name: []byte("fastq1 maxee=0.5"), Seq: &seq.Seq{Seq: []byte("ACGT"), Qual: []byte("IIII")}},
+		{Name: []byte("fasta1;size=3;"), Seq: &seq.Seq{Seq: []byte("ACGTACGT")}},
+		{Name: []byte("empty"), Seq: &seq.Seq{}},
+		{Name: []byte(strings.Repeat("n", 300)), Seq: &seq.Seq{Seq: []byte(strings.Repeat("A", 200))}},
+	}
+
+	for _, want := range records {
+		data := encodeRecordLayout(nil, want)
+		got := fastx.Record{Seq: &seq.Seq{}}
+		if err := decodeRecordLayout(data, &got); err != nil {
+			t.Fatalf("decodeRecordLayout() error = %v", err)
+		}
+		if !bytes.Equal(got.Name, want.Name) || !bytes.Equal(got.Seq.Seq, want.Seq.Seq) || !bytes.Equal(got.Seq.Qual, want.Seq.Qual) {
+			t.Errorf("round trip of %q = %q/%q/%q", want.Name, got.Name, got.Seq.Seq, got.Seq.Qual)
+		}
+
+		// Truncated or extended data must be rejected
+		if err := decodeRecordLayout(data[:len(data)-1], &got); err == nil {
+			t.Errorf("decodeRecordLayout() accepted truncated data for %q", want.Name)
+		}
+		if err := decodeRecordLayout(append(data, 0), &got); err == nil {
+			t.Errorf("decodeRecordLayout() accepted trailing data for %q", want.Name)
+		}
+	}
+}
+
+func TestCompressedRecordStore(t *testing.T) {
+	store, err := newRecordStore(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	for i := 0; i < 1000; i++ {
+		record := &fastx.Record{Name: []byte(fmt.Sprintf("seq%d", i)), Seq: &seq.Seq{Seq: []byte(strings.Repeat("ACGT", i%7))}}
+		if i%2 == 0 {
+			record.Seq.Qual = bytes.Repeat([]byte("I"), len(record.Seq.Seq))
+		}
+		idx, err := store.Append(record)
+		if err != nil || idx != i {
+			t.Fatalf("Append() = %d, %v; want %d", idx, err, i)
+		}
+	}
+	if store.Len() != 1000 {
+		t.Fatalf("Len() = %d, want 1000", store.Len())
+	}
+
+	for _, i := range []int{999, 0, 500, 13} {
+		got, err := store.Get(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantQual := 0
+		if i%2 == 0 {
+			wantQual = 4 * (i % 7)
+		}
+		if string(got.Name) != fmt.Sprintf("seq%d", i) || len(got.Seq.Seq) != 4*(i%7) || len(got.Seq.Qual) != wantQual {
+			t.Errorf("Get(%d) = %q, seq %d, qual %d", i, got.Name, len(got.Seq.Seq), len(got.Seq.Qual))
+		}
+	}
+}
+
+func TestRecordCodec(t *testing.T) {
+	want := &fastx.Record{Name: []byte("r1 maxee=0.5"), Seq: &seq.Seq{Seq: []byte("ACGTACGT"), Qual: []byte("IIII5555")}}
+	for _, compLevel := range []int{0, 3} {
+		codec, err := newRecordCodec(compLevel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Encoded data is owned by the caller once copied
+		data := bytes.Clone(codec.Encode(want))
+		codec.Encode(&fastx.Record{Name: []byte("other"), Seq: &seq.Seq{Seq: []byte("TT")}})
+
+		got, err := codec.Decode(data)
+		if err != nil {
+			t.Fatalf("level %d: Decode() error = %v", compLevel, err)
+		}
+		if !bytes.Equal(got.Name, want.Name) || !bytes.Equal(got.Seq.Seq, want.Seq.Seq) || !bytes.Equal(got.Seq.Qual, want.Seq.Qual) {
+			t.Errorf("level %d: round trip = %q/%q/%q", compLevel, got.Name, got.Seq.Seq, got.Seq.Qual)
+		}
+		codec.Close()
+	}
+}
+
+func TestRunPresortCompressedMatchesUncompressed(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	records := []*fastx.Record{
+		createTestRecord("seq10 maxee=1.5", "GATTACA", "5555555"),
+		createTestRecord("seq2;size=3;maxee=0.25;", "TT", "!!"),
+		createTestRecord("seq3 maxee=1.5", "GGG", "@@@"),
+		createTestRecord("seq1 maxee=1e-05", "ACGTAC", "IIIIII"),
+	}
+	writeFastqRecords(t, inputPath, records)
+
+	var outputs [][]byte
+	for _, compLevel := range []int{0, 1, 19} {
+		outputPath := filepath.Join(tmpDir, fmt.Sprintf("out%d.fastq", compLevel))
+		err := runPresort(testInput(inputPath), outputPath, metricSortKey(MaxEE, nil), false, compLevel, -math.MaxFloat64, math.MaxFloat64, MissingError, "", DEFAULT_MIN_PHRED, OutputOptions{})
+		if err != nil {
+			t.Fatalf("runPresort(testInput(compLevel=%d)) error = %v", compLevel, err)
+		}
+		out, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, out)
+	}
+
+	for i := 1; i < len(outputs); i++ {
+		if !bytes.Equal(outputs[0], outputs[i]) {
+			t.Fatalf("compressed output differs from uncompressed\nplain:\n%s\ncompressed:\n%s", outputs[0], outputs[i])
+		}
+	}
+	if !strings.HasPrefix(string(outputs[0]), "@seq1 maxee=1e-05\nACGTAC\n+\nIIIIII\n@seq2;size=3;maxee=0.25;") {
+		t.Fatalf("unexpected output:\n%s", outputs[0])
+	}
+}
@@ -0,0 +1,339 @@
+// Self-contained HTML QC report (inline SVG charts, no external assets)
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Chart geometry (in SVG user units)
+const (
+	chartWidth        = 720
+	chartHeight       = 300
+	chartMarginLeft   = 60
+	chartMarginRight  = 20
+	chartMarginTop    = 20
+	chartMarginBottom = 45
+	reportHistBins    = 40
+	reportCurvePoints = 300
+)
+
+// ReportParam is a single key/value pair shown in the "Run parameters" table
+type ReportParam struct {
+	Name  string
+	Value string
+}
+
+// ReportCollector gathers the per-read statistics needed for the HTML report
+// while records are processed by `sort` or `nosort`, so that no second pass
+// over the input is needed. For each record, the quality metric value and read
+// length are kept (16 bytes per record), and Phred scores are accumulated
+// into a per-position quality profile
+type ReportCollector struct {
+	metric        QualityMetric
+	minQualFilter float64
+	maxQualFilter float64
+	observations  []MetricObservation
+	profile       *QualityProfile
+}
+
+// NewReportCollector creates an empty collector for the given metric and filters
+func NewReportCollector(metric QualityMetric, minPhred int, minQualFilter, maxQualFilter float64) *ReportCollector {
+	return &ReportCollector{
+		metric:        metric,
+		minQualFilter: minQualFilter,
+		maxQualFilter: maxQualFilter,
+		observations:  make([]MetricObservation, 0, 10000),
+		profile:       NewQualityProfile(1, minPhred),
+	}
+}
+
+// Add records the statistics of a single input record (before filtering)
+func (c *ReportCollector) Add(record *fastx.Record, quality float64) {
+	c.observations = append(c.observations, MetricObservation{
+		Value:  quality,
+		Length: len(record.Seq.Seq),
+	})
+	c.profile.Add(record.Seq.Qual)
+}
+
+// reportPage holds the rendered report content passed to the HTML template
+type reportPage struct {
+	Version      string
+	Metric       string
+	Params       []ReportParam
+	Retention    Retention
+	ReadPercent  string
+	BasePercent  string
+	MetricHist   template.HTML
+	LengthHist   template.HTML
+	RetentionSVG template.HTML
+	ProfileSVG   template.HTML
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>phredsort QC report</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 780px; color: #222; }
+h1 { font-size: 1.5em; border-bottom: 2px solid #2a2; }
+h2 { font-size: 1.15em; margin-top: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: 2px 12px 2px 0; text-align: left; }
+th { font-weight: normal; color: #555; }
+svg { background: #fafafa; border: 1px solid #ddd; }
+svg text { font-size: 11px; fill: #333; }
+.legend { font-size: 0.85em; color: #555; }
+</style>
+</head>
+<body>
+<h1>phredsort QC report</h1>
+
+<h2>Run parameters</h2>
+<table>
+{{range .Params}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Reads</th><td>{{.Retention.Reads}} / {{.Retention.TotalReads}} retained ({{.ReadPercent}}%)</td></tr>
+<tr><th>Bases</th><td>{{.Retention.Bases}} / {{.Retention.TotalBases}} retained ({{.BasePercent}}%)</td></tr>
+</table>
+
+<h2>Distribution of {{.Metric}}</h2>
+{{.MetricHist}}
+<p class="legend">Red dashed lines mark the --minqual/--maxqual thresholds.</p>
+
+<h2>Read length distribution</h2>
+{{.LengthHist}}
+
+<h2>Retained reads and bases vs. {{.Metric}} threshold</h2>
+{{.RetentionSVG}}
+<p class="legend">Blue: fraction of reads retained; orange: fraction of bases retained.</p>
+
+<h2>Per-position quality</h2>
+{{.ProfileSVG}}
+<p class="legend">Shaded band: interquartile range; dark line: median; green line: mean Phred score.</p>
+
+<p class="legend">Generated by phredsort v{{.Version}}</p>
+</body>
+</html>
+`))
+
+// WriteHTML renders the collected statistics into a single self-contained HTML file
+func (c *ReportCollector) WriteHTML(path string, params []ReportParam) error {
+	retention := computeRetention(c.observations, c.minQualFilter, c.maxQualFilter)
+
+	lengths := make([]MetricObservation, len(c.observations))
+	for i, obs := range c.observations {
+		lengths[i] = MetricObservation{Value: float64(obs.Length), Length: obs.Length}
+	}
+
+	page := reportPage{
+		Version:      VERSION,
+		Metric:       c.metric.String(),
+		Params:       params,
+		Retention:    retention,
+		ReadPercent:  fmt.Sprintf("%.2f", 100*retention.ReadFraction()),
+		BasePercent:  fmt.Sprintf("%.2f", 100*retention.BaseFraction()),
+		MetricHist:   template.HTML(svgHistogram(NewMetricHistogram(c.observations, reportHistBins, false), c.metric.String(), c.minQualFilter, c.maxQualFilter)),
+		LengthHist:   template.HTML(svgHistogram(NewMetricHistogram(lengths, reportHistBins, false), "length", -math.MaxFloat64, math.MaxFloat64)),
+		RetentionSVG: template.HTML(svgRetentionCurve(retentionCurve(c.observations, c.metric, reportCurvePoints), c.metric.String())),
+		ProfileSVG:   template.HTML(svgQualityProfile(c.profile.Positions())),
+	}
+
+	fh, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating HTML report: %v", err)
+	}
+	if err := reportTemplate.Execute(fh, page); err != nil {
+		fh.Close()
+		return fmt.Errorf("error writing HTML report: %v", err)
+	}
+	return fh.Close()
+}
+
+// svgPlot maps data coordinates onto the plotting area of a chart
+type svgPlot struct {
+	xMin, xMax float64
+	yMin, yMax float64
+	sb         strings.Builder
+}
+
+func newSVGPlot(xMin, xMax, yMin, yMax float64) *svgPlot {
+	if xMax <= xMin {
+		xMax = xMin + 1
+	}
+	if yMax <= yMin {
+		yMax = yMin + 1
+	}
+	p := &svgPlot{xMin: xMin, xMax: xMax, yMin: yMin, yMax: yMax}
+	fmt.Fprintf(&p.sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, chartWidth, chartHeight, chartWidth, chartHeight)
+	return p
+}
+
+func (p *svgPlot) x(v float64) float64 {
+	w := float64(chartWidth - chartMarginLeft - chartMarginRight)
+	return chartMarginLeft + (v-p.xMin)/(p.xMax-p.xMin)*w
+}
+
+func (p *svgPlot) y(v float64) float64 {
+	h := float64(chartHeight - chartMarginTop - chartMarginBottom)
+	return float64(chartHeight-chartMarginBottom) - (v-p.yMin)/(p.yMax-p.yMin)*h
+}
+
+// axes draws x and y axes with five evenly spaced ticks and axis labels
+func (p *svgPlot) axes(xLabel, yLabel string) {
+	x0, x1 := p.x(p.xMin), p.x(p.xMax)
+	y0, y1 := p.y(p.yMin), p.y(p.yMax)
+	fmt.Fprintf(&p.sb, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#333"/>`, x0, y0, x1, y0)
+	fmt.Fprintf(&p.sb, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#333"/>`, x0, y0, x0, y1)
+	for i := 0; i <= 4; i++ {
+		xv := p.xMin + float64(i)*(p.xMax-p.xMin)/4
+		yv := p.yMin + float64(i)*(p.yMax-p.yMin)/4
+		fmt.Fprintf(&p.sb, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`, p.x(xv), y0+15, formatTick(xv))
+		fmt.Fprintf(&p.sb, `<text x="%.1f" y="%.1f" text-anchor="end">%s</text>`, x0-5, p.y(yv)+4, formatTick(yv))
+	}
+	fmt.Fprintf(&p.sb, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, (x0+x1)/2, chartHeight-8, html.EscapeString(xLabel))
+	fmt.Fprintf(&p.sb, `<text x="14" y="%.1f" text-anchor="middle" transform="rotate(-90 14 %.1f)">%s</text>`, (y0+y1)/2, (y0+y1)/2, html.EscapeString(yLabel))
+}
+
+// polyline draws a line through the given data points
+func (p *svgPlot) polyline(xs, ys []float64, stroke string) {
+	if len(xs) == 0 {
+		return
+	}
+	var pts strings.Builder
+	for i := range xs {
+		fmt.Fprintf(&pts, "%.1f,%.1f ", p.x(xs[i]), p.y(ys[i]))
+	}
+	fmt.Fprintf(&p.sb, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"/>`, strings.TrimSpace(pts.String()), stroke)
+}
+
+// vline draws a dashed vertical marker line if v lies within the x range
+func (p *svgPlot) vline(v float64, label string) {
+	if v < p.xMin || v > p.xMax {
+		return
+	}
+	fmt.Fprintf(&p.sb, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#d22" stroke-dasharray="4,3"/>`, p.x(v), p.y(p.yMin), p.x(v), p.y(p.yMax))
+	fmt.Fprintf(&p.sb, `<text x="%.1f" y="%.1f" fill="#d22">%s</text>`, p.x(v)+3, p.y(p.yMax)+10, html.EscapeString(label))
+}
+
+func (p *svgPlot) String() string {
+	return p.sb.String() + "</svg>"
+}
+
+// formatTick formats an axis tick label compactly
+func formatTick(v float64) string {
+	return strings.TrimSuffix(fmt.Sprintf("%.3g", v), ".0")
+}
+
+// svgHistogram renders a histogram as an SVG bar chart with optional threshold markers
+func svgHistogram(h *MetricHistogram, xLabel string, minQual, maxQual float64) string {
+	p := newSVGPlot(h.Edges[0], h.Edges[len(h.Edges)-1], 0, float64(h.MaxCount()))
+	for i, c := range h.Counts {
+		if c == 0 {
+			continue
+		}
+		x0, x1 := p.x(h.Edges[i]), p.x(h.Edges[i+1])
+		y := p.y(float64(c))
+		fmt.Fprintf(&p.sb, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#4a4"><title>%s: %d</title></rect>`,
+			x0, y, math.Max(x1-x0-1, 0.5), p.y(0)-y, fmt.Sprintf("[%.4g, %.4g]", h.Edges[i], h.Edges[i+1]), c)
+	}
+	p.axes(xLabel, "reads")
+	if minQual > -math.MaxFloat64 {
+		p.vline(minQual, fmt.Sprintf("minqual=%g", minQual))
+	}
+	if maxQual < math.MaxFloat64 {
+		p.vline(maxQual, fmt.Sprintf("maxqual=%g", maxQual))
+	}
+	if h.Undefined > 0 {
+		fmt.Fprintf(&p.sb, `<text x="%d" y="%d" text-anchor="end">undefined (inf): %d</text>`, chartWidth-chartMarginRight, chartMarginTop, h.Undefined)
+	}
+	return p.String()
+}
+
+// svgRetentionCurve renders the fractions of reads and bases retained as a
+// function of the quality threshold
+func svgRetentionCurve(points []RetentionPoint, xLabel string) string {
+	xMin, xMax := 0.0, 1.0
+	if len(points) > 0 {
+		xMin = math.Min(points[0].Threshold, points[len(points)-1].Threshold)
+		xMax = math.Max(points[0].Threshold, points[len(points)-1].Threshold)
+	}
+	p := newSVGPlot(xMin, xMax, 0, 1)
+
+	xs := make([]float64, len(points))
+	reads := make([]float64, len(points))
+	bases := make([]float64, len(points))
+	for i, pt := range points {
+		xs[i], reads[i], bases[i] = pt.Threshold, pt.ReadFraction, pt.BaseFraction
+	}
+	p.polyline(xs, reads, "#27c")
+	p.polyline(xs, bases, "#e80")
+	p.axes(xLabel+" threshold", "fraction retained")
+	return p.String()
+}
+
+// svgQualityProfile renders the per-position Phred score distribution
+// (interquartile band, median and mean)
+func svgQualityProfile(positions []PositionStats) string {
+	yMax := 41.0
+	for _, ps := range positions {
+		yMax = math.Max(yMax, ps.Q3)
+	}
+	p := newSVGPlot(1, float64(len(positions)), 0, yMax)
+
+	if len(positions) > 0 {
+		var band strings.Builder
+		for _, ps := range positions {
+			fmt.Fprintf(&band, "%.1f,%.1f ", p.x(float64(ps.Start)), p.y(ps.Q3))
+		}
+		for i := len(positions) - 1; i >= 0; i-- {
+			fmt.Fprintf(&band, "%.1f,%.1f ", p.x(float64(positions[i].Start)), p.y(positions[i].Q1))
+		}
+		fmt.Fprintf(&p.sb, `<polygon points="%s" fill="#fd6" fill-opacity="0.6" stroke="none"/>`, strings.TrimSpace(band.String()))
+
+		xs := make([]float64, len(positions))
+		medians := make([]float64, len(positions))
+		means := make([]float64, len(positions))
+		for i, ps := range positions {
+			xs[i], medians[i], means[i] = float64(ps.Start), ps.Median, ps.Mean
+		}
+		p.polyline(xs, medians, "#333")
+		p.polyline(xs, means, "#2a2")
+	}
+	p.axes("position", "Phred score")
+	return p.String()
+}
+
+// collectReportParams lists the command name and all flag values of a command
+// (used for the "Run parameters" section of the HTML report)
+func collectReportParams(cmd *cobra.Command) []ReportParam {
+	params := []ReportParam{{Name: "command", Value: cmd.CommandPath()}}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		switch f.Name {
+		case "help", "version", "html":
+			return
+		case "minqual", "maxqual":
+			// Defaults are +-MaxFloat64, which are not informative
+			if !f.Changed {
+				params = append(params, ReportParam{Name: f.Name, Value: "not set"})
+				return
+			}
+		}
+		params = append(params, ReportParam{Name: f.Name, Value: f.Value.String()})
+	})
+	return params
+}
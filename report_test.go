@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestRetentionCurve(t *testing.T) {
+	observations := []MetricObservation{
+		{Value: 2, Length: 10},
+		{Value: 0.5, Length: 30},
+		{Value: 0.5, Length: 20},
+		{Value: math.Inf(1), Length: 0},
+		{Value: 1, Length: 40},
+	}
+
+	curve := retentionCurve(observations, MaxEE, 0)
+	want := []RetentionPoint{
+		{Threshold: 0.5, ReadFraction: 0.4, BaseFraction: 0.5},
+		{Threshold: 1, ReadFraction: 0.6, BaseFraction: 0.9},
+		{Threshold: 2, ReadFraction: 0.8, BaseFraction: 1},
+	}
+	if len(curve) != len(want) {
+		t.Fatalf("len(curve) = %d, want %d (%v)", len(curve), len(want), curve)
+	}
+	for i := range want {
+		if curve[i].Threshold != want[i].Threshold ||
+			math.Abs(curve[i].ReadFraction-want[i].ReadFraction) > 1e-12 ||
+			math.Abs(curve[i].BaseFraction-want[i].BaseFraction) > 1e-12 {
+			t.Errorf("curve[%d] = %+v, want %+v", i, curve[i], want[i])
+		}
+	}
+
+	// Higher-is-better metrics are accumulated from the highest value down
+	curve = retentionCurve(observations[:3], AvgPhred, 0)
+	if curve[0].Threshold != 2 || curve[len(curve)-1].Threshold != 0.5 {
+		t.Errorf("avgphred curve thresholds = %v..%v, want 2..0.5", curve[0].Threshold, curve[len(curve)-1].Threshold)
+	}
+
+	// Downsampling keeps the end points
+	curve = retentionCurve(observations, MaxEE, 2)
+	if len(curve) != 2 || curve[0].Threshold != 0.5 || curve[1].Threshold != 2 {
+		t.Errorf("downsampled curve = %v, want thresholds 0.5 and 2", curve)
+	}
+}
+
+func TestReportCollectorWriteHTML(t *testing.T) {
+	report := NewReportCollector(MaxEE, DEFAULT_MIN_PHRED, -math.MaxFloat64, 0.5)
+	for _, r := range []struct{ seq, qual string }{
+		{"ACGT", "IIII"},
+		{"ACGTAC", "++++++"},
+		{"AC", "5I"},
+	} {
+		record := createTestRecord("read", r.seq, r.qual)
+		report.Add(record, calculateMaxEE(record.Seq.Qual))
+	}
+
+	cmd := &cobra.Command{Use: "nosort"}
+	cmd.Flags().String("metric", "maxee", "")
+	cmd.Flags().Float64("maxqual", 0, "")
+	cmd.Flags().Set("maxqual", "0.5")
+
+	path := filepath.Join(t.TempDir(), "report.html")
+	if err := report.WriteHTML(path, collectReportParams(cmd)); err != nil {
+		t.Fatalf("WriteHTML() error = %v", err)
+	}
+
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(out)
+	for _, want := range []string{
+		"<th>command</th><td>nosort</td>",
+		"<th>maxqual</th><td>0.5</td>",
+		"2 / 3 retained",
+		"Distribution of maxee",
+		"maxqual=0.5",
+		"Per-position quality",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML report missing %q", want)
+		}
+	}
+	if got := strings.Count(html, "<svg"); got != 4 {
+		t.Errorf("HTML report contains %d SVG charts, want 4", got)
+	}
+	if strings.Contains(html, "<script") || strings.Contains(html, "<link") || strings.Contains(html, "src=") {
+		t.Errorf("HTML report must not reference external assets")
+	}
+}
@@ -0,0 +1,816 @@
+// Unaligned SAM/BAM (uBAM) input and output
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+// inputFormat is the format of an input file, detected from its content
+type inputFormat int
+
+const (
+	formatFastx inputFormat = iota // FASTA or FASTQ
+	formatSAM
+	formatBAM
+)
+
+// SAM flags of records that are skipped on input (secondary and supplementary
+// alignments repeat a read of the primary record)
+const (
+	samFlagUnmapped      = 0x4
+	samFlagReverse       = 0x10
+	samFlagSecondary     = 0x100
+	samFlagSupplementary = 0x800
+)
+
+var bamMagic = []byte("BAM\x01")
+
+// detectInputFormat guesses the format of a (decompressed) input stream from its
+// first bytes: the BAM magic, a SAM header line, or a SAM record (at least 11
+// tab-separated fields). Anything else is left to the FASTA/FASTQ reader
+func detectInputFormat(r *bufio.Reader) inputFormat {
+	if b, _ := r.Peek(len(bamMagic)); bytes.Equal(b, bamMagic) {
+		return formatBAM
+	}
+
+	line, _ := r.Peek(r.Size())
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	if len(line) >= 4 && line[0] == '@' && line[3] == '\t' {
+		switch string(line[1:3]) {
+		case "HD", "SQ", "RG", "PG", "CO":
+			return formatSAM
+		}
+	}
+	if len(line) > 0 && line[0] != '>' && line[0] != '@' && bytes.Count(line, []byte{'\t'}) >= 10 {
+		return formatSAM
+	}
+	return formatFastx
+}
+
+// TagFilter selects the SAM/BAM tags of input records that are kept in headers
+type TagFilter struct {
+	All  bool            // Keep all tags
+	Tags map[string]bool // Tags to keep (e.g., "RG", "BC")
+}
+
+var samTagRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]$`)
+
+// parseTagFilter parses the value of the --keep-tags flag (a comma-separated
+// list of tags, or "all")
+func parseTagFilter(s string) (TagFilter, error) {
+	var filter TagFilter
+	if s == "" {
+		return filter, nil
+	}
+	if s == "all" {
+		filter.All = true
+		return filter, nil
+	}
+	filter.Tags = make(map[string]bool)
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if !samTagRegexp.MatchString(tag) {
+			return filter, fmt.Errorf("invalid SAM tag: %s (must be a letter followed by a letter or digit)", tag)
+		}
+		filter.Tags[tag] = true
+	}
+	return filter, nil
+}
+
+// Keeps returns true if a tag is retained
+func (f TagFilter) Keeps(tag string) bool {
+	return f.All || f.Tags[tag]
+}
+
+// unalignedReader reads SAM or BAM records as FASTA/FASTQ records. The record name
+// is QNAME, followed by the retained tags in SAM text form (e.g., "r1\tRG:Z:lane1",
+// as written by `samtools fastq -T`). Reverse-strand records are reverse-complemented
+type unalignedReader struct {
+	fh      *xopen.Reader
+	bam     bool
+	keep    TagFilter
+	header  []byte // SAM header text
+	started bool
+	fastq   bool // Whether records have base qualities (decided by the first record)
+	line    int  // Line (SAM) or record (BAM) number
+	buf     []byte
+	record  fastx.Record
+}
+
+// newUnalignedReader reads the header of a SAM or BAM file
+func newUnalignedReader(fh *xopen.Reader, bam bool, keep TagFilter) (*unalignedReader, error) {
+	r := &unalignedReader{fh: fh, bam: bam, keep: keep, record: fastx.Record{Seq: &seq.Seq{}}}
+	if bam {
+		return r, r.readBAMHeader()
+	}
+	for {
+		b, err := fh.Peek(1)
+		if err != nil || b[0] != '@' {
+			return r, nil
+		}
+		line, err := fh.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		r.line++
+		r.header = append(r.header, bytes.TrimRight(line, "\r\n")...)
+		r.header = append(r.header, '\n')
+	}
+}
+
+// readBAMHeader reads the BAM magic, the header text and the reference sequences
+func (r *unalignedReader) readBAMHeader() error {
+	var fixed [8]byte
+	if _, err := io.ReadFull(r.fh, fixed[:]); err != nil {
+		return fmt.Errorf("truncated BAM header")
+	}
+	text := make([]byte, binary.LittleEndian.Uint32(fixed[4:]))
+	if _, err := io.ReadFull(r.fh, text); err != nil {
+		return fmt.Errorf("truncated BAM header")
+	}
+	r.header = bytes.TrimRight(text, "\x00")
+
+	if _, err := io.ReadFull(r.fh, fixed[:4]); err != nil {
+		return fmt.Errorf("truncated BAM header")
+	}
+	for n := binary.LittleEndian.Uint32(fixed[:4]); n > 0; n-- {
+		if _, err := io.ReadFull(r.fh, fixed[:4]); err != nil {
+			return fmt.Errorf("truncated BAM header")
+		}
+		// Reference name and length
+		if _, err := r.fh.Discard(int(binary.LittleEndian.Uint32(fixed[:4])) + 4); err != nil {
+			return fmt.Errorf("truncated BAM header")
+		}
+	}
+	return nil
+}
+
+// Header returns the SAM header text of the file
+func (r *unalignedReader) Header() []byte {
+	return r.header
+}
+
+// Fastq returns true if the records have base qualities
+func (r *unalignedReader) Fastq() bool {
+	return r.fastq
+}
+
+// Close closes the file
+func (r *unalignedReader) Close() {
+	r.fh.Close()
+}
+
+// Read returns the next record; the record is reused by subsequent calls
+func (r *unalignedReader) Read() (*fastx.Record, error) {
+	for {
+		var flag int
+		var name, sequence, qual []byte
+		var tags [][]byte
+		var err error
+		if r.bam {
+			flag, name, sequence, qual, tags, err = r.readBAM()
+		} else {
+			flag, name, sequence, qual, tags, err = r.readSAM()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if flag&(samFlagSecondary|samFlagSupplementary) != 0 {
+			continue
+		}
+
+		if !r.started {
+			r.started = true
+			r.fastq = qual != nil
+		}
+		if r.fastq && qual == nil {
+			return nil, fmt.Errorf("record %s has no base qualities", name)
+		}
+
+		record := &r.record
+		record.Name = append(record.Name[:0], name...)
+		record.ID = record.Name[:len(name)]
+		for _, tag := range tags {
+			record.Name = append(record.Name, '\t')
+			record.Name = append(record.Name, tag...)
+		}
+		record.Seq.Seq = append(record.Seq.Seq[:0], sequence...)
+		record.Seq.Qual = record.Seq.Qual[:0]
+		if r.fastq {
+			record.Seq.Qual = append(record.Seq.Qual, qual...)
+		}
+		if flag&samFlagReverse != 0 {
+			reverseComplement(record.Seq.Seq)
+			reverseBytes(record.Seq.Qual)
+		}
+		return record, nil
+	}
+}
+
+// readSAM parses the next SAM record line (qualities are returned as Phred+33
+// characters, nil if missing)
+func (r *unalignedReader) readSAM() (flag int, name, sequence, qual []byte, tags [][]byte, err error) {
+	var line []byte
+	for len(line) == 0 {
+		line, err = r.fh.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return 0, nil, nil, nil, nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return 0, nil, nil, nil, nil, err
+		}
+		r.line++
+		line = bytes.TrimRight(line, "\r\n")
+	}
+
+	fields := bytes.Split(line, []byte{'\t'})
+	if len(fields) < 11 {
+		return 0, nil, nil, nil, nil, fmt.Errorf("line %d: SAM record with %d fields (at least 11 expected)", r.line, len(fields))
+	}
+	flag, err = strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return 0, nil, nil, nil, nil, fmt.Errorf("line %d: invalid FLAG: %s", r.line, fields[1])
+	}
+	name, sequence, qual = fields[0], fields[9], fields[10]
+	if string(sequence) == "*" {
+		sequence = sequence[:0]
+	}
+	if string(qual) == "*" {
+		qual = nil
+	} else if len(qual) != len(sequence) {
+		return 0, nil, nil, nil, nil, fmt.Errorf("line %d: unequal lengths of SEQ and QUAL", r.line)
+	}
+	for _, tag := range fields[11:] {
+		if len(tag) >= 5 && tag[2] == ':' && r.keep.Keeps(string(tag[:2])) {
+			tags = append(tags, tag)
+		}
+	}
+	return flag, name, sequence, qual, tags, nil
+}
+
+// bamBases decodes the 4-bit encoded bases of BAM records
+const bamBases = "=ACMGRSVTWYHKDBN"
+
+// readBAM decodes the next BAM record, converting retained aux fields to SAM text
+func (r *unalignedReader) readBAM() (flag int, name, sequence, qual []byte, tags [][]byte, err error) {
+	var size [4]byte
+	if _, err = io.ReadFull(r.fh, size[:]); err != nil {
+		if err == io.EOF {
+			return 0, nil, nil, nil, nil, io.EOF
+		}
+		return 0, nil, nil, nil, nil, fmt.Errorf("truncated BAM record %d", r.line+1)
+	}
+	r.line++
+	blockSize := int(binary.LittleEndian.Uint32(size[:]))
+	if cap(r.buf) < blockSize {
+		r.buf = make([]byte, blockSize)
+	}
+	block := r.buf[:blockSize]
+	if _, err = io.ReadFull(r.fh, block); err != nil || blockSize < 32 {
+		return 0, nil, nil, nil, nil, fmt.Errorf("truncated BAM record %d", r.line)
+	}
+
+	nameLen := int(block[8])
+	cigarLen := int(binary.LittleEndian.Uint16(block[12:]))
+	flag = int(binary.LittleEndian.Uint16(block[14:]))
+	seqLen := int(binary.LittleEndian.Uint32(block[16:]))
+
+	p := 32
+	end := p + nameLen + 4*cigarLen + (seqLen+1)/2 + seqLen
+	if nameLen == 0 || end > len(block) {
+		return 0, nil, nil, nil, nil, fmt.Errorf("malformed BAM record %d", r.line)
+	}
+	name = block[p : p+nameLen-1] // NUL-terminated
+	p += nameLen + 4*cigarLen
+
+	sequence = make([]byte, seqLen)
+	for i := range sequence {
+		b := block[p+i/2]
+		if i%2 == 0 {
+			b >>= 4
+		}
+		sequence[i] = bamBases[b&0xf]
+	}
+	p += (seqLen + 1) / 2
+
+	if seqLen > 0 && block[p] != 0xff {
+		qual = make([]byte, seqLen)
+		for i := range qual {
+			qual[i] = block[p+i] + 33
+		}
+	}
+	p += seqLen
+
+	tags, err = bamAuxText(block[p:], r.keep)
+	if err != nil {
+		return 0, nil, nil, nil, nil, fmt.Errorf("BAM record %d (%s): %v", r.line, name, err)
+	}
+	return flag, name, sequence, qual, tags, nil
+}
+
+// bamAuxSizes are the sizes of the fixed-size BAM aux types
+var bamAuxSizes = map[byte]int{'A': 1, 'c': 1, 'C': 1, 's': 2, 'S': 2, 'i': 4, 'I': 4, 'f': 4}
+
+// bamAuxText converts the aux fields of a BAM record that pass the filter to SAM text
+func bamAuxText(aux []byte, keep TagFilter) ([][]byte, error) {
+	var tags [][]byte
+	for len(aux) > 0 {
+		if len(aux) < 4 {
+			return nil, fmt.Errorf("truncated aux data")
+		}
+		tag, typ := string(aux[:2]), aux[2]
+		aux = aux[3:]
+
+		var value string
+		var n int
+		switch typ {
+		case 'A':
+			if len(aux) < 1 {
+				return nil, fmt.Errorf("truncated aux data")
+			}
+			value, n = "A:"+string(aux[:1]), 1
+		case 'c', 'C', 's', 'S', 'i', 'I', 'f':
+			n = bamAuxSizes[typ]
+			if len(aux) < n {
+				return nil, fmt.Errorf("truncated aux data")
+			}
+			value = bamAuxValue(typ, aux)
+		case 'Z', 'H':
+			n = bytes.IndexByte(aux, 0)
+			if n < 0 {
+				return nil, fmt.Errorf("unterminated string in tag %s", tag)
+			}
+			value = string(typ) + ":" + string(aux[:n])
+			n++
+		case 'B':
+			if len(aux) < 5 {
+				return nil, fmt.Errorf("truncated aux data")
+			}
+			sub, count := aux[0], int(binary.LittleEndian.Uint32(aux[1:]))
+			size, ok := bamAuxSizes[sub]
+			if !ok || sub == 'A' || len(aux) < 5+count*size {
+				return nil, fmt.Errorf("malformed array in tag %s", tag)
+			}
+			var sb strings.Builder
+			sb.WriteString("B:")
+			sb.WriteByte(sub)
+			for i := 0; i < count; i++ {
+				sb.WriteByte(',')
+				sb.WriteString(bamAuxValue(sub, aux[5+i*size:])[2:])
+			}
+			value, n = sb.String(), 5+count*size
+		default:
+			return nil, fmt.Errorf("unknown type '%c' of tag %s", typ, tag)
+		}
+
+		if keep.Keeps(tag) {
+			tags = append(tags, []byte(tag+":"+value))
+		}
+		aux = aux[n:]
+	}
+	return tags, nil
+}
+
+// bamAuxValue formats a numeric aux value as SAM text ("i:<int>" or "f:<float>")
+func bamAuxValue(typ byte, b []byte) string {
+	var v int64
+	switch typ {
+	case 'c':
+		v = int64(int8(b[0]))
+	case 'C':
+		v = int64(b[0])
+	case 's':
+		v = int64(int16(binary.LittleEndian.Uint16(b)))
+	case 'S':
+		v = int64(binary.LittleEndian.Uint16(b))
+	case 'i':
+		v = int64(int32(binary.LittleEndian.Uint32(b)))
+	case 'I':
+		v = int64(binary.LittleEndian.Uint32(b))
+	case 'f':
+		f := math.Float32frombits(binary.LittleEndian.Uint32(b))
+		return "f:" + strconv.FormatFloat(float64(f), 'g', -1, 32)
+	}
+	return "i:" + strconv.FormatInt(v, 10)
+}
+
+var complementTable = func() [256]byte {
+	var t [256]byte
+	for i := range t {
+		t[i] = byte(i)
+	}
+	from, to := "ACGTUMRWSYKVHDBNacgtumrwsykvhdbn", "TGCAAKYWSRMBDHVNtgcaakywsrmbdhvn"
+	for i := range from {
+		t[from[i]] = to[i]
+	}
+	return t
+}()
+
+// reverseComplement reverse-complements a sequence (IUPAC codes) in place
+func reverseComplement(s []byte) {
+	reverseBytes(s)
+	for i, b := range s {
+		s[i] = complementTable[b]
+	}
+}
+
+func reverseBytes(s []byte) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+// samOutputFormat returns true (and whether the output is BAM) if a file name
+// has a .sam or .bam extension (SAM may be compressed, e.g. "out.sam.gz")
+func samOutputFormat(path string) (bam, ok bool) {
+	path = strings.ToLower(path)
+	for _, ext := range []string{".gz", ".xz", ".zst", ".bz2", ".lz4"} {
+		if s, found := strings.CutSuffix(path, ext); found {
+			return false, strings.HasSuffix(s, ".sam")
+		}
+	}
+	switch {
+	case strings.HasSuffix(path, ".bam"):
+		return true, true
+	case strings.HasSuffix(path, ".sam"):
+		return false, true
+	}
+	return false, false
+}
+
+// Default tags of the metrics in SAM/BAM output (X?, Y? and Z? tags are reserved
+// for local use); a --header-alias that is a valid tag replaces the default
+var metricTags = map[string]string{
+	"avgphred":  "XQ",
+	"maxee":     "XE",
+	"meep":      "XM",
+	"lqcount":   "XC",
+	"lqpercent": "XP",
+	"length":    "XL",
+}
+
+// metricTag returns the SAM tag of a metric
+func (f HeaderFormat) metricTag(name string) string {
+	if key, ok := f.Aliases[name]; ok && samTagRegexp.MatchString(key) {
+		return key
+	}
+	return metricTags[name]
+}
+
+// SAMWriter writes records as unaligned SAM or BAM (flag 4, no alignment fields).
+// Header annotations in SAM tag form (e.g., tags retained with --keep-tags) become
+// aux fields, and any other text after the sequence ID is kept in a CO:Z: tag.
+// It implements io.Writer for data that is already encoded (e.g., header lines)
+type SAMWriter struct {
+	w    io.Writer
+	bgzf *bgzfWriter // BGZF compression of BAM output (nil for SAM)
+	buf  []byte
+}
+
+// NewSAMOutput creates a SAMWriter on w if path has a .sam or .bam extension
+// (returns nil otherwise). The @RG, @PG and @CO lines of header (the SAM header
+// of the input, if any) are copied to the output
+func NewSAMOutput(w io.Writer, path string, header []byte) (*SAMWriter, error) {
+	bam, ok := samOutputFormat(path)
+	if !ok {
+		return nil, nil
+	}
+
+	s := &SAMWriter{w: w}
+	if bam {
+		s.bgzf = newBGZFWriter(w)
+		s.w = s.bgzf
+	}
+
+	text := []byte("@HD\tVN:1.6\tSO:unknown\n")
+	var lines []string
+	for _, line := range strings.Split(string(header), "\n") {
+		if strings.HasPrefix(line, "@RG\t") || strings.HasPrefix(line, "@PG\t") || strings.HasPrefix(line, "@CO\t") {
+			text = append(text, line+"\n"...)
+			lines = append(lines, line)
+		}
+	}
+	// Program IDs must be unique
+	id := "phredsort"
+	for n := 1; strings.Contains(strings.Join(lines, "\n")+"\t", "\tID:"+id+"\t"); n++ {
+		id = "phredsort." + strconv.Itoa(n)
+	}
+	text = append(text, "@PG\tID:"+id+"\tPN:phredsort\tVN:"+VERSION+"\n"...)
+
+	if !bam {
+		_, err := s.w.Write(text)
+		return s, err
+	}
+	s.buf = append(s.buf[:0], bamMagic...)
+	s.buf = binary.LittleEndian.AppendUint32(s.buf, uint32(len(text)))
+	s.buf = append(s.buf, text...)
+	s.buf = binary.LittleEndian.AppendUint32(s.buf, 0) // No reference sequences
+	_, err := s.w.Write(s.buf)
+	return s, err
+}
+
+// Write writes encoded data to the output (through BGZF compression for BAM)
+func (s *SAMWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+// isSAMTagText returns true for a tag in SAM text form (e.g., "RG:Z:lane1")
+func isSAMTagText(field []byte) bool {
+	return len(field) >= 5 && field[2] == ':' && field[4] == ':' &&
+		samTagRegexp.Match(field[:2]) && strings.IndexByte("AifZHB", field[3]) >= 0
+}
+
+// WriteRecord writes a record with additional tags in SAM text form (e.g., metrics,
+// "XE:f:0.12"), which replace header tags with the same name
+func (s *SAMWriter) WriteRecord(record *fastx.Record, tags []string) error {
+	words := bytes.Fields(record.Name)
+	if len(words) == 0 {
+		return fmt.Errorf("record without a name")
+	}
+	qname := words[0]
+	if len(qname) > 254 {
+		return fmt.Errorf("record name %s is too long for SAM/BAM (max. 254 characters)", qname)
+	}
+
+	added := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		added[tag[:2]] = true
+	}
+	var fields [][]byte
+	var comment []string
+	for _, w := range words[1:] {
+		if isSAMTagText(w) {
+			if !added[string(w[:2])] {
+				fields = append(fields, w)
+			}
+		} else {
+			comment = append(comment, string(w))
+		}
+	}
+	for _, tag := range tags {
+		fields = append(fields, []byte(tag))
+	}
+	if len(comment) > 0 && !added["CO"] {
+		fields = append(fields, []byte("CO:Z:"+strings.Join(comment, " ")))
+	}
+
+	if s.bgzf != nil {
+		return s.writeBAM(qname, record.Seq.Seq, record.Seq.Qual, fields)
+	}
+
+	b := append(s.buf[:0], qname...)
+	b = append(b, "\t4\t*\t0\t0\t*\t*\t0\t0\t"...)
+	if len(record.Seq.Seq) == 0 {
+		b = append(b, "*\t*"...)
+	} else {
+		b = append(b, record.Seq.Seq...)
+		b = append(b, '\t')
+		if len(record.Seq.Qual) > 0 {
+			b = append(b, record.Seq.Qual...)
+		} else {
+			b = append(b, '*')
+		}
+	}
+	for _, f := range fields {
+		b = append(b, '\t')
+		b = append(b, f...)
+	}
+	b = append(b, '\n')
+	s.buf = b
+	_, err := s.w.Write(b)
+	return err
+}
+
+// bamBaseCodes maps bases to their 4-bit BAM codes (unknown characters become N)
+var bamBaseCodes = func() [256]byte {
+	var t [256]byte
+	for i := range t {
+		t[i] = 15
+	}
+	for i := range bamBases {
+		t[bamBases[i]] = byte(i)
+		t[bamBases[i]|0x20] = byte(i) // Lowercase
+	}
+	return t
+}()
+
+// writeBAM encodes an unmapped BAM record
+func (s *SAMWriter) writeBAM(qname, sequence, qual []byte, tags [][]byte) error {
+	b := append(s.buf[:0], 0, 0, 0, 0)                      // block_size (set below)
+	b = binary.LittleEndian.AppendUint32(b, math.MaxUint32) // refID = -1
+	b = binary.LittleEndian.AppendUint32(b, math.MaxUint32) // pos = -1
+	b = append(b, byte(len(qname)+1), 0)                    // l_read_name, mapq
+	b = binary.LittleEndian.AppendUint16(b, 4680)           // bin of unmapped reads
+	b = binary.LittleEndian.AppendUint16(b, 0)              // n_cigar_op
+	b = binary.LittleEndian.AppendUint16(b, samFlagUnmapped)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(sequence)))
+	b = binary.LittleEndian.AppendUint32(b, math.MaxUint32) // next_refID = -1
+	b = binary.LittleEndian.AppendUint32(b, math.MaxUint32) // next_pos = -1
+	b = binary.LittleEndian.AppendUint32(b, 0)              // tlen
+	b = append(b, qname...)
+	b = append(b, 0)
+
+	for i := 0; i < len(sequence); i += 2 {
+		c := bamBaseCodes[sequence[i]] << 4
+		if i+1 < len(sequence) {
+			c |= bamBaseCodes[sequence[i+1]]
+		}
+		b = append(b, c)
+	}
+	for i := range sequence {
+		if len(qual) == 0 {
+			b = append(b, 0xff)
+		} else {
+			b = append(b, qual[i]-33)
+		}
+	}
+
+	var err error
+	for _, tag := range tags {
+		if b, err = appendBAMAux(b, tag); err != nil {
+			return fmt.Errorf("record %s: %v", qname, err)
+		}
+	}
+
+	binary.LittleEndian.PutUint32(b, uint32(len(b)-4))
+	s.buf = b
+	_, err = s.w.Write(b)
+	return err
+}
+
+// appendBAMAux encodes a tag in SAM text form (e.g., "XE:f:0.12") as a BAM aux field.
+// Integers are stored in the smallest type that holds them
+func appendBAMAux(b, tag []byte) ([]byte, error) {
+	typ, value := tag[3], string(tag[5:])
+	b = append(b, tag[:2]...)
+	switch typ {
+	case 'A':
+		if len(value) != 1 {
+			return b, fmt.Errorf("invalid tag %s", tag)
+		}
+		return append(b, 'A', value[0]), nil
+	case 'Z', 'H':
+		b = append(b, typ)
+		b = append(b, value...)
+		return append(b, 0), nil
+	case 'i':
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return b, fmt.Errorf("invalid tag %s", tag)
+		}
+		return appendBAMInt(b, v)
+	case 'f':
+		v, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return b, fmt.Errorf("invalid tag %s", tag)
+		}
+		b = append(b, 'f')
+		return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(v))), nil
+	case 'B':
+		items := strings.Split(value, ",")
+		size, ok := bamAuxSizes[items[0][0]]
+		if len(items[0]) != 1 || !ok || items[0][0] == 'A' {
+			return b, fmt.Errorf("invalid tag %s", tag)
+		}
+		sub := items[0][0]
+		b = append(b, 'B', sub)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(items)-1))
+		for _, item := range items[1:] {
+			if sub == 'f' {
+				v, err := strconv.ParseFloat(item, 32)
+				if err != nil {
+					return b, fmt.Errorf("invalid tag %s", tag)
+				}
+				b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(v)))
+				continue
+			}
+			v, err := strconv.ParseInt(item, 10, size*8+1)
+			if err != nil {
+				return b, fmt.Errorf("invalid tag %s", tag)
+			}
+			switch size {
+			case 1:
+				b = append(b, byte(v))
+			case 2:
+				b = binary.LittleEndian.AppendUint16(b, uint16(v))
+			default:
+				b = binary.LittleEndian.AppendUint32(b, uint32(v))
+			}
+		}
+		return b, nil
+	}
+	return b, fmt.Errorf("invalid tag %s", tag)
+}
+
+// appendBAMInt appends the type and value of an integer aux field
+func appendBAMInt(b []byte, v int64) ([]byte, error) {
+	switch {
+	case v >= 0 && v <= math.MaxUint8:
+		return append(b, 'C', byte(v)), nil
+	case v >= math.MinInt8 && v < 0:
+		return append(b, 'c', byte(v)), nil
+	case v >= 0 && v <= math.MaxUint16:
+		return binary.LittleEndian.AppendUint16(append(b, 'S'), uint16(v)), nil
+	case v >= math.MinInt16 && v < 0:
+		return binary.LittleEndian.AppendUint16(append(b, 's'), uint16(v)), nil
+	case v >= 0 && v <= math.MaxUint32:
+		return binary.LittleEndian.AppendUint32(append(b, 'I'), uint32(v)), nil
+	case v >= math.MinInt32 && v < 0:
+		return binary.LittleEndian.AppendUint32(append(b, 'i'), uint32(v)), nil
+	}
+	return b, fmt.Errorf("integer %d is out of range for BAM", v)
+}
+
+// Close writes the remaining data (and, for BAM, the BGZF end-of-file marker).
+// The underlying writer is not closed
+func (s *SAMWriter) Close() error {
+	if s.bgzf != nil {
+		return s.bgzf.Close()
+	}
+	return nil
+}
+
+// bgzfBlockSize is the amount of data compressed into one BGZF block; compressed
+// blocks (including the header) must not exceed 64 KiB
+const bgzfBlockSize = 0xff00
+
+// bgzfEOF is the empty block that terminates BGZF files
+var bgzfEOF = []byte{0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff, 6, 0, 'B', 'C', 2, 0, 0x1b, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+// bgzfWriter compresses data into BGZF blocks (gzip members with the block
+// size in a "BC" extra field), as required for BAM
+type bgzfWriter struct {
+	w    io.Writer
+	buf  []byte
+	comp bytes.Buffer
+	fw   *flate.Writer
+}
+
+func newBGZFWriter(w io.Writer) *bgzfWriter {
+	fw, _ := flate.NewWriter(nil, flate.DefaultCompression)
+	return &bgzfWriter{w: w, buf: make([]byte, 0, bgzfBlockSize), fw: fw}
+}
+
+// Write buffers data, writing a block whenever bgzfBlockSize bytes are collected
+func (z *bgzfWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		k := min(bgzfBlockSize-len(z.buf), len(p))
+		z.buf = append(z.buf, p[:k]...)
+		p = p[k:]
+		if len(z.buf) == bgzfBlockSize {
+			if err := z.flush(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+// flush compresses the buffered data into one block
+func (z *bgzfWriter) flush() error {
+	if len(z.buf) == 0 {
+		return nil
+	}
+	z.comp.Reset()
+	z.fw.Reset(&z.comp)
+	z.fw.Write(z.buf)
+	if err := z.fw.Close(); err != nil {
+		return err
+	}
+
+	header := []byte{0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff, 6, 0, 'B', 'C', 2, 0, 0, 0}
+	binary.LittleEndian.PutUint16(header[16:], uint16(len(header)+z.comp.Len()+8-1))
+	block := append(header, z.comp.Bytes()...)
+	block = binary.LittleEndian.AppendUint32(block, crc32.ChecksumIEEE(z.buf))
+	block = binary.LittleEndian.AppendUint32(block, uint32(len(z.buf)))
+	z.buf = z.buf[:0]
+	_, err := z.w.Write(block)
+	return err
+}
+
+// Close writes the buffered data and the end-of-file marker
+func (z *bgzfWriter) Close() error {
+	if err := z.flush(); err != nil {
+		return err
+	}
+	_, err := z.w.Write(bgzfEOF)
+	return err
+}
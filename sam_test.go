@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func TestDetectInputFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  inputFormat
+	}{
+		{"FASTQ", "@r1\nACGT\n+\nIIII\n", formatFastx},
+		{"FASTA", ">r1\nACGT\n", formatFastx},
+		{"BAM", "BAM\x01\x00\x00\x00\x00", formatBAM},
+		{"SAM header", "@HD\tVN:1.6\n", formatSAM},
+		{"Headerless SAM", "r1\t4\t*\t0\t0\t*\t*\t0\t0\tACGT\tIIII\n", formatSAM},
+		{"FASTQ header with tabs", "@r1\tRG:Z:a\tBC:Z:b\tx\tx\tx\tx\tx\tx\tx\tx\nACGT\n+\nIIII\n", formatFastx},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectInputFormat(bufio.NewReader(strings.NewReader(tt.input))); got != tt.want {
+				t.Errorf("detectInputFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTagFilter(t *testing.T) {
+	filter, err := parseTagFilter("RG, BC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filter.Keeps("RG") || !filter.Keeps("BC") || filter.Keeps("XE") {
+		t.Errorf("parseTagFilter() = %+v", filter)
+	}
+	if filter, _ := parseTagFilter("all"); !filter.Keeps("XE") {
+		t.Error("parseTagFilter(all) should keep all tags")
+	}
+	if _, err := parseTagFilter("RG,B"); err == nil {
+		t.Error("parseTagFilter() expected an error for an invalid tag")
+	}
+}
+
+// readInputRecords reads all records of an Input (names, sequences and qualities)
+func readInputRecords(t *testing.T, in Input) []string {
+	t.Helper()
+	reader, err := NewInputReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var got []string
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			break
+		}
+		got = append(got, string(record.Name)+" "+string(record.Seq.Seq)+" "+string(record.Seq.Qual))
+	}
+	return got
+}
+
+func TestUnalignedSAMInput(t *testing.T) {
+	tmpDir := t.TempDir()
+	sam := filepath.Join(tmpDir, "reads.sam")
+	content := "@HD\tVN:1.6\tSO:unknown\n@RG\tID:lane1\n" +
+		"r1\t77\t*\t0\t0\t*\t*\t0\t0\tACGTN\tIII5+\tRG:Z:lane1\tBC:Z:AAA\n" +
+		"r1\t333\t*\t0\t0\t*\t*\t0\t0\tACGT\tIIII\tRG:Z:lane1\n" + // secondary
+		"r2\t20\t*\t0\t0\t*\t*\t0\t0\tAACG\t5+?I\tRG:Z:lane1\n" // reverse strand
+	if err := os.WriteFile(sam, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readInputRecords(t, Input{Files: []string{sam}})
+	want := []string{"r1 ACGTN III5+", "r2 CGTT I?+5"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %q, want %q", got, want)
+	}
+
+	keep, _ := parseTagFilter("RG")
+	got = readInputRecords(t, Input{Files: []string{sam}, KeepTags: keep})
+	want = []string{"r1\tRG:Z:lane1 ACGTN III5+", "r2\tRG:Z:lane1 CGTT I?+5"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records with tags = %q, want %q", got, want)
+	}
+
+	reader, err := NewInputReader(Input{Files: []string{sam}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if !bytes.Contains(reader.SAMHeader(), []byte("@RG\tID:lane1")) {
+		t.Errorf("SAMHeader() = %q", reader.SAMHeader())
+	}
+	if _, err := reader.Read(); err != nil || !reader.IsFastq {
+		t.Errorf("Read() error = %v, IsFastq = %v", err, reader.IsFastq)
+	}
+}
+
+func TestSAMOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	input := filepath.Join(tmpDir, "reads.fq")
+	writeFastqRecords(t, input, []*fastx.Record{
+		createTestRecord("r1\tRG:Z:lane1 sample=A", "ACGT", "5555"), // Q20
+		createTestRecord("r2", "ACGTA", "IIIII"),                    // Q40
+	})
+	headerMetrics := []HeaderMetric{{Name: "maxee"}, {Name: "length", IsLength: true}}
+	format := HeaderFormat{Precision: 2, Aliases: map[string]string{"length": "ln"}} // A valid tag replaces XL
+
+	samPath := filepath.Join(tmpDir, "sorted.sam")
+	sortRecords(testInput(input), samPath, false, AvgPhred, 1, headerMetrics, format, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{})
+	data, err := os.ReadFile(samPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "@HD\tVN:1.6\tSO:unknown\n" +
+		"@PG\tID:phredsort\tPN:phredsort\tVN:" + VERSION + "\n" +
+		"r2\t4\t*\t0\t0\t*\t*\t0\t0\tACGTA\tIIIII\tXE:f:0.00\tln:i:5\n" +
+		"r1\t4\t*\t0\t0\t*\t*\t0\t0\tACGT\t5555\tRG:Z:lane1\tXE:f:0.04\tln:i:4\tCO:Z:sample=A\n"
+	if string(data) != want {
+		t.Errorf("SAM output:\n%s\nwant:\n%s", data, want)
+	}
+
+	// BAM output with the tags of the SAM file, read back with all tags
+	keep, _ := parseTagFilter("all")
+	bamPath := filepath.Join(tmpDir, "sorted.bam")
+	if err := runNoSort(Input{Files: []string{samPath}, KeepTags: keep}, bamPath, MaxEE, []HeaderMetric{{Name: "avgphred"}}, defaultHeaderFormat, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{}); err != nil {
+		t.Fatalf("runNoSort() error = %v", err)
+	}
+	bam, err := os.ReadFile(bamPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(bam, bgzfEOF) {
+		t.Error("BAM output has no BGZF end-of-file marker")
+	}
+
+	got := readInputRecords(t, Input{Files: []string{bamPath}, KeepTags: keep})
+	wantRecords := []string{
+		"r2\tXE:f:0\tln:i:5\tXQ:f:40 ACGTA IIIII",
+		"r1\tRG:Z:lane1\tXE:f:0.04\tln:i:4\tCO:Z:sample=A\tXQ:f:20 ACGT 5555",
+	}
+	if !reflect.DeepEqual(got, wantRecords) {
+		t.Errorf("BAM records = %q, want %q", got, wantRecords)
+	}
+
+	reader, err := NewInputReader(testInput(bamPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if header := string(reader.SAMHeader()); !strings.Contains(header, "\tID:phredsort.1\t") {
+		t.Errorf("program ID of the second run is not unique:\n%s", header)
+	}
+}
+
+func TestBAMAuxRoundTrip(t *testing.T) {
+	tags := []string{"XA:A:x", "XZ:Z:some text", "XH:H:1AE3", "X1:i:-5", "X2:i:300", "X3:i:-70000", "X4:i:4000000000", "XF:f:0.5", "XB:B:s,-1,2,300", "XC:B:f,0.25,1"}
+	var aux []byte
+	for _, tag := range tags {
+		var err error
+		if aux, err = appendBAMAux(aux, []byte(tag)); err != nil {
+			t.Fatalf("appendBAMAux(%s) error = %v", tag, err)
+		}
+	}
+
+	decoded, err := bamAuxText(aux, TagFilter{All: true})
+	if err != nil {
+		t.Fatalf("bamAuxText() error = %v", err)
+	}
+	var got []string
+	for _, tag := range decoded {
+		got = append(got, string(tag))
+	}
+	if !reflect.DeepEqual(got, tags) {
+		t.Errorf("round trip = %q, want %q", got, tags)
+	}
+
+	if _, err := appendBAMAux(nil, []byte("XI:i:abc")); err == nil {
+		t.Error("appendBAMAux() expected an error for an invalid integer")
+	}
+}
+
+func TestSAMOutputFormat(t *testing.T) {
+	tests := []struct {
+		path    string
+		bam, ok bool
+	}{
+		{"out.bam", true, true},
+		{"OUT.SAM", false, true},
+		{"out.sam.gz", false, true},
+		{"out.fq.gz", false, false},
+		{"-", false, false},
+	}
+	for _, tt := range tests {
+		if bam, ok := samOutputFormat(tt.path); bam != tt.bam || ok != tt.ok {
+			t.Errorf("samOutputFormat(%s) = %v, %v", tt.path, bam, ok)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Splitting of the output into quality tiers (--bins) or fixed-size shards (--split-records, --split-bases)
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+)
+
+// OutputSplitter distributes output records among several files named after
+// a pattern. With Bins, records are assigned to quality tiers by their metric
+// value ("{bin}" in the pattern), and with Records or Bases a new file is
+// started after every N records or bases ("{part}" in the pattern).
+// Both can be combined, in which case each tier is split into parts.
+// Files are created when the first record is written to them
+type OutputSplitter struct {
+	Pattern string    // File name pattern (e.g., "tier_{bin}.fq.gz")
+	Bins    []float64 // Metric breakpoints, in increasing order
+	Labels  []string  // Names of the bins used for "{bin}" (default: 1, 2, ...)
+	Records int       // Maximum number of records per file (0 = no limit)
+	Bases   int       // Start a new file once this many bases are written (0 = no limit)
+	Summary SplitSummary
+
+	outputs map[int]*splitOutput // Current file of each bin
+}
+
+// splitOutput is the file currently written for a bin
+type splitOutput struct {
+	fh      *xopen.Writer
+	part    int
+	records int
+	bases   int
+}
+
+// SplitSummary counts the files and records written by an OutputSplitter
+type SplitSummary struct {
+	Files   int
+	Records int
+}
+
+// Write prints the summary in a human-readable form
+func (s SplitSummary) Write(w io.Writer) {
+	fmt.Fprintf(w, "%s %d records written to %d files\n", bold("Split:"), s.Records, s.Files)
+}
+
+// NewOutputSplitter validates the splitting flags.
+// bins is a comma-separated list of breakpoints (e.g., "0.5,1,2" defines
+// four bins: below 0.5, [0.5, 1), [1, 2), and 2 or above), and labels is
+// an optional comma-separated list of bin names (one more than breakpoints).
+// Returns nil if no splitting is requested
+func NewOutputSplitter(pattern, bins, labels string, records, bases int) (*OutputSplitter, error) {
+	if pattern == "" {
+		if bins != "" || records != 0 || bases != 0 {
+			return nil, fmt.Errorf("--bins, --split-records and --split-bases require --out-pattern")
+		}
+		return nil, nil
+	}
+	if _, sam := samOutputFormat(pattern); sam {
+		return nil, fmt.Errorf("SAM/BAM output can't be split with --out-pattern")
+	}
+	if bins == "" && records == 0 && bases == 0 {
+		return nil, fmt.Errorf("--out-pattern requires --bins, --split-records or --split-bases")
+	}
+	if records < 0 || bases < 0 {
+		return nil, fmt.Errorf("--split-records and --split-bases must be non-negative")
+	}
+	if records > 0 && bases > 0 {
+		return nil, fmt.Errorf("--split-records and --split-bases can't be used together")
+	}
+
+	s := &OutputSplitter{Pattern: pattern, Records: records, Bases: bases, outputs: make(map[int]*splitOutput)}
+
+	if bins != "" {
+		for _, b := range strings.Split(bins, ",") {
+			v, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bin breakpoint: %s", b)
+			}
+			if len(s.Bins) > 0 && v <= s.Bins[len(s.Bins)-1] {
+				return nil, fmt.Errorf("bin breakpoints must be in increasing order: %s", bins)
+			}
+			s.Bins = append(s.Bins, v)
+		}
+		if !strings.Contains(pattern, "{bin}") {
+			return nil, fmt.Errorf("--out-pattern must contain {bin} with --bins")
+		}
+	} else if strings.Contains(pattern, "{bin}") {
+		return nil, fmt.Errorf("{bin} in --out-pattern requires --bins")
+	}
+
+	if labels != "" {
+		if bins == "" {
+			return nil, fmt.Errorf("--bin-labels requires --bins")
+		}
+		seen := make(map[string]bool)
+		for _, l := range strings.Split(labels, ",") {
+			l = strings.TrimSpace(l)
+			if l == "" || seen[l] {
+				return nil, fmt.Errorf("bin labels must be non-empty and unique: %s", labels)
+			}
+			seen[l] = true
+			s.Labels = append(s.Labels, l)
+		}
+		if len(s.Labels) != len(s.Bins)+1 {
+			return nil, fmt.Errorf("expected %d bin labels (one more than breakpoints), got %d", len(s.Bins)+1, len(s.Labels))
+		}
+	}
+
+	if records > 0 || bases > 0 {
+		if !strings.Contains(pattern, "{part}") {
+			return nil, fmt.Errorf("--out-pattern must contain {part} with --split-records or --split-bases")
+		}
+	} else if strings.Contains(pattern, "{part}") {
+		return nil, fmt.Errorf("{part} in --out-pattern requires --split-records or --split-bases")
+	}
+
+	return s, nil
+}
+
+// Bin returns the index of the bin of a metric value
+func (s *OutputSplitter) Bin(value float64) int {
+	return sort.Search(len(s.Bins), func(i int) bool { return s.Bins[i] > value })
+}
+
+// FileName returns the name of a file of the given bin and part (1-based)
+func (s *OutputSplitter) FileName(bin, part int) string {
+	label := strconv.Itoa(bin + 1)
+	if len(s.Labels) > 0 {
+		label = s.Labels[bin]
+	}
+	return strings.NewReplacer("{bin}", label, "{part}", fmt.Sprintf("%03d", part)).Replace(s.Pattern)
+}
+
+// Writer returns the output file of a record with the given metric value and
+// sequence length, starting a new file when the current one is full
+func (s *OutputSplitter) Writer(value float64, length int) (*xopen.Writer, error) {
+	bin := 0
+	if len(s.Bins) > 0 {
+		bin = s.Bin(value)
+	}
+	out := s.outputs[bin]
+	if out == nil {
+		out = &splitOutput{}
+		s.outputs[bin] = out
+	}
+
+	full := (s.Records > 0 && out.records >= s.Records) || (s.Bases > 0 && out.bases >= s.Bases)
+	if out.fh == nil || full {
+		if out.fh != nil {
+			if err := out.fh.Close(); err != nil {
+				return nil, fmt.Errorf("error closing output file: %v", err)
+			}
+		}
+		out.part++
+		out.records, out.bases = 0, 0
+
+		fh, err := xopen.Wopen(s.FileName(bin, out.part))
+		if err != nil {
+			return nil, fmt.Errorf("error creating output file: %v", err)
+		}
+		out.fh = fh
+		s.Summary.Files++
+	}
+
+	out.records++
+	out.bases += length
+	s.Summary.Records++
+	return out.fh, nil
+}
+
+// Close closes all open files
+func (s *OutputSplitter) Close() error {
+	var firstErr error
+	for _, out := range s.outputs {
+		if out.fh == nil {
+			continue
+		}
+		if err := out.fh.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error closing output file: %v", err)
+		}
+		out.fh = nil
+	}
+	return firstErr
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+func TestNewOutputSplitter(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		bins    string
+		labels  string
+		records int
+		bases   int
+		wantErr bool
+	}{
+		{name: "No splitting"},
+		{name: "Bins", pattern: "tier_{bin}.fq", bins: "0.5,1,2"},
+		{name: "Bins with labels", pattern: "{bin}.fq", bins: "1,2", labels: "gold,silver,bronze"},
+		{name: "Bins split into parts", pattern: "{bin}_{part}.fq", bins: "1", records: 10},
+		{name: "Records", pattern: "part_{part}.fq", records: 10},
+		{name: "Bins without pattern", bins: "1", wantErr: true},
+		{name: "Pattern without splitting", pattern: "out.fq", wantErr: true},
+		{name: "Pattern without {bin}", pattern: "out_{part}.fq", bins: "1", records: 10, wantErr: true},
+		{name: "Pattern without {part}", pattern: "out_{bin}.fq", bins: "1", records: 10, wantErr: true},
+		{name: "Unused {part}", pattern: "out_{bin}_{part}.fq", bins: "1", wantErr: true},
+		{name: "Unsorted breakpoints", pattern: "{bin}.fq", bins: "2,1", wantErr: true},
+		{name: "Invalid breakpoint", pattern: "{bin}.fq", bins: "1,x", wantErr: true},
+		{name: "Wrong number of labels", pattern: "{bin}.fq", bins: "1,2", labels: "gold,silver", wantErr: true},
+		{name: "Duplicate labels", pattern: "{bin}.fq", bins: "1", labels: "a,a", wantErr: true},
+		{name: "Records and bases", pattern: "{part}.fq", records: 10, bases: 100, wantErr: true},
+		{name: "Negative records", pattern: "{part}.fq", records: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewOutputSplitter(tt.pattern, tt.bins, tt.labels, tt.records, tt.bases)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("NewOutputSplitter() expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewOutputSplitter() error = %v", err)
+			}
+			if (s == nil) != (tt.pattern == "") {
+				t.Errorf("NewOutputSplitter() = %v", s)
+			}
+		})
+	}
+}
+
+func TestOutputSplitterBins(t *testing.T) {
+	s, err := NewOutputSplitter("tier_{bin}.fq.gz", "0.5,1,2", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		value float64
+		want  int
+	}{{0, 0}, {0.49, 0}, {0.5, 1}, {1.5, 2}, {2, 3}, {math.Inf(1), 3}} {
+		if got := s.Bin(tt.value); got != tt.want {
+			t.Errorf("Bin(%v) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+	if got := s.FileName(2, 1); got != "tier_3.fq.gz" {
+		t.Errorf("FileName() = %s", got)
+	}
+
+	s.Labels = []string{"gold", "silver", "bronze", "rest"}
+	s.Pattern = "{bin}_{part}.fq"
+	if got := s.FileName(0, 12); got != "gold_012.fq" {
+		t.Errorf("FileName() = %s", got)
+	}
+}
+
+func TestSortRecordsBins(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("r1", "ACGT", "5555"), // Q20
+		createTestRecord("r2", "ACGT", "IIII"), // Q40
+		createTestRecord("r3", "ACGT", "????"), // Q30
+		createTestRecord("r4", "ACGT", "++++"), // Q10
+		createTestRecord("r5", "ACGT", "IIII"), // Q40
+	})
+
+	for _, compLevel := range []int{0, 1} {
+		outDir := t.TempDir()
+		split, err := NewOutputSplitter(filepath.Join(outDir, "{bin}.fq"), "15,35", "bronze,silver,gold", 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sortRecords(testInput(inputPath), "-", false, AvgPhred, compLevel, nil, defaultHeaderFormat, DEFAULT_MIN_PHRED, -math.MaxFloat64, math.MaxFloat64, OutputOptions{Split: split})
+		if err := split.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string][]string{
+			"gold":   {"r2", "r5"},
+			"silver": {"r3", "r1"},
+			"bronze": {"r4"},
+		}
+		for label, ids := range want {
+			if got := readFastxIDs(t, filepath.Join(outDir, label+".fq")); !reflect.DeepEqual(got, ids) {
+				t.Errorf("compLevel %d: %s = %v, want %v", compLevel, label, got, ids)
+			}
+		}
+		if split.Summary != (SplitSummary{Files: 3, Records: 5}) {
+			t.Errorf("compLevel %d: summary = %+v", compLevel, split.Summary)
+		}
+	}
+}
+
+func TestRunNoSortSplit(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.fastq")
+	writeFastqRecords(t, inputPath, []*fastx.Record{
+		createTestRecord("r1", "ACGTA", "IIIII"),
+		createTestRecord("r2", "AC", "II"),
+		createTestRecord("r3", "ACG", "III"),
+		createTestRecord("r4", "ACGT", "$$$$"), // removed by the quality filter
+		createTestRecord("r5", "A", "I"),
+		createTestRecord("r6", "ACGT", "IIII"),
+	})
+
+	tests := []struct {
+		name    string
+		records int
+		bases   int
+		want    [][]string
+	}{
+		{
+			name:    "Every 2 records",
+			records: 2,
+			want:    [][]string{{"r1", "r2"}, {"r3", "r5"}, {"r6"}},
+		},
+		{
+			name:  "Every 6 bases",
+			bases: 6,
+			want:  [][]string{{"r1", "r2"}, {"r3", "r5", "r6"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outDir := t.TempDir()
+			split, err := NewOutputSplitter(filepath.Join(outDir, "part_{part}.fq"), "", "", tt.records, tt.bases)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = runNoSort(testInput(inputPath), "-", AvgPhred, nil, defaultHeaderFormat, DEFAULT_MIN_PHRED, 20, math.MaxFloat64, OutputOptions{Split: split})
+			if closeErr := split.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				t.Fatalf("runNoSort() error = %v", err)
+			}
+
+			files, _ := filepath.Glob(filepath.Join(outDir, "part_*.fq"))
+			if len(files) != len(tt.want) {
+				t.Fatalf("got %d files, want %d", len(files), len(tt.want))
+			}
+			for j, ids := range tt.want {
+				path := filepath.Join(outDir, fmt.Sprintf("part_%03d.fq", j+1))
+				if got := readFastxIDs(t, path); !reflect.DeepEqual(got, ids) {
+					t.Errorf("%s = %v, want %v", filepath.Base(path), got, ids)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+#!/usr/bin/env python3
+"""Read the Parquet metrics tables of phredsort with an independent reader (pyarrow)
+
+The same metrics are written as TSV and as Parquet, and both tables must match,
+as must the min/max statistics of each row group. The large input spans two row
+groups and has empty reads (maxee = +Inf).
+
+Usage: python3 test/check_parquet.py ./phredsort
+"""
+
+import csv
+import os
+import random
+import subprocess
+import sys
+import tempfile
+
+import pyarrow.parquet as pq
+
+
+def write_fastq(path, n):
+    rng = random.Random(1)
+    with open(path, "w") as f:
+        for i in range(n):
+            length = rng.randint(0, 50)
+            qual = "".join(chr(33 + rng.randint(2, 40)) for _ in range(length))
+            f.write(f"@r{i}\n{'A' * length}\n+\n{qual}\n")
+
+
+def metrics(phredsort, fastq, header, path, fmt):
+    subprocess.run(
+        [phredsort, "nosort", "--in", fastq, "--header", header,
+         "--metrics-out", path, "--metrics-format", fmt, "--metrics-only"],
+        check=True,
+    )
+
+
+def check(phredsort, fastq, header, tmp, row_groups):
+    tsv, parquet = os.path.join(tmp, "metrics.tsv"), os.path.join(tmp, "metrics.parquet")
+    metrics(phredsort, fastq, header, tsv, "tsv")
+    metrics(phredsort, fastq, header, parquet, "parquet")
+
+    with open(tsv, newline="") as f:
+        rows = list(csv.DictReader(f, delimiter="\t"))
+
+    meta = pq.ParquetFile(parquet).metadata
+    assert meta.num_row_groups == row_groups, f"{meta.num_row_groups} row groups, want {row_groups}"
+    table = pq.read_table(parquet).to_pydict()
+
+    start = 0
+    for g in range(meta.num_row_groups):
+        group = meta.row_group(g)
+        for c in range(1, group.num_columns - 1):  # length and metrics
+            column = group.column(c)
+            values = table[column.path_in_schema][start:start + group.num_rows]
+            stats = column.statistics
+            assert stats is not None and stats.has_min_max, f"{column.path_in_schema}: no statistics"
+            assert (stats.min, stats.max) == (min(values), max(values)), \
+                f"{column.path_in_schema}: statistics [{stats.min}, {stats.max}] of row group {g}"
+        start += group.num_rows
+
+    columns = ["id"] + header.split(",")
+    assert list(table) == columns + ["passed"], f"columns {list(table)}"
+    assert len(table["id"]) == len(rows), f"{len(table['id'])} rows, want {len(rows)}"
+    assert all(table["passed"])
+    for name in columns:
+        for i, row in enumerate(rows):
+            got, want = table[name][i], row[name]
+            if name == "id":
+                ok = got == want
+            elif name == "length":
+                ok = got == int(want)
+            else:
+                ok = got == float(want)
+            assert ok, f"{name}[{i}] = {got!r}, want {want!r}"
+    print(f"{fastq}: {len(rows)} rows in {row_groups} row group(s) OK")
+
+
+def main():
+    phredsort = os.path.abspath(sys.argv[1])
+    here = os.path.dirname(os.path.abspath(__file__))
+    with tempfile.TemporaryDirectory() as tmp:
+        check(phredsort, os.path.join(here, "test.fastq"), "maxee,length,avgphred", tmp, 1)
+
+        large = os.path.join(tmp, "large.fastq")
+        write_fastq(large, 140000)  # More than one row group (parquetRowGroupSize)
+        check(phredsort, large, "maxee,length,lqcount", tmp, 2)
+
+
+if __name__ == "__main__":
+    main()